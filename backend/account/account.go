@@ -1,10 +1,14 @@
 package account
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"sort"
+	"sync"
 )
 
 type ClassID struct {
@@ -12,22 +16,57 @@ type ClassID struct {
 	Class int
 }
 
+// MarshalText lets ClassID be a json map key, written as "grade-class".
+func (classid ClassID) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d-%d", classid.Grade, classid.Class)), nil
+}
+
+func (classid *ClassID) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d-%d", &classid.Grade, &classid.Class)
+	return err
+}
+
+// classIDFields has the fields of ClassID without its methods, to keep the object form as values.
+type classIDFields ClassID
+
+func (classid ClassID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(classIDFields(classid))
+}
+
+func (classid *ClassID) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, (*classIDFields)(classid))
+}
+
 type UserInfo struct {
 	Uid       string
 	Password  string
 	Classid   ClassID
 	Privilege int
+	// Set by ResetPassword, the user must choose a new password before doing anything else.
+	MustChangePassword bool
+	// Set by SetUserRole to authorize the user as a role of the permission policy other than its privilege.
+	Role string
+	// Set when the student graduated, see PromoteStudents. Alumni keep their records but cannot log in.
+	Alumni bool
 }
 
 var (
 	userInfoMap   *concurrentmap.ConcurrentMap[string, UserInfo] // uid -> UserInfo
 	classUserMap  *concurrentmap.ConcurrentMap[ClassID, *concurrentmap.ConcurrentMap[string, struct{}]]
+	classInfoMap  *concurrentmap.ConcurrentMap[ClassID, ClassInfo]
 	accountLogger *logger.Logger
+	// classMutex is the lock for updating user records, not only class membership: registering,
+	// moving, removing and promoting users, changing their roles and editing classes take it, so that
+	// uids stay unique, a user stays in exactly one class set and the last admin is kept. Password
+	// writes touch nothing but the record itself and go through ModifyPair without it.
+	classMutex sync.Mutex
 )
 
 const (
 	userInfoPath  = "data/userInfo.json"
 	classUserPath = "data/classUser.json"
+	classInfoPath = "data/classes.json"
+	homeroomPath  = "data/homeroom.json" // written by versions before ClassInfo, read for migration only
 )
 
 const (
@@ -65,18 +104,30 @@ func PrivilegeToString(privilege int) string {
 func InitAccountSystem() {
 	userInfoMap = concurrentmap.NewConcurrentMap[string, UserInfo]()
 	classUserMap = concurrentmap.NewConcurrentMap[ClassID, *concurrentmap.ConcurrentMap[string, struct{}]]()
+	classInfoMap = concurrentmap.NewConcurrentMap[ClassID, ClassInfo]()
 	accountLogger = logger.GetLogger()
 	userInfoMap.Load(userInfoPath)
 	if _, ok := userInfoMap.ReadPair("admin"); !ok {
-		admin_info := &UserInfo{
-			Uid:       "admin",
-			Password:  "123456",
-			Classid:   ClassID{Grade: 0, Class: 0},
-			Privilege: PrivilegeAdmin,
+		// Without a hash there is no admin rather than one anybody could log in as.
+		password, err := hashPassword("123456")
+		if err != nil {
+			accountLogger.Log(logger.Error, "Failed to hash default admin password, no admin created: %v", err)
+		} else {
+			admin_info := &UserInfo{
+				Uid:       "admin",
+				Password:  password,
+				Classid:   ClassID{Grade: 0, Class: 0},
+				Privilege: PrivilegeAdmin,
+			}
+			userInfoMap.WritePair("admin", admin_info)
 		}
-		userInfoMap.WritePair("admin", admin_info)
 	}
 	classUserMap.Load(classUserPath)
+	loadClassInfoMap()
+	course.SetClassResolver(func(uid string) (course.ClassRef, bool) {
+		userInfo, ok := userInfoMap.ReadPair(uid)
+		return course.ClassRef(userInfo.Classid), ok
+	})
 	accountLogger.Log(logger.Info, "Account system initialized")
 }
 
@@ -89,31 +140,88 @@ func StoreAccountData() {
 	if err != nil {
 		accountLogger.Log(logger.Error, "Failed to store class user info: %v", err)
 	}
+	err = classInfoMap.Store(classInfoPath)
+	if err != nil {
+		accountLogger.Log(logger.Error, "Failed to store classes: %v", err)
+	}
 	accountLogger.Log(logger.Info, "Account data stored successfully")
 }
 
 func Register(userInfo UserInfo) error {
+	_, err := register(userInfo)
+	return err
+}
+
+// register adds the user and returns its stored password record, which tells this registration
+// apart from a later one of the same uid.
+func register(userInfo UserInfo) (string, error) {
+	// Both checks run before hashing to fail fast, and again under classMutex, where they hold.
 	if _, ok := userInfoMap.ReadPair(userInfo.Uid); ok {
 		accountLogger.Log(logger.Warn, "Registration failed: User %s already exists", userInfo.Uid)
-		return fmt.Errorf("user %s already exists", userInfo.Uid)
+		return "", fmt.Errorf("user %s already exists", userInfo.Uid)
+	}
+	if err := checkClassSeat(userInfo.Classid); err != nil {
+		accountLogger.Log(logger.Warn, "Registration failed: User %s: %v", userInfo.Uid, err)
+		return "", err
+	}
+	password, err := hashPassword(userInfo.Password)
+	if err != nil {
+		accountLogger.Log(logger.Error, "Registration failed: %v", err)
+		return "", err
+	}
+	userInfo.Password = password
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	if _, ok := userInfoMap.ReadPair(userInfo.Uid); ok {
+		accountLogger.Log(logger.Warn, "Registration failed: User %s already exists", userInfo.Uid)
+		return "", fmt.Errorf("user %s already exists", userInfo.Uid)
+	}
+	if err := checkClassSeat(userInfo.Classid); err != nil {
+		accountLogger.Log(logger.Warn, "Registration failed: User %s: %v", userInfo.Uid, err)
+		return "", err
 	}
 	userInfoMap.WritePair(userInfo.Uid, &userInfo)
-	classMap, ok := classUserMap.ReadPair(userInfo.Classid)
+	addToClass(userInfo.Classid, userInfo.Uid)
+	return userInfo.Password, nil
+}
+
+// addToClass puts uid in the set of classid, creating it if needed. The caller holds classMutex.
+func addToClass(classid ClassID, uid string) {
+	classMap, ok := classUserMap.ReadPair(classid)
 	if !ok {
 		classMap = concurrentmap.NewConcurrentMap[string, struct{}]()
 	}
-	classMap.WritePair(userInfo.Uid, &struct{}{})
-	classUserMap.WritePair(userInfo.Classid, &classMap)
-	return nil
+	classMap.WritePair(uid, &struct{}{})
+	classUserMap.WritePair(classid, &classMap)
 }
 
+// RemoveUser erases uid: its sessions, its place in its class and everything the course system
+// keeps about it, so no roster or waitlist names a user that no longer exists. The last admin
+// cannot be removed.
 func RemoveUser(uid string) error {
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	return removeUser(uid)
+}
+
+// removeUser is RemoveUser for a caller that holds classMutex.
+func removeUser(uid string) error {
 	userInfo, ok := userInfoMap.ReadPair(uid)
 	if !ok {
 		accountLogger.Log(logger.Warn, "Removal failed: User %s does not exist", uid)
 		return fmt.Errorf("user %s does not exist", uid)
 	}
+	if userInfo.role() == "admin" && countAdmins() == 1 {
+		accountLogger.Log(logger.Warn, "Removal failed: User %s is the last admin", uid)
+		return fmt.Errorf("user %s is the last admin", uid)
+	}
 	userInfoMap.DeletePair(uid)
+	privilege.RevokeUserSessions(uid)
+	course.ForgetUser(uid)
+	dropHomeroom(uid)
+	if userInfo.Alumni {
+		return nil // alumni left the class sets when they graduated
+	}
 	classid := userInfo.Classid
 	classMap, ok := classUserMap.ReadPair(classid)
 	if !ok {
@@ -125,32 +233,176 @@ func RemoveUser(uid string) error {
 	return nil
 }
 
+// ModifyUser moves uid to another class and gives it another privilege, keeping its enrollments,
+// which the course system keys by uid alone. Sessions are revoked when the privilege changes, since
+// they carry the old one, a role given by SetUserRole is dropped with the old privilege, and a
+// teacher who stops being one is no longer homeroom teacher anywhere.
+func ModifyUser(uid string, classid ClassID, newPrivilege int) error {
+	if PrivilegeToString(newPrivilege) == "unknown" {
+		accountLogger.Log(logger.Warn, "User modification failed: Unknown privilege %d", newPrivilege)
+		return fmt.Errorf("unknown privilege %d", newPrivilege)
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	userInfo, ok := userInfoMap.ReadPair(uid)
+	if !ok {
+		accountLogger.Log(logger.Warn, "User modification failed: User %s does not exist", uid)
+		return fmt.Errorf("user %s does not exist", uid)
+	}
+	if userInfo.Alumni {
+		accountLogger.Log(logger.Warn, "User modification failed: User %s has graduated", uid)
+		return fmt.Errorf("user %s has graduated", uid)
+	}
+	if userInfo.role() == "admin" && newPrivilege != PrivilegeAdmin && countAdmins() == 1 {
+		accountLogger.Log(logger.Warn, "User modification failed: User %s is the last admin", uid)
+		return fmt.Errorf("user %s is the last admin", uid)
+	}
+	if userInfo.Classid != classid {
+		if err := checkClassSeat(classid); err != nil {
+			accountLogger.Log(logger.Warn, "User modification failed: User %s: %v", uid, err)
+			return err
+		}
+	}
+	if !userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) {
+		userInfo.Classid = classid
+		if userInfo.Privilege != newPrivilege {
+			userInfo.Privilege = newPrivilege
+			userInfo.Role = ""
+		}
+	}) {
+		accountLogger.Log(logger.Warn, "User modification failed: User %s does not exist", uid)
+		return fmt.Errorf("user %s does not exist", uid)
+	}
+	if userInfo.Classid != classid {
+		if classMap, ok := classUserMap.ReadPair(userInfo.Classid); ok {
+			classMap.DeletePair(uid)
+		} else {
+			accountLogger.Log(logger.Error, "Inconsistent state: Class %v for user %s does not exist", userInfo.Classid, uid)
+		}
+		addToClass(classid, uid)
+	}
+	if userInfo.Privilege != newPrivilege {
+		privilege.RevokeUserSessions(uid)
+		if userInfo.Privilege == PrivilegeTeacher {
+			dropHomeroom(uid)
+		}
+	}
+	accountLogger.Log(logger.Info, "User %s modified: class %v -> %v, privilege %s -> %s", uid, userInfo.Classid, classid,
+		PrivilegeToString(userInfo.Privilege), PrivilegeToString(newPrivilege))
+	return nil
+}
+
+// countAdmins counts the users acting as admin, those with a role of their own do not.
+func countAdmins() int {
+	count := 0
+	for _, userInfo := range userInfoMap.ReadAll() {
+		if userInfo.role() == "admin" {
+			count++
+		}
+	}
+	return count
+}
+
 func LogIn(uid string, password string) (int, error) {
 	userInfo, ok := userInfoMap.ReadPair(uid)
 	if !ok {
 		accountLogger.Log(logger.Warn, "Login failed: User %s does not exist", uid)
 		return 0, fmt.Errorf("user %s does not exist", uid)
 	}
-	if userInfo.Password != password {
+	match, needUpgrade := verifyPassword(userInfo.Password, password)
+	if !match {
 		accountLogger.Log(logger.Warn, "Login failed: Incorrect password for user %s", uid)
 		return 0, fmt.Errorf("incorrect password for user %s", uid)
 	}
+	if userInfo.Alumni {
+		accountLogger.Log(logger.Warn, "Login failed: User %s has graduated", uid)
+		return 0, fmt.Errorf("user %s has graduated", uid)
+	}
+	if needUpgrade {
+		upgradePassword(uid, userInfo.Password, password)
+	}
 	accountLogger.Log(logger.Info, "User %s logged in successfully", uid)
 	return userInfo.Privilege, nil
 }
 
+// upgradePassword rehashes a legacy or weak record, unless it has been changed or removed meanwhile.
+func upgradePassword(uid string, oldRecord string, password string) {
+	newRecord, err := hashPassword(password)
+	if err != nil {
+		accountLogger.Log(logger.Error, "Password upgrade failed for user %s: %v", uid, err)
+		return
+	}
+	upgraded := false
+	userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) {
+		if userInfo.Password == oldRecord {
+			userInfo.Password = newRecord
+			upgraded = true
+		}
+	})
+	if upgraded {
+		accountLogger.Log(logger.Info, "Password record of user %s upgraded", uid)
+	}
+}
+
 func ModifyPassword(uid string, newPassword string) error {
-	userInfo, ok := userInfoMap.ReadPair(uid)
-	if !ok {
+	if _, ok := userInfoMap.ReadPair(uid); !ok {
+		accountLogger.Log(logger.Warn, "Password modification failed: User %s does not exist", uid)
+		return fmt.Errorf("user %s does not exist", uid)
+	}
+	password, err := hashPassword(newPassword)
+	if err != nil {
+		accountLogger.Log(logger.Error, "Password modification failed: %v", err)
+		return err
+	}
+	// The user may be removed while hashing, so write back only if it still exists.
+	if !userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) {
+		userInfo.Password = password
+		userInfo.MustChangePassword = false
+	}) {
 		accountLogger.Log(logger.Warn, "Password modification failed: User %s does not exist", uid)
 		return fmt.Errorf("user %s does not exist", uid)
 	}
-	userInfo.Password = newPassword
-	userInfoMap.WritePair(uid, &userInfo)
+	// Whoever knew the old password must not stay logged in.
+	privilege.RevokeUserSessions(uid)
 	accountLogger.Log(logger.Info, "Password for user %s modified successfully", uid)
 	return nil
 }
 
+// ResetPassword replaces the password of uid with a random temporary one, which is returned
+// to the caller and must be changed at the next LogIn.
+func ResetPassword(uid string) (string, error) {
+	if _, ok := userInfoMap.ReadPair(uid); !ok {
+		accountLogger.Log(logger.Warn, "Password reset failed: User %s does not exist", uid)
+		return "", fmt.Errorf("user %s does not exist", uid)
+	}
+	temporary, err := generateTemporaryPassword()
+	if err != nil {
+		accountLogger.Log(logger.Error, "Password reset failed: %v", err)
+		return "", err
+	}
+	password, err := hashPassword(temporary)
+	if err != nil {
+		accountLogger.Log(logger.Error, "Password reset failed: %v", err)
+		return "", err
+	}
+	if !userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) {
+		userInfo.Password = password
+		userInfo.MustChangePassword = true
+	}) {
+		accountLogger.Log(logger.Warn, "Password reset failed: User %s does not exist", uid)
+		return "", fmt.Errorf("user %s does not exist", uid)
+	}
+	privilege.RevokeUserSessions(uid)
+	accountLogger.Log(logger.Info, "Password for user %s reset to a temporary one", uid)
+	return temporary, nil
+}
+
+// PasswordChangeRequired reports whether uid still holds a temporary password.
+func PasswordChangeRequired(uid string) bool {
+	userInfo, ok := userInfoMap.ReadPair(uid)
+	return ok && userInfo.MustChangePassword
+}
+
 func GetUserInfo(uid string) (*UserInfo, error) {
 	userInfo, ok := userInfoMap.ReadPair(uid)
 	if !ok {
@@ -161,11 +413,14 @@ func GetUserInfo(uid string) (*UserInfo, error) {
 }
 
 func GetClassUsersInfo(classid ClassID) ([]*UserInfo, error) {
-	classMap, ok := classUserMap.ReadPair(classid)
-	if !ok {
+	if _, ok := classInfoMap.ReadPair(classid); !ok {
 		accountLogger.Log(logger.Warn, "GetClassUsers failed: Class %v does not exist", classid)
 		return nil, fmt.Errorf("class %v does not exist", classid)
 	}
+	classMap, ok := classUserMap.ReadPair(classid)
+	if !ok {
+		return []*UserInfo{}, nil
+	}
 	users_names := classMap.ReadAll()
 	result := make([]*UserInfo, 0, len(users_names))
 	for uid := range users_names {
@@ -177,6 +432,7 @@ func GetClassUsersInfo(classid ClassID) ([]*UserInfo, error) {
 			return nil, fmt.Errorf("inconsistent state: user %s in class %v does not exist", uid, classid)
 		}
 	}
+	sortUsers(result)
 	return result, nil
 }
 
@@ -192,6 +448,7 @@ func GetCourseUsersInfo(uid string) ([]*UserInfo, error) {
 			return nil, fmt.Errorf("inconsistent state: user %s in course %s does not exist", cid, course_id)
 		}
 	}
+	sortUsers(result)
 	return result, nil
 }
 
@@ -201,5 +458,11 @@ func GetAllUsersInfo() []*UserInfo {
 	for _, userInfo := range all_users {
 		result = append(result, &userInfo)
 	}
+	sortUsers(result)
 	return result
 }
+
+// sortUsers orders a listing by uid, so it no longer follows the map iteration.
+func sortUsers(users []*UserInfo) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Uid < users[j].Uid })
+}
@@ -1,24 +1,38 @@
 package account
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
 )
 
+// TestMain 只设置一次日志文件，使子测试中的 setupAccountTest 不再重新打开它。
+func TestMain(m *testing.M) {
+	accountLogger = logger.GetLogger()
+	os.Remove("account_test.log") // 删除旧的日志文件以避免干扰
+	accountLogger.SetLogFile("account_test.log")
+	os.Exit(m.Run())
+}
+
 // setupAccountTest 是一个辅助函数，用于在每个测试之前初始化或重置系统状态。
 // 这确保了测试的独立性，避免了对真实文件的读写依赖。
 func setupAccountTest() {
 	userInfoMap = concurrentmap.NewConcurrentMap[string, UserInfo]()
 	classUserMap = concurrentmap.NewConcurrentMap[ClassID, *concurrentmap.ConcurrentMap[string, struct{}]]()
-	accountLogger = logger.GetLogger() // 假设 GetLogger 可以安全地重复调用
-	os.Remove("account_test.log")      // 删除旧的日志文件以避免干扰
-	accountLogger.SetLogFile("account_test.log")
+	classInfoMap = concurrentmap.NewConcurrentMap[ClassID, ClassInfo]()
+	privilege.InitPrivilegeSystem()
+	course.InitCourseSystem()
+	hashIterations = 1000 // 测试中降低哈希强度以加快速度
 
 	// 为测试添加一个默认的 admin 用户，模拟 InitAccountSystem 的行为
 	adminInfo := UserInfo{
@@ -28,6 +42,14 @@ func setupAccountTest() {
 		Classid:   ClassID{Grade: 0, Class: 0},
 	}
 	userInfoMap.WritePair("admin", &adminInfo)
+
+	// 注册前班级必须存在，预先建好 1 到 5 年级的 1 到 5 班
+	classInfoMap.WritePair(staffClass, &ClassInfo{Classid: staffClass})
+	for grade := 1; grade <= 5; grade++ {
+		for class := 1; class <= 5; class++ {
+			CreateClass(ClassID{Grade: grade, Class: class}, "", 0)
+		}
+	}
 }
 
 // TestPrivilegeConversion 测试权限与字符串之间的转换函数。
@@ -69,6 +91,24 @@ func TestPrivilegeConversion(t *testing.T) {
 	})
 }
 
+// TestClassIDJson 测试 ClassID 作为值保持对象格式，作为 map 键时写成 "grade-class"。
+func TestClassIDJson(t *testing.T) {
+	user := UserInfo{Uid: "json_user", Classid: ClassID{Grade: 3, Class: 4}}
+	data, _ := json.Marshal(user)
+	if !strings.Contains(string(data), `"Classid":{"Grade":3,"Class":4}`) {
+		t.Errorf("ClassID 作为值时应保持对象格式，实际为 %s", data)
+	}
+	keyed := map[ClassID]string{{Grade: 3, Class: 4}: "teacher"}
+	data, err := json.Marshal(keyed)
+	if err != nil || string(data) != `{"3-4":"teacher"}` {
+		t.Fatalf("ClassID 作为键的编码不正确: %s, %v", data, err)
+	}
+	decoded := map[ClassID]string{}
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded[ClassID{Grade: 3, Class: 4}] != "teacher" {
+		t.Errorf("ClassID 作为键的解码不正确: %v, %v", decoded, err)
+	}
+}
+
 // TestRegister 测试用户注册功能。
 func TestRegister(t *testing.T) {
 	setupAccountTest()
@@ -92,6 +132,10 @@ func TestRegister(t *testing.T) {
 		if !ok {
 			t.Fatal("注册后，在 userInfoMap 中找不到用户")
 		}
+		if match, _ := verifyPassword(info.Password, user.Password); !match || info.Password == user.Password {
+			t.Errorf("注册后存储的密码应为哈希值。得到 %q", info.Password)
+		}
+		info.Password = user.Password
 		if !reflect.DeepEqual(info, user) {
 			t.Errorf("注册后存储的用户信息不正确。得到 %+v, 期望 %+v", info, user)
 		}
@@ -114,6 +158,31 @@ func TestRegister(t *testing.T) {
 			t.Error("注册已存在的用户时，期望得到一个错误，但实际为 nil")
 		}
 	})
+
+	// 场景3: 并发注册同一个用户，只有一个成功，且不会覆盖其记录
+	t.Run("ConcurrentRegistration", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = Register(UserInfo{Uid: "racer", Password: fmt.Sprintf("pw%d", i), Classid: ClassID{Grade: 1, Class: 2}})
+			}(i)
+		}
+		wg.Wait()
+		if (errs[0] == nil) == (errs[1] == nil) {
+			t.Fatalf("并发注册同一用户时应恰好一个成功，得到 %v", errs)
+		}
+		winner := 0
+		if errs[0] != nil {
+			winner = 1
+		}
+		info, _ := userInfoMap.ReadPair("racer")
+		if match, _ := verifyPassword(info.Password, fmt.Sprintf("pw%d", winner)); !match {
+			t.Error("成功注册的用户的密码被另一次注册覆盖")
+		}
+	})
 }
 
 // TestRemoveUser 测试用户移除功能。
@@ -158,6 +227,68 @@ func TestRemoveUser(t *testing.T) {
 			t.Error("移除不存在的用户时，期望得到一个错误，但实际为 nil")
 		}
 	})
+
+	// 场景: 不能移除最后一个管理员
+	t.Run("RemoveLastAdmin", func(t *testing.T) {
+		if err := RemoveUser("admin"); err == nil {
+			t.Error("移除最后一个管理员时，期望得到一个错误，但实际为 nil")
+		}
+		if _, ok := userInfoMap.ReadPair("admin"); !ok {
+			t.Error("最后一个管理员不应被移除")
+		}
+	})
+
+	// 场景3: 移除已选课的用户，其名额交给候补队列
+	t.Run("RemoveEnrolledUser", func(t *testing.T) {
+		Register(UserInfo{Uid: "enrolled", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+		Register(UserInfo{Uid: "waiting", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+		course.AddCourse("Full Course", "teacher", 1, 1)
+		course.LaunchCourse("Full Course")
+		course.SelectCourse("enrolled", "Full Course")
+		course.JoinWaitlist("waiting", "Full Course")
+
+		if err := RemoveUser("enrolled"); err != nil {
+			t.Fatalf("移除用户失败: %v", err)
+		}
+		users, err := GetCourseUsersInfo("Full Course")
+		if err != nil {
+			t.Fatalf("移除用户后，课程名册应保持一致: %v", err)
+		}
+		if len(users) != 1 || users[0].Uid != "waiting" {
+			t.Errorf("释放的名额应交给候补学生，实际名册为 %+v", users)
+		}
+	})
+}
+
+// TestRevokeSessions 测试移除用户或修改密码后，该用户的所有会话立即失效。
+func TestRevokeSessions(t *testing.T) {
+	setupAccountTest()
+
+	user := UserInfo{Uid: "student_revoke", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}}
+	Register(user)
+
+	t.Run("ModifyPasswordRevokes", func(t *testing.T) {
+		token1 := privilege.UserLogIn(privilege.AccountInfo{UserName: user.Uid})
+		token2 := privilege.UserLogIn(privilege.AccountInfo{UserName: user.Uid})
+		if err := ModifyPassword(user.Uid, "newpw"); err != nil {
+			t.Fatalf("修改密码失败: %v", err)
+		}
+		for _, token := range []string{token1, token2} {
+			if _, err := privilege.UserAccess(token); err == nil {
+				t.Error("修改密码后，旧会话应失效")
+			}
+		}
+	})
+
+	t.Run("RemoveUserRevokes", func(t *testing.T) {
+		token := privilege.UserLogIn(privilege.AccountInfo{UserName: user.Uid})
+		if err := RemoveUser(user.Uid); err != nil {
+			t.Fatalf("移除用户失败: %v", err)
+		}
+		if _, err := privilege.UserAccess(token); err == nil {
+			t.Error("移除用户后，其会话应失效")
+		}
+	})
 }
 
 // TestLogIn 测试用户登录功能。
@@ -222,8 +353,8 @@ func TestModifyPassword(t *testing.T) {
 
 		// 验证新密码是否生效
 		info, _ := userInfoMap.ReadPair(user.Uid)
-		if info.Password != newPassword {
-			t.Errorf("修改密码后，存储的密码不正确。得到 %q, 期望 %q", info.Password, newPassword)
+		if match, _ := verifyPassword(info.Password, newPassword); !match {
+			t.Errorf("修改密码后，存储的密码哈希与新密码不匹配。得到 %q", info.Password)
 		}
 
 		// 尝试用新密码登录
@@ -242,6 +373,141 @@ func TestModifyPassword(t *testing.T) {
 	})
 }
 
+// TestPasswordHashing 测试密码哈希格式、校验以及旧明文记录的升级。
+func TestPasswordHashing(t *testing.T) {
+	setupAccountTest()
+
+	t.Run("HashFormat", func(t *testing.T) {
+		hash1, err := hashPassword("secret")
+		if err != nil {
+			t.Fatalf("哈希密码失败: %v", err)
+		}
+		hash2, _ := hashPassword("secret")
+		if !isHashedPassword(hash1) || strings.Count(hash1, "$") != 4 {
+			t.Errorf("哈希格式不正确: %q", hash1)
+		}
+		if hash1 == hash2 {
+			t.Error("相同密码的两次哈希应因盐不同而不同")
+		}
+		if match, _ := verifyPassword(hash1, "secret"); !match {
+			t.Error("正确的密码未通过校验")
+		}
+		if match, _ := verifyPassword(hash1, "Secret"); match {
+			t.Error("错误的密码通过了校验")
+		}
+		if match, _ := verifyPassword("", ""); match {
+			t.Error("空的密码记录不应通过校验")
+		}
+	})
+
+	t.Run("WeakHashNeedsUpgrade", func(t *testing.T) {
+		hash, _ := hashPassword("secret")
+		hashIterations *= 2
+		defer func() { hashIterations /= 2 }()
+		if match, needUpgrade := verifyPassword(hash, "secret"); !match || !needUpgrade {
+			t.Errorf("低于当前迭代次数的哈希应需要升级。match=%v, needUpgrade=%v", match, needUpgrade)
+		}
+	})
+
+	t.Run("LegacyPlaintextUpgrade", func(t *testing.T) {
+		// setupAccountTest 写入的 admin 使用明文密码，模拟旧数据
+		if _, err := LogIn("admin", "wrong"); err == nil {
+			t.Error("使用错误的密码登录旧明文账户时，期望得到一个错误，但实际为 nil")
+		}
+		if info, _ := userInfoMap.ReadPair("admin"); info.Password != "123456" {
+			t.Error("登录失败时不应升级旧明文密码")
+		}
+		if _, err := LogIn("admin", "123456"); err != nil {
+			t.Fatalf("使用旧明文密码登录失败: %v", err)
+		}
+		info, _ := userInfoMap.ReadPair("admin")
+		if !isHashedPassword(info.Password) {
+			t.Errorf("成功登录后，旧明文密码应被升级为哈希，实际为 %q", info.Password)
+		}
+		if _, err := LogIn("admin", "123456"); err != nil {
+			t.Errorf("升级后使用原密码登录失败: %v", err)
+		}
+	})
+}
+
+// TestResetPassword 测试管理员重置密码以及强制修改密码标记。
+func TestResetPassword(t *testing.T) {
+	setupAccountTest()
+
+	user := UserInfo{Uid: "student_reset", Password: "oldPassword", Classid: ClassID{Grade: 1, Class: 1}}
+	Register(user)
+
+	temporary, err := ResetPassword(user.Uid)
+	if err != nil {
+		t.Fatalf("重置密码失败: %v", err)
+	}
+	if len(temporary) != temporaryLength {
+		t.Errorf("临时密码长度应为 %d, 实际为 %d", temporaryLength, len(temporary))
+	}
+	if !PasswordChangeRequired(user.Uid) {
+		t.Error("重置密码后，用户应被要求修改密码")
+	}
+	if _, err := LogIn(user.Uid, user.Password); err == nil {
+		t.Error("重置密码后，旧密码不应再能登录")
+	}
+	if _, err := LogIn(user.Uid, temporary); err != nil {
+		t.Errorf("使用临时密码登录失败: %v", err)
+	}
+	if err := ModifyPassword(user.Uid, "brandNew"); err != nil {
+		t.Fatalf("修改密码失败: %v", err)
+	}
+	if PasswordChangeRequired(user.Uid) {
+		t.Error("修改密码后，强制修改密码标记应被清除")
+	}
+	if _, err := ResetPassword("nonexistentuser"); err == nil {
+		t.Error("重置不存在用户的密码时，期望得到一个错误，但实际为 nil")
+	}
+}
+
+// TestScopedAccess 测试教师只能查看自己担任班主任的班级和自己任教课程的学生。
+func TestScopedAccess(t *testing.T) {
+	setupAccountTest()
+
+	class1 := ClassID{Grade: 1, Class: 1}
+	class2 := ClassID{Grade: 1, Class: 2}
+	Register(UserInfo{Uid: "teacher_a", Password: "pw", Privilege: PrivilegeTeacher})
+	Register(UserInfo{Uid: "student_in_class", Password: "pw", Classid: class1})
+	Register(UserInfo{Uid: "student_in_course", Password: "pw", Classid: class2})
+	Register(UserInfo{Uid: "student_other", Password: "pw", Classid: class2})
+	course.AddCourse("Scoped Course", "teacher_a", 5, 1)
+	course.AddCourse("Other Course", "teacher_b", 5, 1)
+	course.LaunchCourse("Scoped Course")
+	course.SelectCourse("student_in_course", "Scoped Course")
+
+	if err := SetHomeroomTeacher(class1, "student_other"); err == nil {
+		t.Error("将学生设为班主任时，期望得到一个错误")
+	}
+	if err := SetHomeroomTeacher(class1, "teacher_a"); err != nil {
+		t.Fatalf("设置班主任失败: %v", err)
+	}
+
+	if err := CheckClassAccess("teacher_a", class1); err != nil {
+		t.Errorf("班主任应能查看自己的班级: %v", err)
+	}
+	if err := CheckClassAccess("teacher_a", class2); err == nil || !strings.HasPrefix(err.Error(), "forbidden") {
+		t.Errorf("教师查看其他班级时应得到 forbidden 错误，实际为 %v", err)
+	}
+	if err := CheckCourseAccess("teacher_a", "Scoped Course"); err != nil {
+		t.Errorf("任课教师应能查看自己的课程: %v", err)
+	}
+	if err := CheckCourseAccess("teacher_a", "Other Course"); err == nil {
+		t.Error("教师查看他人课程时，期望得到一个错误")
+	}
+	for _, uid := range []string{"student_in_class", "student_in_course", "teacher_a"} {
+		if err := CheckUserAccess("teacher_a", uid); err != nil {
+			t.Errorf("教师应能查看用户 %s: %v", uid, err)
+		}
+	}
+	if err := CheckUserAccess("teacher_a", "student_other"); err == nil {
+		t.Error("教师查看无关学生时，期望得到一个错误")
+	}
+}
+
 // TestGetUserInfo 测试获取单个用户信息的函数。
 func TestGetUserInfo(t *testing.T) {
 	setupAccountTest()
@@ -259,7 +525,9 @@ func TestGetUserInfo(t *testing.T) {
 		if err != nil {
 			t.Fatalf("获取存在的用户信息失败: %v", err)
 		}
-		if !reflect.DeepEqual(*info, user) {
+		got := *info
+		got.Password = user.Password
+		if !reflect.DeepEqual(got, user) {
 			t.Errorf("获取到的用户信息不正确。得到 %+v, 期望 %+v", *info, user)
 		}
 	})
@@ -279,6 +547,8 @@ func TestGetClassAndAllUsersInfo(t *testing.T) {
 
 	class1 := ClassID{Grade: 10, Class: 1}
 	class2 := ClassID{Grade: 10, Class: 2}
+	CreateClass(class1, "", 0)
+	CreateClass(class2, "", 0)
 
 	userC1_1 := UserInfo{Uid: "userC1_1", Classid: class1}
 	userC1_2 := UserInfo{Uid: "userC1_2", Classid: class1}
@@ -322,6 +592,415 @@ func TestGetClassAndAllUsersInfo(t *testing.T) {
 	})
 }
 
+// TestSearchUsers 测试用户的搜索、筛选、排序和分页。
+func TestSearchUsers(t *testing.T) {
+	setupAccountTest()
+	Register(UserInfo{Uid: "stu_amy", Classid: ClassID{Grade: 2, Class: 1}})
+	Register(UserInfo{Uid: "stu_ben", Classid: ClassID{Grade: 1, Class: 3}})
+	Register(UserInfo{Uid: "stu_cat", Classid: ClassID{Grade: 1, Class: 1}})
+	Register(UserInfo{Uid: "tea_amy", Classid: ClassID{Grade: 3, Class: 1}, Privilege: PrivilegeTeacher})
+
+	uids := func(page *UserPage) []string {
+		result := []string{}
+		for _, userInfo := range page.Users {
+			result = append(result, userInfo.Uid)
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		query    UserQuery
+		expected []string
+	}{
+		{"Prefix", UserQuery{Prefix: "stu_"}, []string{"stu_amy", "stu_ben", "stu_cat"}},
+		{"Contains", UserQuery{Contains: "AMY"}, []string{"stu_amy", "tea_amy"}},
+		{"Privilege", UserQuery{Privileges: []int{PrivilegeTeacher, PrivilegeAdmin}}, []string{"admin", "tea_amy"}},
+		{"ClassRange", UserQuery{FromClass: &ClassID{Grade: 1, Class: 2}, ToClass: &ClassID{Grade: 2, Class: 1}}, []string{"stu_amy", "stu_ben"}},
+		{"SortByClass", UserQuery{Prefix: "stu_", Sort: SortByClass}, []string{"stu_cat", "stu_ben", "stu_amy"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := SearchUsers(test.query)
+			if err != nil {
+				t.Fatalf("搜索用户失败: %v", err)
+			}
+			if !reflect.DeepEqual(uids(page), test.expected) {
+				t.Errorf("期望结果为 %v，实际为 %v", test.expected, uids(page))
+			}
+		})
+	}
+
+	t.Run("Pagination", func(t *testing.T) {
+		query := UserQuery{Sort: SortByClass, Limit: 2}
+		first, _ := SearchUsers(query)
+		if first.Total != 5 || !reflect.DeepEqual(uids(first), []string{"admin", "stu_cat"}) || first.NextCursor == "" {
+			t.Fatalf("第一页不正确: %v, 共 %d 人", uids(first), first.Total)
+		}
+		// 翻页之间注册的新用户排在游标之前，不应导致重复
+		CreateClass(ClassID{Grade: 0, Class: 5}, "", 0)
+		Register(UserInfo{Uid: "stu_abe", Classid: ClassID{Grade: 0, Class: 5}})
+		query.Cursor = first.NextCursor
+		second, err := SearchUsers(query)
+		if err != nil {
+			t.Fatalf("获取第二页失败: %v", err)
+		}
+		if !reflect.DeepEqual(uids(second), []string{"stu_ben", "stu_amy"}) {
+			t.Errorf("期望第二页为 [stu_ben stu_amy]，实际为 %v", uids(second))
+		}
+		if _, err := SearchUsers(UserQuery{Cursor: "not a cursor"}); err == nil {
+			t.Error("使用非法游标时，期望得到一个错误，但实际为 nil")
+		}
+	})
+}
+
+// TestImportUsers 测试从 CSV 批量导入用户的两种模式。
+func TestImportUsers(t *testing.T) {
+	const csvContent = "\ufeffusername,password,grade,class,role\n" +
+		"stu_001,pw1,1,2,student\n" +
+		"bad name,pw2,1,2,student\n" +
+		"tea_001,pw3,0,0,Teacher\n" +
+		"stu_001,pw4,1,2,student\n" +
+		"stu_002,pw5,x,2,student\n"
+
+	t.Run("AllOrNothing", func(t *testing.T) {
+		setupAccountTest()
+		report, err := ImportUsers(strings.NewReader(csvContent), ImportAllOrNothing)
+		if err == nil {
+			t.Fatal("存在非法行时，期望全部导入失败，但实际为 nil")
+		}
+		if report == nil || report.Imported != 0 || len(report.Rows) != 5 {
+			t.Fatalf("导入报告不正确: %+v", report)
+		}
+		if _, ok := userInfoMap.ReadPair("stu_001"); ok {
+			t.Error("全部导入失败后，不应注册任何用户")
+		}
+		if report.Rows[0].Line != 2 || !strings.Contains(report.Rows[0].Error, "skipped") {
+			t.Errorf("合法行应标记为跳过，实际为 %+v", report.Rows[0])
+		}
+	})
+
+	t.Run("BestEffort", func(t *testing.T) {
+		setupAccountTest()
+		report, err := ImportUsers(strings.NewReader(csvContent), ImportBestEffort)
+		if err != nil {
+			t.Fatalf("尽力导入失败: %v", err)
+		}
+		if report.Imported != 2 {
+			t.Errorf("期望导入 2 个用户，实际为 %d", report.Imported)
+		}
+		expected := []struct {
+			imported bool
+			message  string
+		}{{true, ""}, {false, "must be 1 to 10"}, {true, ""}, {false, "repeated from line 2"}, {false, "grade"}}
+		for i, row := range report.Rows {
+			if row.Imported != expected[i].imported || !strings.Contains(row.Error, expected[i].message) {
+				t.Errorf("第 %d 行的结果不正确: %+v", row.Line, row)
+			}
+		}
+		teacher, err := GetUserInfo("tea_001")
+		if err != nil || teacher.Privilege != PrivilegeTeacher {
+			t.Errorf("教师账号未正确导入: %+v, %v", teacher, err)
+		}
+		if _, err := LogIn("stu_001", "pw1"); err != nil {
+			t.Errorf("导入的用户无法使用初始密码登录: %v", err)
+		}
+	})
+
+	t.Run("ClassFull", func(t *testing.T) {
+		setupAccountTest()
+		ModifyClass(ClassID{Grade: 1, Class: 2}, "", 2)
+		Register(UserInfo{Uid: "stu_000", Password: "pw", Classid: ClassID{Grade: 1, Class: 2}})
+		const fullContent = "stu_001,pw1,1,2,student\n" +
+			"stu_002,pw2,1,2,student\n"
+		report, err := ImportUsers(strings.NewReader(fullContent), ImportAllOrNothing)
+		if err == nil {
+			t.Fatal("班级容量不足时，期望在写入前失败，但实际为 nil")
+		}
+		if report.Rows[0].Error != "skipped because other rows failed" || !strings.Contains(report.Rows[1].Error, "is full") {
+			t.Errorf("应在预检阶段发现第二行超出班级容量: %+v", report.Rows)
+		}
+		if _, ok := userInfoMap.ReadPair("stu_001"); ok {
+			t.Error("预检失败后，不应注册任何用户")
+		}
+	})
+
+	t.Run("RollbackKeepsOthers", func(t *testing.T) {
+		setupAccountTest()
+		record, err := register(UserInfo{Uid: "stu_001", Password: "pw1", Classid: ClassID{Grade: 1, Class: 2}})
+		if err != nil {
+			t.Fatalf("注册失败: %v", err)
+		}
+		// 模拟该用户在导入期间被删除并由他人重新注册
+		RemoveUser("stu_001")
+		Register(UserInfo{Uid: "stu_001", Password: "pw2", Classid: ClassID{Grade: 1, Class: 2}})
+		removeImported("stu_001", record)
+		if _, err := LogIn("stu_001", "pw2"); err != nil {
+			t.Errorf("回滚不应删除他人注册的同名用户: %v", err)
+		}
+	})
+}
+
+// TestModifyUser 检查调班、改身份时班级集合、会话和班主任的一致性。
+func TestModifyUser(t *testing.T) {
+	setupAccountTest()
+	Register(UserInfo{Uid: "stu", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+	Register(UserInfo{Uid: "tea", Password: "pw", Privilege: PrivilegeTeacher})
+	SetHomeroomTeacher(ClassID{Grade: 1, Class: 1}, "tea")
+
+	if err := ModifyUser("stu", ClassID{Grade: 1, Class: 2}, PrivilegeStudent); err != nil {
+		t.Fatalf("调班失败: %v", err)
+	}
+	if users, _ := GetClassUsersInfo(ClassID{Grade: 1, Class: 1}); len(users) != 0 {
+		t.Errorf("调班后原班级仍有 %d 个用户", len(users))
+	}
+	if users, _ := GetClassUsersInfo(ClassID{Grade: 1, Class: 2}); len(users) != 1 || users[0].Uid != "stu" {
+		t.Errorf("调班后新班级的用户不正确: %v", users)
+	}
+
+	token := privilege.UserLogIn(privilege.AccountInfo{UserName: "tea", Privilege: PrivilegeTeacher})
+	if err := ModifyUser("tea", ClassID{}, PrivilegeAdmin); err != nil {
+		t.Fatalf("提升为管理员失败: %v", err)
+	}
+	if _, err := privilege.UserAccess(token); err == nil {
+		t.Error("身份改变后，旧的会话应被撤销")
+	}
+	if isHomeroomTeacher("tea", ClassID{Grade: 1, Class: 1}) {
+		t.Error("不再是教师的用户不应继续担任班主任")
+	}
+
+	if err := ModifyUser("stu", ClassID{}, 7); err == nil {
+		t.Error("未知身份应返回错误")
+	}
+	if err := ModifyUser("ghost", ClassID{}, PrivilegeStudent); err == nil {
+		t.Error("修改不存在的用户应返回错误")
+	}
+	ModifyUser("tea", ClassID{}, PrivilegeTeacher)
+	if err := ModifyUser("admin", ClassID{}, PrivilegeTeacher); err == nil {
+		t.Error("不能撤销最后一个管理员的权限")
+	}
+}
+
+// TestSetUserRole 检查自定义角色的设置、校验，以及改身份时角色被清除。
+func TestSetUserRole(t *testing.T) {
+	setupAccountTest()
+	Register(UserInfo{Uid: "tea", Password: "pw", Privilege: PrivilegeTeacher})
+
+	if role := UserRole("tea"); role != "teacher" {
+		t.Errorf("未设置角色时应使用身份名称，实际为 %q", role)
+	}
+	if err := SetUserRole("tea", "head teacher"); err != nil {
+		t.Fatalf("设置角色失败: %v", err)
+	}
+	if role := UserRole("tea"); role != "head teacher" {
+		t.Errorf("期望角色为 head teacher，实际为 %q", role)
+	}
+	if err := SetUserRole("tea", "Head!"); err == nil {
+		t.Error("非法的角色名应返回错误")
+	}
+	if err := SetUserRole("tea", "admin"); err == nil {
+		t.Error("不能通过角色授予身份等级")
+	}
+	if err := SetUserRole("admin", "academic office"); err == nil {
+		t.Error("最后一个管理员不能改为其他角色")
+	}
+	if err := SetUserRole("ghost", "head teacher"); err == nil {
+		t.Error("为不存在的用户设置角色应返回错误")
+	}
+
+	ModifyUser("tea", ClassID{}, PrivilegeAdmin)
+	if role := UserRole("tea"); role != "admin" {
+		t.Errorf("改身份后应清除原角色，实际为 %q", role)
+	}
+	if err := SetUserRole("admin", "academic office"); err != nil {
+		t.Errorf("还有其他管理员时，应能为管理员设置角色: %v", err)
+	}
+}
+
+// TestPromoteStudents 检查学年末的升级与毕业，以及预演不修改任何数据。
+func TestPromoteStudents(t *testing.T) {
+	setupAccountTest()
+	// 只保留 1 到 3 年级的 1 班
+	for _, class := range GetClasses(true) {
+		if class.Classid.Grade > 3 || class.Classid.Class > 1 {
+			DeleteClass(class.Classid)
+		}
+	}
+	Register(UserInfo{Uid: "g1", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+	Register(UserInfo{Uid: "g2", Password: "pw", Classid: ClassID{Grade: 2, Class: 1}})
+	Register(UserInfo{Uid: "g3", Password: "pw", Classid: ClassID{Grade: 3, Class: 1}})
+	Register(UserInfo{Uid: "tea", Password: "pw", Privilege: PrivilegeTeacher, Classid: ClassID{Grade: 2, Class: 1}})
+	SetHomeroomTeacher(ClassID{Grade: 1, Class: 1}, "tea")
+	course.AddCourse("Senior Course", "tea", 1, 1)
+	course.LaunchCourse("Senior Course")
+	course.AddCourse("Junior Course", "tea", 1, 1)
+	course.RecordCompletion("g3", "Junior Course", "2024-1")
+	course.SelectCourse("g3", "Senior Course")
+	course.JoinWaitlist("g2", "Senior Course")
+	course.SetCourseEligibility("Senior Course", &course.Rule{Grades: []int{3}})
+
+	report, err := PromoteStudents(3, true)
+	if err != nil {
+		t.Fatalf("预演失败: %v", err)
+	}
+	if len(report.Classes) != 3 || !report.Classes[2].Graduating || report.Classes[0].To != (ClassID{Grade: 2, Class: 1}) ||
+		len(report.Graduates) != 1 || report.Graduates[0] != "g3" {
+		t.Errorf("预演报告不正确: %+v", report)
+	}
+	if len(report.RuleCourses) != 1 || report.RuleCourses[0] != "Senior Course" {
+		t.Errorf("预演应列出选课条件指向升级年级的课程，实际为 %v", report.RuleCourses)
+	}
+	if userInfo, _ := GetUserInfo("g1"); userInfo.Classid.Grade != 1 {
+		t.Error("预演不应修改任何数据")
+	}
+
+	if _, err := PromoteStudents(2, false); err == nil {
+		t.Error("存在高于最高年级的学生时，期望返回错误")
+	}
+	if _, err := PromoteStudents(3, false); err == nil {
+		t.Error("选课条件指向升级的年级时，期望返回错误")
+	}
+	if userInfo, _ := GetUserInfo("g1"); userInfo.Classid.Grade != 1 {
+		t.Error("被拒绝的升级不应修改任何数据")
+	}
+	course.SetCourseEligibility("Senior Course", nil)
+	// 班级集合中没有用户记录的 uid 不应随班级升级
+	classMap, _ := classUserMap.ReadPair(ClassID{Grade: 1, Class: 1})
+	classMap.WritePair("ghost", &struct{}{})
+	if _, err := PromoteStudents(3, false); err != nil {
+		t.Fatalf("升级失败: %v", err)
+	}
+	if classMap, _ := classUserMap.ReadPair(ClassID{Grade: 2, Class: 1}); len(classMap.ReadAll()) != 1 {
+		t.Errorf("没有用户记录的 uid 不应被带入升级后的班级: %v", classMap.ReadAll())
+	}
+	if userInfo, _ := GetUserInfo("g1"); userInfo.Classid != (ClassID{Grade: 2, Class: 1}) {
+		t.Errorf("g1 应升入 2 年级 1 班，实际为 %v", userInfo.Classid)
+	}
+	if users, _ := GetClassUsersInfo(ClassID{Grade: 2, Class: 1}); len(users) != 1 || users[0].Uid != "g1" {
+		t.Errorf("2 年级 1 班应只有 g1: %v", users)
+	}
+	// 班级中的教师随班级一起升级
+	users, _ := GetClassUsersInfo(ClassID{Grade: 3, Class: 1})
+	if len(users) != 2 || users[0].Uid != "g2" || users[1].Uid != "tea" {
+		t.Errorf("3 年级 1 班的成员不正确: %v", users)
+	}
+	if _, err := GetClassUsersInfo(ClassID{Grade: 1, Class: 1}); err == nil {
+		t.Error("升级后 1 年级 1 班应已不存在")
+	}
+	if !isHomeroomTeacher("tea", ClassID{Grade: 2, Class: 1}) || isHomeroomTeacher("tea", ClassID{Grade: 1, Class: 1}) {
+		t.Error("班主任应随班级升级")
+	}
+	graduate, err := GetUserInfo("g3")
+	if err != nil || !graduate.Alumni || graduate.Classid != (ClassID{Grade: 3, Class: 1}) {
+		t.Errorf("g3 应成为校友并保留原班级: %+v, %v", graduate, err)
+	}
+	if _, err := LogIn("g3", "pw"); err == nil {
+		t.Error("已毕业的学生不应能登录")
+	}
+	// 毕业生让出名额，但保留修读记录
+	if users := course.GetCourseUsers("Senior Course"); len(users) != 1 || users[0] != "g2" {
+		t.Errorf("毕业生的名额应交给候补学生，实际名册为 %v", users)
+	}
+	if err := course.RemoveCourse("Junior Course"); err == nil {
+		t.Error("毕业生的修读记录应被保留")
+	}
+	if err := RemoveUser("g3"); err != nil {
+		t.Errorf("删除校友失败: %v", err)
+	}
+}
+
+// TestClasses 检查班级的创建、修改、改名、删除以及注册时的班级校验。
+func TestClasses(t *testing.T) {
+	setupAccountTest()
+	class := ClassID{Grade: 6, Class: 1}
+	if err := Register(UserInfo{Uid: "early", Password: "pw", Classid: class}); err == nil {
+		t.Fatal("注册到不存在的班级时，期望返回错误")
+	}
+	if err := CreateClass(class, " 六年级一班 ", 1); err != nil {
+		t.Fatalf("创建班级失败: %v", err)
+	}
+	if err := CreateClass(class, "", 0); err == nil {
+		t.Error("重复创建班级时，期望返回错误")
+	}
+	if empty := GetClasses(true); !slices.ContainsFunc(empty, func(c ClassSummary) bool { return c.Classid == class }) {
+		t.Error("新建的班级应出现在空班级列表中")
+	}
+	Register(UserInfo{Uid: "first", Password: "pw", Classid: class})
+	if err := Register(UserInfo{Uid: "second", Password: "pw", Classid: class}); err == nil {
+		t.Error("班级已满时，期望注册失败")
+	}
+	if err := ModifyUser("second", class, PrivilegeStudent); err == nil {
+		t.Error("不存在的用户不应能转入班级")
+	}
+	if err := DeleteClass(class); err == nil {
+		t.Error("删除仍有成员的班级时，期望返回错误")
+	}
+
+	Register(UserInfo{Uid: "tea", Password: "pw", Privilege: PrivilegeTeacher})
+	SetHomeroomTeacher(class, "tea")
+	newClass := ClassID{Grade: 6, Class: 2}
+	// 课程资格规则仍指向旧班级时，改名应被拒绝
+	course.AddCourse("Class Course", "tea", 5, 1)
+	course.SetCourseEligibility("Class Course", &course.Rule{Any: []course.Rule{{Grades: []int{5}}, {Classes: []course.ClassRef{course.ClassRef(class)}}}})
+	if err := RenameClass(class, newClass); err == nil {
+		t.Error("班级被课程资格规则引用时，期望改名失败")
+	}
+	course.SetCourseEligibility("Class Course", nil)
+	if err := RenameClass(class, newClass); err != nil {
+		t.Fatalf("班级改名失败: %v", err)
+	}
+	if userInfo, _ := GetUserInfo("first"); userInfo.Classid != newClass {
+		t.Errorf("改名后成员应随班级移动，实际为 %v", userInfo.Classid)
+	}
+	if !isHomeroomTeacher("tea", newClass) {
+		t.Error("改名后班主任应保持不变")
+	}
+	if err := ModifyClass(newClass, "六年级二班", 0); err != nil {
+		t.Fatalf("修改班级失败: %v", err)
+	}
+	summaries := GetClasses(false)
+	index := slices.IndexFunc(summaries, func(c ClassSummary) bool { return c.Classid == newClass })
+	if index < 0 || summaries[index].Name != "六年级二班" || summaries[index].Members != 1 || summaries[index].Homeroom != "tea" {
+		t.Errorf("班级信息不正确: %+v", summaries)
+	}
+
+	ModifyUser("first", staffClass, PrivilegeStudent)
+	if err := DeleteClass(newClass); err != nil {
+		t.Errorf("删除空班级失败: %v", err)
+	}
+	if err := DeleteClass(staffClass); err == nil {
+		t.Error("教职工班级不能删除")
+	}
+}
+
+// TestExportUsers 检查班级名单和课程名单的 CSV 导出。
+func TestExportUsers(t *testing.T) {
+	setupAccountTest()
+	Register(UserInfo{Uid: "stu_b", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+	Register(UserInfo{Uid: "stu_a", Password: "pw", Classid: ClassID{Grade: 1, Class: 1}})
+	course.AddCourse("Export Course", "teacher", 5, 1)
+	course.LaunchCourse("Export Course")
+	course.SelectCourse("stu_b", "Export Course")
+
+	content, err := ExportClass(ClassID{Grade: 1, Class: 1})
+	if err != nil {
+		t.Fatalf("导出班级名单失败: %v", err)
+	}
+	expected := "\ufeffusername,grade,class,role\r\nstu_a,1,1,student\r\nstu_b,1,1,student\r\n"
+	if string(content) != expected {
+		t.Errorf("班级名单不正确，得到 %q，期望 %q", content, expected)
+	}
+	content, err = ExportCourseRoster("Export Course")
+	if err != nil || strings.Contains(string(content), "stu_a") || !strings.Contains(string(content), "stu_b,1,1,student") {
+		t.Errorf("课程名单不正确: %q, %v", content, err)
+	}
+	if _, err := ExportCourseRoster("No Course"); err == nil {
+		t.Error("导出不存在课程的名单时，期望返回错误")
+	}
+	if _, err := ExportClass(ClassID{Grade: 9, Class: 9}); err == nil {
+		t.Error("导出不存在班级的名单时，期望返回错误")
+	}
+}
+
 // TestFullConcurrency 运行一个高强度的并发测试，模拟多种操作（读、写、修改、删除）
 // 同时发生在同一组用户数据上，以暴露潜在的竞态条件和数据不一致问题。
 func TestFullConcurrency(t *testing.T) {
@@ -331,6 +1010,9 @@ func TestFullConcurrency(t *testing.T) {
 	const numGoroutines = 100  // 模拟的并发用户数
 	const opsPerGoroutine = 50 // 每个用户执行的操作次数
 	const userPoolSize = 20    // 操作将集中在这一小部分用户上，以增加冲突概率
+	for class := 0; class < 5; class++ {
+		CreateClass(ClassID{Grade: 100, Class: class}, "", 0)
+	}
 
 	var wg sync.WaitGroup
 
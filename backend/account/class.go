@@ -0,0 +1,210 @@
+package account
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+Classes are managed objects kept in classes.json next to the member sets of classUser.json: an
+admin creates a class before anybody can register into it, and it carries a display name, a
+capacity and its homeroom teacher. The staff class 0-0, where teachers and admins usually sit,
+always exists. Data written before classes were managed is migrated on startup: every class with
+members becomes a class without a name or capacity, taking its teacher from homeroom.json.
+*/
+
+type ClassInfo struct {
+	Classid  ClassID
+	Name     string // for display, e.g. "Grade 1 Class 2"
+	Capacity int    // most members, 0 for no limit
+	Homeroom string // uid of the homeroom teacher, empty for none
+}
+
+type ClassSummary struct {
+	ClassInfo
+	Members int
+}
+
+var staffClass = ClassID{Grade: 0, Class: 0}
+
+func loadClassInfoMap() {
+	if err := classInfoMap.Load(classInfoPath); err != nil {
+		classInfoMap.Clear()
+		for classid := range classUserMap.ReadAll() {
+			classInfoMap.WritePair(classid, &ClassInfo{Classid: classid})
+		}
+		legacyMap := concurrentmap.NewConcurrentMap[ClassID, string]()
+		if _, err := os.Stat(homeroomPath); err == nil && legacyMap.Load(homeroomPath) == nil {
+			for classid, teacher := range legacyMap.ReadAll() {
+				classInfoMap.WritePair(classid, &ClassInfo{Classid: classid, Homeroom: teacher})
+			}
+		}
+		accountLogger.Log(logger.Info, "Migrated %d classes from %s and %s", len(classInfoMap.ReadAll()), classUserPath, homeroomPath)
+	}
+	if _, ok := classInfoMap.ReadPair(staffClass); !ok {
+		classInfoMap.WritePair(staffClass, &ClassInfo{Classid: staffClass, Name: "Staff"})
+	}
+}
+
+// checkClassSeat tells whether one more user fits in classid.
+func checkClassSeat(classid ClassID) error {
+	return checkClassSeats(classid, 1)
+}
+
+// checkClassSeats tells whether seats more users fit in classid.
+func checkClassSeats(classid ClassID, seats int) error {
+	classInfo, ok := classInfoMap.ReadPair(classid)
+	if !ok {
+		return fmt.Errorf("class %v does not exist", classid)
+	}
+	if classInfo.Capacity > 0 && classMembers(classid)+seats > classInfo.Capacity {
+		return fmt.Errorf("class %v is full", classid)
+	}
+	return nil
+}
+
+func classMembers(classid ClassID) int {
+	classMap, ok := classUserMap.ReadPair(classid)
+	if !ok {
+		return 0
+	}
+	return len(classMap.ReadAll())
+}
+
+// dropHomeroom relieves uid of every class it is homeroom teacher of. The caller holds classMutex.
+func dropHomeroom(uid string) {
+	for classid, classInfo := range classInfoMap.ReadAll() {
+		if classInfo.Homeroom == uid {
+			classInfoMap.ModifyPair(classid, func(classInfo *ClassInfo) { classInfo.Homeroom = "" })
+		}
+	}
+}
+
+func CreateClass(classid ClassID, name string, capacity int) error {
+	if classid.Grade < 0 || classid.Class < 0 {
+		accountLogger.Log(logger.Warn, "CreateClass failed: Invalid class %v", classid)
+		return fmt.Errorf("invalid class %v", classid)
+	}
+	if capacity < 0 {
+		accountLogger.Log(logger.Warn, "CreateClass failed: Negative capacity %d", capacity)
+		return fmt.Errorf("capacity cannot be negative")
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	if _, ok := classInfoMap.ReadPair(classid); ok {
+		accountLogger.Log(logger.Warn, "CreateClass failed: Class %v already exists", classid)
+		return fmt.Errorf("class %v already exists", classid)
+	}
+	classInfoMap.WritePair(classid, &ClassInfo{Classid: classid, Name: strings.TrimSpace(name), Capacity: capacity})
+	if _, ok := classUserMap.ReadPair(classid); !ok {
+		classMap := concurrentmap.NewConcurrentMap[string, struct{}]()
+		classUserMap.WritePair(classid, &classMap)
+	}
+	accountLogger.Log(logger.Info, "Class %v created", classid)
+	return nil
+}
+
+// ModifyClass sets the display name and capacity of a class, which cannot drop below its members.
+func ModifyClass(classid ClassID, name string, capacity int) error {
+	if capacity < 0 {
+		accountLogger.Log(logger.Warn, "ModifyClass failed: Negative capacity %d", capacity)
+		return fmt.Errorf("capacity cannot be negative")
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	if _, ok := classInfoMap.ReadPair(classid); !ok {
+		accountLogger.Log(logger.Warn, "ModifyClass failed: Class %v does not exist", classid)
+		return fmt.Errorf("class %v does not exist", classid)
+	}
+	if members := classMembers(classid); capacity > 0 && capacity < members {
+		accountLogger.Log(logger.Warn, "ModifyClass failed: Class %v has %d members", classid, members)
+		return fmt.Errorf("class %v has %d members, more than the capacity %d", classid, members, capacity)
+	}
+	classInfoMap.ModifyPair(classid, func(classInfo *ClassInfo) {
+		classInfo.Name = strings.TrimSpace(name)
+		classInfo.Capacity = capacity
+	})
+	accountLogger.Log(logger.Info, "Class %v modified", classid)
+	return nil
+}
+
+// RenameClass moves a class and its members to another grade and class number. A class named by
+// a course's eligibility keeps its number until the rule is changed.
+func RenameClass(oldClassid ClassID, newClassid ClassID) error {
+	if oldClassid == staffClass || newClassid == staffClass {
+		accountLogger.Log(logger.Warn, "RenameClass failed: The staff class cannot be renamed")
+		return fmt.Errorf("the staff class %v cannot be renamed", staffClass)
+	}
+	if newClassid.Grade < 0 || newClassid.Class < 0 {
+		accountLogger.Log(logger.Warn, "RenameClass failed: Invalid class %v", newClassid)
+		return fmt.Errorf("invalid class %v", newClassid)
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	classInfo, ok := classInfoMap.ReadPair(oldClassid)
+	if !ok {
+		accountLogger.Log(logger.Warn, "RenameClass failed: Class %v does not exist", oldClassid)
+		return fmt.Errorf("class %v does not exist", oldClassid)
+	}
+	if _, exist := classInfoMap.ReadPair(newClassid); exist {
+		accountLogger.Log(logger.Warn, "RenameClass failed: Class %v already exists", newClassid)
+		return fmt.Errorf("class %v already exists", newClassid)
+	}
+	if courses := course.CoursesNamingClass(course.ClassRef(oldClassid)); len(courses) > 0 {
+		accountLogger.Log(logger.Warn, "RenameClass failed: Class %v is named by the eligibility of %s", oldClassid, strings.Join(courses, ", "))
+		return fmt.Errorf("class %v is named by the eligibility of %s, change it first", oldClassid, strings.Join(courses, ", "))
+	}
+	classInfo.Classid = newClassid
+	classInfoMap.WritePair(newClassid, &classInfo)
+	classInfoMap.DeletePair(oldClassid)
+	if classMap, ok := classUserMap.ReadPair(oldClassid); ok {
+		for uid := range classMap.ReadAll() {
+			userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) { userInfo.Classid = newClassid })
+		}
+		classUserMap.WritePair(newClassid, &classMap)
+		classUserMap.DeletePair(oldClassid)
+	}
+	accountLogger.Log(logger.Info, "Class %v renamed to %v", oldClassid, newClassid)
+	return nil
+}
+
+// DeleteClass removes a class nobody is in any more.
+func DeleteClass(classid ClassID) error {
+	if classid == staffClass {
+		accountLogger.Log(logger.Warn, "DeleteClass failed: The staff class cannot be deleted")
+		return fmt.Errorf("the staff class %v cannot be deleted", staffClass)
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	if _, ok := classInfoMap.ReadPair(classid); !ok {
+		accountLogger.Log(logger.Warn, "DeleteClass failed: Class %v does not exist", classid)
+		return fmt.Errorf("class %v does not exist", classid)
+	}
+	if members := classMembers(classid); members > 0 {
+		accountLogger.Log(logger.Warn, "DeleteClass failed: Class %v has %d members", classid, members)
+		return fmt.Errorf("class %v still has %d members", classid, members)
+	}
+	classInfoMap.DeletePair(classid)
+	classUserMap.DeletePair(classid)
+	accountLogger.Log(logger.Info, "Class %v deleted", classid)
+	return nil
+}
+
+// GetClasses lists the classes by grade and class number, only those without members if emptyOnly.
+func GetClasses(emptyOnly bool) []ClassSummary {
+	result := make([]ClassSummary, 0)
+	for classid, classInfo := range classInfoMap.ReadAll() {
+		members := classMembers(classid)
+		if emptyOnly && members > 0 {
+			continue
+		}
+		result = append(result, ClassSummary{ClassInfo: classInfo, Members: members})
+	}
+	sort.Slice(result, func(i, j int) bool { return classBefore(result[i].Classid, result[j].Classid) })
+	return result
+}
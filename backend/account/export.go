@@ -0,0 +1,42 @@
+package account
+
+import (
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/spreadsheet"
+	"strconv"
+)
+
+// ExportClass writes the users of a class as a CSV for spreadsheets, sorted by uid.
+func ExportClass(classid ClassID) ([]byte, error) {
+	users, err := GetClassUsersInfo(classid)
+	if err != nil {
+		return nil, err
+	}
+	return exportUsers(users), nil
+}
+
+// ExportCourseRoster writes the students enrolled in a course as a CSV for spreadsheets, sorted by
+// uid. A course that is not launched has an empty roster.
+func ExportCourseRoster(courseName string) ([]byte, error) {
+	if _, err := course.GetCourseInfo(courseName); err != nil {
+		return nil, err
+	}
+	users, err := GetCourseUsersInfo(courseName)
+	if err != nil {
+		return nil, err
+	}
+	return exportUsers(users), nil
+}
+
+func exportUsers(users []*UserInfo) []byte {
+	rows := [][]string{{"username", "grade", "class", "role"}}
+	for _, userInfo := range users {
+		rows = append(rows, []string{
+			userInfo.Uid,
+			strconv.Itoa(userInfo.Classid.Grade),
+			strconv.Itoa(userInfo.Classid.Class),
+			PrivilegeToString(userInfo.Privilege),
+		})
+	}
+	return spreadsheet.EncodeCSV(rows)
+}
@@ -0,0 +1,189 @@
+package account
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+ImportUsers registers many accounts from CSV rows of username, initial password, grade, class and
+role, an optional header row first. Every row is checked before anything is written, against the
+naming rule of the README, against the accounts already there and against the free seats of each
+class, counting the rows accepted before it. In all-or-nothing mode a single bad row stops the
+whole import, and accounts it registered before a late failure are removed again; in best-effort
+mode the good rows go in and the bad ones are only reported.
+*/
+
+type ImportMode string
+
+const (
+	ImportAllOrNothing ImportMode = "all-or-nothing"
+	ImportBestEffort   ImportMode = "best-effort"
+)
+
+// Names and passwords are [a-zA-Z0-9_]* in at most 10 characters, as the README requires.
+var credentialPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,10}$`)
+
+var importHeader = []string{"username", "password", "grade", "class", "role"}
+
+type ImportRow struct {
+	Line     int // in the CSV, from 1
+	Uid      string
+	Imported bool
+	Error    string
+}
+
+type ImportReport struct {
+	Mode     ImportMode
+	Imported int
+	Rows     []ImportRow
+}
+
+// ImportUsers reads the CSV and registers its users. The report is returned whenever the CSV could
+// be read, together with an error when an all-or-nothing import was abandoned.
+func ImportUsers(reader io.Reader, mode ImportMode) (*ImportReport, error) {
+	if mode != ImportAllOrNothing && mode != ImportBestEffort {
+		accountLogger.Log(logger.Warn, "ImportUsers failed: Unknown mode %q", mode)
+		return nil, fmt.Errorf("unknown import mode %q", mode)
+	}
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		accountLogger.Log(logger.Warn, "ImportUsers failed: Invalid CSV: %v", err)
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+
+	// Spreadsheets often save CSV with a UTF-8 byte order mark.
+	if len(records) > 0 && len(records[0]) > 0 {
+		records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	}
+
+	report := &ImportReport{Mode: mode, Rows: []ImportRow{}}
+	users := make([]UserInfo, 0, len(records))
+	seen := make(map[string]int)      // uid -> line
+	accepted := make(map[ClassID]int) // class -> valid rows so far
+	failed := 0
+	for i, record := range records {
+		if i == 0 && len(record) > 0 && strings.EqualFold(record[0], importHeader[0]) {
+			continue
+		}
+		row := ImportRow{Line: i + 1}
+		userInfo, err := parseImportRecord(record)
+		row.Uid = userInfo.Uid
+		if err == nil {
+			if line, ok := seen[userInfo.Uid]; ok {
+				err = fmt.Errorf("user %s is repeated from line %d", userInfo.Uid, line)
+			} else if _, exist := userInfoMap.ReadPair(userInfo.Uid); exist {
+				err = fmt.Errorf("user %s already exists", userInfo.Uid)
+			} else {
+				err = checkClassSeats(userInfo.Classid, accepted[userInfo.Classid]+1)
+			}
+		}
+		if err != nil {
+			row.Error = err.Error()
+			failed++
+		} else {
+			seen[userInfo.Uid] = row.Line
+			accepted[userInfo.Classid]++
+		}
+		users = append(users, userInfo)
+		report.Rows = append(report.Rows, row)
+	}
+	if mode == ImportAllOrNothing && failed > 0 {
+		markSkipped(report)
+		accountLogger.Log(logger.Warn, "ImportUsers failed: %d of %d rows are invalid, nothing imported", failed, len(report.Rows))
+		return report, fmt.Errorf("%d of %d rows are invalid, nothing imported", failed, len(report.Rows))
+	}
+
+	created := make([]string, len(report.Rows)) // password record of each imported row
+	for i := range report.Rows {
+		row := &report.Rows[i]
+		if row.Error != "" {
+			continue
+		}
+		// A registration of the same name since the checks above makes this one fail.
+		record, err := register(users[i])
+		if err != nil {
+			row.Error = err.Error()
+			if mode == ImportAllOrNothing {
+				for j := range report.Rows[:i] {
+					if report.Rows[j].Imported {
+						removeImported(report.Rows[j].Uid, created[j])
+						report.Rows[j].Imported = false
+					}
+				}
+				report.Imported = 0
+				markSkipped(report)
+				accountLogger.Log(logger.Warn, "ImportUsers failed: Line %d: %v, nothing imported", row.Line, err)
+				return report, fmt.Errorf("line %d: %v, nothing imported", row.Line, err)
+			}
+			continue
+		}
+		created[i] = record
+		row.Imported = true
+		report.Imported++
+	}
+	accountLogger.Log(logger.Info, "Imported %d of %d users in %s mode", report.Imported, len(report.Rows), mode)
+	return report, nil
+}
+
+// removeImported rolls back an imported user, unless the record under its name is no longer the one
+// the import wrote, as when the user was removed and registered again by someone else meanwhile.
+func removeImported(uid string, record string) {
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	if userInfo, ok := userInfoMap.ReadPair(uid); !ok || userInfo.Password != record {
+		accountLogger.Log(logger.Warn, "ImportUsers rollback: User %s changed meanwhile, kept", uid)
+		return
+	}
+	removeUser(uid)
+}
+
+// markSkipped explains the valid rows of an abandoned all-or-nothing import.
+func markSkipped(report *ImportReport) {
+	for i := range report.Rows {
+		if report.Rows[i].Error == "" {
+			report.Rows[i].Error = "skipped because other rows failed"
+		}
+	}
+}
+
+// parseImportRecord checks one CSV row, returning whatever it could read even on error.
+func parseImportRecord(record []string) (UserInfo, error) {
+	var userInfo UserInfo
+	if len(record) > 0 {
+		userInfo.Uid = strings.TrimSpace(record[0])
+	}
+	if len(record) != len(importHeader) {
+		return userInfo, fmt.Errorf("expected %d fields (%s), got %d", len(importHeader), strings.Join(importHeader, ", "), len(record))
+	}
+	userInfo.Password = strings.TrimSpace(record[1])
+	if !credentialPattern.MatchString(userInfo.Uid) {
+		return userInfo, fmt.Errorf("username %q must be 1 to 10 of a-z, A-Z, 0-9 and _", userInfo.Uid)
+	}
+	if !credentialPattern.MatchString(userInfo.Password) {
+		return userInfo, fmt.Errorf("password must be 1 to 10 of a-z, A-Z, 0-9 and _")
+	}
+	grade, err := strconv.Atoi(strings.TrimSpace(record[2]))
+	if err != nil || grade < 0 {
+		return userInfo, fmt.Errorf("grade %q is not a non-negative number", record[2])
+	}
+	class, err := strconv.Atoi(strings.TrimSpace(record[3]))
+	if err != nil || class < 0 {
+		return userInfo, fmt.Errorf("class %q is not a non-negative number", record[3])
+	}
+	userInfo.Classid = ClassID{Grade: grade, Class: class}
+	role := strings.ToLower(strings.TrimSpace(record[4]))
+	userInfo.Privilege = StringToPrivilege(role)
+	if PrivilegeToString(userInfo.Privilege) != role {
+		return userInfo, fmt.Errorf("role %q is not one of student, teacher and admin", record[4])
+	}
+	return userInfo, nil
+}
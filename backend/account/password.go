@@ -0,0 +1,99 @@
+package account
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+Passwords are stored as "pbkdf2-sha256$v1$<iterations>$<salt>$<key>", salt and key in raw
+base64. Records without the prefix are legacy plaintext ones, which LogIn upgrades once the
+user proves to know them.
+*/
+
+const (
+	temporaryAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	temporaryLength   = 10
+)
+
+const (
+	hashScheme  = "pbkdf2-sha256"
+	hashVersion = "v1"
+	saltLength  = 16
+	keyLength   = 32
+)
+
+// hashIterations is a variable so that tests can trade strength for speed.
+var hashIterations = 210000
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %v", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, keyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	encoding := base64.RawStdEncoding
+	return strings.Join([]string{hashScheme, hashVersion, strconv.Itoa(hashIterations), encoding.EncodeToString(salt), encoding.EncodeToString(key)}, "$"), nil
+}
+
+func isHashedPassword(stored string) bool {
+	return strings.HasPrefix(stored, hashScheme+"$")
+}
+
+// verifyPassword reports whether password matches the stored record, and whether the record
+// should be rehashed because it is plaintext or weaker than the current parameters.
+func verifyPassword(stored string, password string) (bool, bool) {
+	if !isHashedPassword(stored) {
+		// An empty record is never a legacy password, only a broken one.
+		match := stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match
+	}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 5 || parts[1] != hashVersion {
+		return false, false
+	}
+	iterations, err := strconv.Atoi(parts[2])
+	if err != nil || iterations <= 0 {
+		return false, false
+	}
+	encoding := base64.RawStdEncoding
+	salt, err := encoding.DecodeString(parts[3])
+	if err != nil {
+		return false, false
+	}
+	expected, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false, false
+	}
+	match := subtle.ConstantTimeCompare(key, expected) == 1
+	return match, match && iterations < hashIterations
+}
+
+// generateTemporaryPassword returns a random password obeying the [a-zA-Z0-9_] naming rule,
+// leaving out characters that are easily confused when read aloud.
+func generateTemporaryPassword() (string, error) {
+	result := make([]byte, temporaryLength)
+	alphabetSize := big.NewInt(int64(len(temporaryAlphabet)))
+	for i := range result {
+		index, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate temporary password: %v", err)
+		}
+		result[i] = temporaryAlphabet[index.Int64()]
+	}
+	return string(result), nil
+}
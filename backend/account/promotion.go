@@ -0,0 +1,161 @@
+package account
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"sort"
+	"strings"
+)
+
+/*
+PromoteStudents runs the summer change of school year. Every class of grades 1 to topGrade-1
+moves up a grade into the same class number, with its name, capacity, homeroom teacher and
+members; the classes of topGrade graduate and are deleted. Their students become alumni: they stay
+in userInfo.json with their last class and completions, but belong to no class, can no longer log
+in and give up their seats, waitlist places, intents and preferences to the students who stay,
+while a teacher or admin placed in a graduating class returns to the staff class.
+The staff grade 0 is never touched. Eligibility rules naming a grade or class that moves would
+silently admit other students afterwards, so as RenameClass does, a promotion is refused until
+they are changed; a dry run lists them.
+*/
+
+type ClassMove struct {
+	From       ClassID
+	To         ClassID // equal to From for a graduating class
+	Students   int
+	Graduating bool
+}
+
+type PromotionReport struct {
+	TopGrade  int
+	DryRun    bool
+	Classes   []ClassMove // by From
+	Graduates []string    // sorted
+	// Courses whose eligibility names a grade or class that moves, by name. A promotion needs none.
+	RuleCourses []string
+}
+
+// PromoteStudents moves every class a grade up and graduates topGrade. A dry run only reports
+// what would happen.
+func PromoteStudents(topGrade int, dryRun bool) (*PromotionReport, error) {
+	if topGrade < 1 {
+		accountLogger.Log(logger.Warn, "Promotion failed: Top grade %d is not positive", topGrade)
+		return nil, fmt.Errorf("top grade must be at least 1")
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+
+	report := &PromotionReport{TopGrade: topGrade, DryRun: dryRun, Classes: []ClassMove{}, Graduates: []string{}}
+	moves := make(map[ClassID]ClassMove)
+	for classid := range classInfoMap.ReadAll() {
+		if classid.Grade == 0 {
+			continue
+		}
+		if classid.Grade > topGrade {
+			accountLogger.Log(logger.Warn, "Promotion failed: Class %v is above the top grade %d", classid, topGrade)
+			return nil, fmt.Errorf("class %v is above the top grade %d", classid, topGrade)
+		}
+		move := ClassMove{From: classid, To: ClassID{Grade: classid.Grade + 1, Class: classid.Class}}
+		if classid.Grade == topGrade {
+			move.To, move.Graduating = classid, true
+		}
+		for _, uid := range classStudents(classid) {
+			move.Students++
+			if move.Graduating {
+				report.Graduates = append(report.Graduates, uid)
+			}
+		}
+		moves[classid] = move
+		report.Classes = append(report.Classes, move)
+	}
+	sort.Slice(report.Classes, func(i, j int) bool { return classBefore(report.Classes[i].From, report.Classes[j].From) })
+	sort.Strings(report.Graduates)
+	report.RuleCourses = course.CoursesNamingGrades(1, topGrade)
+	if dryRun {
+		return report, nil
+	}
+	if len(report.RuleCourses) > 0 {
+		accountLogger.Log(logger.Warn, "Promotion failed: Moving grades are named by the eligibility of %s", strings.Join(report.RuleCourses, ", "))
+		return nil, fmt.Errorf("moving grades are named by the eligibility of %s, change it first", strings.Join(report.RuleCourses, ", "))
+	}
+
+	classInfos := make(map[ClassID]ClassInfo)
+	classSets := make(map[ClassID]*concurrentmap.ConcurrentMap[string, struct{}])
+	for classid, classMap := range classUserMap.ReadAll() {
+		if _, ok := moves[classid]; !ok {
+			classSets[classid] = classMap
+		}
+	}
+	if _, ok := classSets[staffClass]; !ok {
+		classSets[staffClass] = concurrentmap.NewConcurrentMap[string, struct{}]()
+	}
+	for classid, classInfo := range classInfoMap.ReadAll() {
+		move, ok := moves[classid]
+		if !ok {
+			classInfos[classid] = classInfo
+			continue
+		}
+		classMap, ok := classUserMap.ReadPair(classid)
+		if !ok {
+			classMap = concurrentmap.NewConcurrentMap[string, struct{}]()
+		}
+		if !move.Graduating {
+			classInfo.Classid = move.To
+			classInfos[move.To] = classInfo
+			classSets[move.To] = classMap
+		}
+		for uid := range classMap.ReadAll() {
+			toStaff := false
+			if !userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) {
+				switch {
+				case !move.Graduating:
+					userInfo.Classid = move.To
+				case userInfo.Privilege == PrivilegeStudent:
+					userInfo.Alumni = true
+				default:
+					userInfo.Classid = staffClass
+					toStaff = true
+				}
+			}) {
+				accountLogger.Log(logger.Error, "Inconsistent state: User %s in class %v does not exist, dropped", uid, classid)
+				classMap.DeletePair(uid)
+				continue
+			}
+			if toStaff {
+				classSets[staffClass].WritePair(uid, &struct{}{})
+			}
+		}
+	}
+	classInfoMap.Clear()
+	for classid, classInfo := range classInfos {
+		classInfoMap.WritePair(classid, &classInfo)
+	}
+	classUserMap.Clear()
+	for classid, classMap := range classSets {
+		classUserMap.WritePair(classid, &classMap)
+	}
+	for _, uid := range report.Graduates {
+		privilege.RevokeUserSessions(uid)
+		course.ReleaseUser(uid)
+	}
+	accountLogger.Log(logger.Info, "Promoted %d classes, %d students graduated from grade %d", len(moves), len(report.Graduates), topGrade)
+	return report, nil
+}
+
+// classStudents lists the students in classid.
+func classStudents(classid ClassID) []string {
+	result := make([]string, 0)
+	classMap, ok := classUserMap.ReadPair(classid)
+	if !ok {
+		return result
+	}
+	for uid := range classMap.ReadAll() {
+		if userInfo, ok := userInfoMap.ReadPair(uid); ok && userInfo.Privilege == PrivilegeStudent {
+			result = append(result, uid)
+		}
+	}
+	return result
+}
@@ -0,0 +1,67 @@
+package account
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"regexp"
+)
+
+/*
+A role names what the permission policy grants a user. Most users have none of their own and act
+with the name of their privilege level; SetUserRole gives one a role of the school's own, such as
+"head teacher" or "academic office", whose capabilities come from the policy file alone.
+*/
+
+var roleRegex = regexp.MustCompile(`^[a-z][a-z0-9 _-]{0,31}$`)
+
+// UserRole returns the role uid is authorized as, its own or else the name of its privilege.
+func UserRole(uid string) string {
+	userInfo, ok := userInfoMap.ReadPair(uid)
+	if !ok {
+		return ""
+	}
+	return userInfo.role()
+}
+
+func (userInfo *UserInfo) role() string {
+	if userInfo.Role != "" {
+		return userInfo.Role
+	}
+	return PrivilegeToString(userInfo.Privilege)
+}
+
+// SetUserRole gives uid the role, or its privilege's again when role is empty. Sessions are
+// revoked since they carry the old role.
+func SetUserRole(uid string, role string) error {
+	if role != "" && !roleRegex.MatchString(role) {
+		accountLogger.Log(logger.Warn, "SetUserRole failed: Invalid role %q", role)
+		return fmt.Errorf("role %q must be 1 to 32 lowercase letters, digits, spaces, '_' or '-', starting with a letter", role)
+	}
+	if role == "student" || role == "teacher" || role == "admin" {
+		accountLogger.Log(logger.Warn, "SetUserRole failed: Role %s is a privilege level", role)
+		return fmt.Errorf("role %s is a privilege level, change it with ModifyUser", role)
+	}
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	userInfo, ok := userInfoMap.ReadPair(uid)
+	if !ok {
+		accountLogger.Log(logger.Warn, "SetUserRole failed: User %s does not exist", uid)
+		return fmt.Errorf("user %s does not exist", uid)
+	}
+	if userInfo.Alumni {
+		accountLogger.Log(logger.Warn, "SetUserRole failed: User %s has graduated", uid)
+		return fmt.Errorf("user %s has graduated", uid)
+	}
+	if userInfo.Role == role {
+		return nil
+	}
+	if userInfo.role() == "admin" && countAdmins() == 1 {
+		accountLogger.Log(logger.Warn, "SetUserRole failed: User %s is the last admin", uid)
+		return fmt.Errorf("user %s is the last admin", uid)
+	}
+	userInfoMap.ModifyPair(uid, func(userInfo *UserInfo) { userInfo.Role = role })
+	privilege.RevokeUserSessions(uid)
+	accountLogger.Log(logger.Info, "User %s role changed: %q -> %q", uid, userInfo.Role, role)
+	return nil
+}
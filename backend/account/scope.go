@@ -0,0 +1,79 @@
+package account
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+)
+
+/*
+Teachers only see the students in their charge: those of the classes they are homeroom teacher
+of and those of the courses they teach. Callers holding a wider capability skip these checks.
+*/
+
+// SetHomeroomTeacher puts teacher uid in charge of classid, replacing the previous one.
+func SetHomeroomTeacher(classid ClassID, uid string) error {
+	classMutex.Lock()
+	defer classMutex.Unlock()
+	userInfo, ok := userInfoMap.ReadPair(uid)
+	if !ok {
+		accountLogger.Log(logger.Warn, "SetHomeroomTeacher failed: User %s does not exist", uid)
+		return fmt.Errorf("user %s does not exist", uid)
+	}
+	if userInfo.Privilege != PrivilegeTeacher {
+		accountLogger.Log(logger.Warn, "SetHomeroomTeacher failed: User %s is not a teacher", uid)
+		return fmt.Errorf("user %s is not a teacher", uid)
+	}
+	if !classInfoMap.ModifyPair(classid, func(classInfo *ClassInfo) { classInfo.Homeroom = uid }) {
+		accountLogger.Log(logger.Warn, "SetHomeroomTeacher failed: Class %v does not exist", classid)
+		return fmt.Errorf("class %v does not exist", classid)
+	}
+	accountLogger.Log(logger.Info, "User %s is now homeroom teacher of class %v", uid, classid)
+	return nil
+}
+
+func isHomeroomTeacher(uid string, classid ClassID) bool {
+	classInfo, ok := classInfoMap.ReadPair(classid)
+	return ok && classInfo.Homeroom == uid
+}
+
+func isCourseTeacher(uid string, courseName string) bool {
+	courseInfo, err := course.GetCourseInfo(courseName)
+	return err == nil && courseInfo.Teacher == uid
+}
+
+// CheckClassAccess returns a forbidden error unless viewer is the homeroom teacher of classid.
+func CheckClassAccess(viewer string, classid ClassID) error {
+	if isHomeroomTeacher(viewer, classid) {
+		return nil
+	}
+	accountLogger.Log(logger.Warn, "Access forbidden: User %s is not in charge of class %v", viewer, classid)
+	return fmt.Errorf("forbidden: user %s is not in charge of class %v", viewer, classid)
+}
+
+// CheckCourseAccess returns a forbidden error unless viewer teaches courseName.
+func CheckCourseAccess(viewer string, courseName string) error {
+	if isCourseTeacher(viewer, courseName) {
+		return nil
+	}
+	accountLogger.Log(logger.Warn, "Access forbidden: User %s does not teach course %s", viewer, courseName)
+	return fmt.Errorf("forbidden: user %s does not teach course %s", viewer, courseName)
+}
+
+// CheckUserAccess returns a forbidden error unless uid is viewer itself, in a class viewer is
+// homeroom teacher of, or in a course viewer teaches.
+func CheckUserAccess(viewer string, uid string) error {
+	if viewer == uid {
+		return nil
+	}
+	if userInfo, ok := userInfoMap.ReadPair(uid); ok && isHomeroomTeacher(viewer, userInfo.Classid) {
+		return nil
+	}
+	for _, courseName := range course.GetUserCourses(uid) {
+		if isCourseTeacher(viewer, courseName) {
+			return nil
+		}
+	}
+	accountLogger.Log(logger.Warn, "Access forbidden: User %s is not in charge of user %s", viewer, uid)
+	return fmt.Errorf("forbidden: user %s is not in charge of user %s", viewer, uid)
+}
@@ -0,0 +1,135 @@
+package account
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+SearchUsers finds accounts without handing the whole school to the caller: it filters by uid,
+privilege and class range, sorts by a total order and returns a page at a time. As in
+course.SearchCourses, a page ends with a cursor naming the last user returned, so accounts
+registered or removed between two requests never make a page repeat or skip another. In the class
+sort, though, a user moved to another class meanwhile, by ModifyUser, RenameClass or
+PromoteStudents, may cross the cursor and show on two pages or on none.
+*/
+
+type UserSortKey string
+
+const (
+	SortByUid   UserSortKey = "uid"   // A to Z
+	SortByClass UserSortKey = "class" // by grade, then class, then uid
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type UserQuery struct {
+	Prefix     string   // the uid starts with it
+	Contains   string   // the uid contains it, case-insensitive
+	Privileges []int    // empty for any
+	FromClass  *ClassID // lowest class included, nil for no bound
+	ToClass    *ClassID // highest class included, nil for no bound
+	Sort       UserSortKey
+	Cursor     string // NextCursor of the previous page, empty for the first
+	Limit      int    // 0 for defaultPageSize, at most maxPageSize
+}
+
+type UserPage struct {
+	Users      []UserInfo
+	Total      int    // users matching the query on every page
+	NextCursor string // empty on the last page
+}
+
+// userCursor marks where a page ended.
+type userCursor struct {
+	Sort  UserSortKey `json:"s"`
+	Class ClassID     `json:"c"`
+	Uid   string      `json:"u"`
+}
+
+func classBefore(classid ClassID, other ClassID) bool {
+	if classid.Grade != other.Grade {
+		return classid.Grade < other.Grade
+	}
+	return classid.Class < other.Class
+}
+
+func SearchUsers(query UserQuery) (*UserPage, error) {
+	if query.Sort == "" {
+		query.Sort = SortByUid
+	}
+	if query.Sort != SortByUid && query.Sort != SortByClass {
+		accountLogger.Log(logger.Warn, "SearchUsers failed: Unknown sort key %q", query.Sort)
+		return nil, fmt.Errorf("unknown sort key %q", query.Sort)
+	}
+	if query.Limit < 0 || query.Limit > maxPageSize {
+		accountLogger.Log(logger.Warn, "SearchUsers failed: Page size %d out of range", query.Limit)
+		return nil, fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	var after *userCursor
+	if query.Cursor != "" {
+		after = &userCursor{}
+		content, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err == nil {
+			err = json.Unmarshal(content, after)
+		}
+		if err != nil || after.Sort != query.Sort {
+			accountLogger.Log(logger.Warn, "SearchUsers failed: Invalid cursor %q", query.Cursor)
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+	contains := strings.ToLower(query.Contains)
+
+	matches := make([]UserInfo, 0)
+	for uid, userInfo := range userInfoMap.ReadAll() {
+		if !strings.HasPrefix(uid, query.Prefix) || !strings.Contains(strings.ToLower(uid), contains) {
+			continue
+		}
+		if len(query.Privileges) > 0 && !slices.Contains(query.Privileges, userInfo.Privilege) {
+			continue
+		}
+		if query.FromClass != nil && classBefore(userInfo.Classid, *query.FromClass) {
+			continue
+		}
+		if query.ToClass != nil && classBefore(*query.ToClass, userInfo.Classid) {
+			continue
+		}
+		matches = append(matches, userInfo)
+	}
+	before := func(classid ClassID, uid string, other ClassID, otherUid string) bool {
+		if query.Sort == SortByClass && classid != other {
+			return classBefore(classid, other)
+		}
+		return uid < otherUid
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return before(matches[i].Classid, matches[i].Uid, matches[j].Classid, matches[j].Uid)
+	})
+
+	page := &UserPage{Users: []UserInfo{}, Total: len(matches)}
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			return before(after.Class, after.Uid, matches[i].Classid, matches[i].Uid)
+		})
+	}
+	end := min(start+query.Limit, len(matches))
+	page.Users = append(page.Users, matches[start:end]...)
+	if end < len(matches) {
+		last := matches[end-1]
+		content, _ := json.Marshal(userCursor{Sort: query.Sort, Class: last.Classid, Uid: last.Uid})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(content)
+	}
+	return page, nil
+}
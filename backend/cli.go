@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/TOmorrowarc1/ClassSelectionSystem/account"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
+)
+
+/*
+Administrative commands run instead of the server when the program gets arguments, working on the
+same data files, so the server must be stopped first:
+
+	backend import-users [-mode all-or-nothing|best-effort] users.csv
+*/
+
+// runCommand runs the command in args and returns the exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "import-users":
+		return runImportUsers(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected import-users\n", args[0])
+		return 2
+	}
+}
+
+func runImportUsers(args []string) int {
+	flags := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	mode := flags.String("mode", string(account.ImportAllOrNothing), "all-or-nothing or best-effort")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-users [-mode all-or-nothing|best-effort] users.csv")
+		return 2
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	// Removing users on a rollback revokes their sessions, so the privilege system is needed too.
+	course.InitCourseSystem()
+	account.InitAccountSystem()
+	privilege.SetSessionStore(privilege.NewFileSessionStore(sessionsPath))
+	privilege.InitPrivilegeSystem()
+	defer privilege.StopPrivilegeSystem()
+	report, err := account.ImportUsers(file, account.ImportMode(*mode))
+	if report != nil {
+		for _, row := range report.Rows {
+			if row.Imported {
+				fmt.Printf("line %d: %s imported\n", row.Line, row.Uid)
+			} else {
+				fmt.Printf("line %d: %s failed: %s\n", row.Line, row.Uid, row.Error)
+			}
+		}
+		fmt.Printf("%d of %d users imported\n", report.Imported, len(report.Rows))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	account.StoreAccountData()
+	return 0
+}
@@ -1,9 +1,13 @@
 package course
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"os"
+	"slices"
+	"sort"
 	"sync"
 )
 
@@ -13,35 +17,76 @@ type CourseInfo struct {
 	MaxStudents int
 	NowStudents int
 	Launched    bool
+	Credits     int
+	Slots       []TimeSlot
+	Eligibility *Rule // nil for everyone
+	Archived    bool  // retired, kept for history only
+	CourseDetails
+}
+
+// SelectionLimit caps what one student may hold at the same time. Zero means unlimited.
+type SelectionLimit struct {
+	MaxCourses int
+	MaxCredits int
 }
 
 var (
 	courseInfoMap *concurrentmap.ConcurrentMap[string, CourseInfo]
 	launchedMap   *concurrentmap.ConcurrentMap[string, struct{}]
 	courseUserMap *concurrentmap.ConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]
-	userCourseMap *concurrentmap.ConcurrentMap[string, string]
+	userCourseMap *concurrentmap.ConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]
+	waitlistMap   *concurrentmap.ConcurrentMap[string, []string] // course -> uids in the order they joined
+	roundMap      *concurrentmap.ConcurrentMap[string, Round]
+	intentMap     *concurrentmap.ConcurrentMap[string, map[string][]string] // round -> course -> applicants, guarded by courseMutex
+	preferenceMap *concurrentmap.ConcurrentMap[string, map[string][]string] // round -> uid -> ranked courses, guarded by courseMutex
+	noticeMap     *concurrentmap.ConcurrentMap[string, []Notice]            // uid -> notices, guarded by courseMutex
 	courseLogger  *logger.Logger
 	// For only one concurrent operation holds(or rely on the consistency of) data outside the map: SelectCourse() and DropCourse().
-	courseMutex sync.Mutex
+	courseMutex    sync.Mutex
+	selectionLimit SelectionLimit // guarded by courseMutex
 )
 
 const (
-	courseInfoPath  = "data/course_Info.json"
-	launchedMapPath = "data/launched_courses.json"
-	courseUserPath  = "data/course_user.json"
-	userCoursePath  = "data/user_course.json"
+	courseInfoPath     = "data/course_Info.json"
+	launchedMapPath    = "data/launched_courses.json"
+	courseUserPath     = "data/course_user.json"
+	userCoursePath     = "data/user_course.json"
+	selectionLimitPath = "data/selection_limit.json"
+	waitlistPath       = "data/waitlist.json"
+	completedPath      = "data/completed_courses.json"
+	currentTermPath    = "data/current_term.json"
+	roundPath          = "data/rounds.json"
+	intentPath         = "data/intents.json"
+	preferencePath     = "data/preferences.json"
+	noticePath         = "data/notifications.json"
 )
 
 func InitCourseSystem() {
 	courseInfoMap = concurrentmap.NewConcurrentMap[string, CourseInfo]()
 	launchedMap = concurrentmap.NewConcurrentMap[string, struct{}]()
 	courseUserMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]()
-	userCourseMap = concurrentmap.NewConcurrentMap[string, string]()
+	userCourseMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]()
+	waitlistMap = concurrentmap.NewConcurrentMap[string, []string]()
+	completedMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, string]]()
+	roundMap = concurrentmap.NewConcurrentMap[string, Round]()
+	intentMap = concurrentmap.NewConcurrentMap[string, map[string][]string]()
+	preferenceMap = concurrentmap.NewConcurrentMap[string, map[string][]string]()
+	noticeMap = concurrentmap.NewConcurrentMap[string, []Notice]()
 	courseLogger = logger.GetLogger()
+	selectionLimit = SelectionLimit{}
+	currentTerm = ""
 	courseInfoMap.Load(courseInfoPath)
 	launchedMap.Load(launchedMapPath)
 	courseUserMap.Load(courseUserPath)
-	userCourseMap.Load(userCoursePath)
+	loadUserCourseMap()
+	loadJsonFile(selectionLimitPath, &selectionLimit)
+	waitlistMap.Load(waitlistPath)
+	completedMap.Load(completedPath)
+	roundMap.Load(roundPath)
+	intentMap.Load(intentPath)
+	preferenceMap.Load(preferencePath)
+	noticeMap.Load(noticePath)
+	loadJsonFile(currentTermPath, &currentTerm)
 	// Check for consistency
 	// 1. All launched courses must exist in courseInfoMap
 	all_launched_course := launchedMap.ReadAll()
@@ -51,27 +96,127 @@ func InitCourseSystem() {
 			launchedMap.DeletePair(courseName)
 		}
 	}
-	// 2. All courses in courseUserMap must exist in launchedMap.
-	all_selected_course := courseUserMap.ReadAll()
-	for courseName := range all_selected_course {
+	// The Launched flags follow launchedMap, which older versions never copied them from.
+	// Details edited by hand are cleaned up as SetCourseDetails would, an unknown category dropped.
+	for courseName, courseInfo := range courseInfoMap.ReadAll() {
+		if _, launched := launchedMap.ReadPair(courseName); launched != courseInfo.Launched {
+			courseInfo.Launched = launched
+		}
+		if err := courseInfo.CourseDetails.Validate(); err != nil {
+			courseLogger.Log(logger.Error, "Inconsistent state: Course %s has %v, clearing it", courseName, err)
+			courseInfo.Category = CategoryNone
+		}
+		courseInfo.CourseDetails.normalize()
+		courseInfoMap.WritePair(courseName, &courseInfo)
+	}
+	// 2. All courses in courseUserMap must exist in launchedMap, and every launched course needs one.
+	for courseName := range courseUserMap.ReadAll() {
 		if _, ok := launchedMap.ReadPair(courseName); !ok {
 			courseLogger.Log(logger.Error, "Inconsistent state: Course %s in courseUserMap does not exist in launchedMap, removing", courseName)
 			courseUserMap.DeletePair(courseName)
 		}
 	}
+	for courseName := range launchedMap.ReadAll() {
+		if _, ok := courseUserMap.ReadPair(courseName); !ok {
+			temp_map := concurrentmap.NewConcurrentMap[string, struct{}]()
+			courseUserMap.WritePair(courseName, &temp_map)
+		}
+	}
 	// 3. The Information in courseUserMap and userCourseMap must be reflective, and I use the courseUserMap as the standard.
-	for courseName, user_map := range all_selected_course {
-		for uid := range user_map.ReadAll() {
-			if cid, ok := userCourseMap.ReadPair(uid); !ok || cid != courseName {
-				courseLogger.Log(logger.Error, "Inconsistent state: User %s in courseUserMap[%s] but not in userCourseMap or inconsistent, removing", uid, courseName)
-				userCourseMap.DeletePair(uid)
-				userCourseMap.WritePair(uid, &courseName)
+	// The seat counts follow the rosters as well.
+	userCourseMap.Clear()
+	for courseName, user_map := range courseUserMap.ReadAll() {
+		users := user_map.ReadAll()
+		for uid := range users {
+			addUserCourse(uid, courseName)
+		}
+		if courseInfo, ok := courseInfoMap.ReadPair(courseName); ok && courseInfo.NowStudents != len(users) {
+			courseLogger.Log(logger.Error, "Inconsistent state: Course %s counts %d students but has %d, fixing", courseName, courseInfo.NowStudents, len(users))
+			courseInfo.NowStudents = len(users)
+			courseInfoMap.WritePair(courseName, &courseInfo)
+		}
+	}
+	// 4. Waitlists only belong to launched courses and never hold their own students.
+	for courseName, waitlist := range waitlistMap.ReadAll() {
+		user_map, ok := courseUserMap.ReadPair(courseName)
+		if !ok {
+			courseLogger.Log(logger.Error, "Inconsistent state: Waitlist of course %s which is not launched, removing", courseName)
+			waitlistMap.DeletePair(courseName)
+			continue
+		}
+		for _, uid := range waitlist {
+			if _, enrolled := user_map.ReadPair(uid); enrolled {
+				courseLogger.Log(logger.Error, "Inconsistent state: User %s waits for course %s already selected, removing", uid, courseName)
+				removeFromWaitlist(uid, courseName)
 			}
 		}
 	}
 }
 
+// loadUserCourseMap loads the uid -> courses map, migrating the format from before multi-course
+// enrollment, where every uid mapped to a single course name, into the rosters.
+func loadUserCourseMap() {
+	if err := userCourseMap.Load(userCoursePath); err == nil {
+		return
+	}
+	userCourseMap.Clear()
+	legacyMap := concurrentmap.NewConcurrentMap[string, string]()
+	if err := legacyMap.Load(userCoursePath); err != nil {
+		return
+	}
+	for uid, courseName := range legacyMap.ReadAll() {
+		user_map, ok := courseUserMap.ReadPair(courseName)
+		if !ok {
+			user_map = concurrentmap.NewConcurrentMap[string, struct{}]()
+			courseUserMap.WritePair(courseName, &user_map)
+		}
+		user_map.WritePair(uid, &struct{}{})
+	}
+	courseLogger.Log(logger.Info, "Migrated %d single-course selections from %s", len(legacyMap.ReadAll()), userCoursePath)
+}
+
+func loadJsonFile(fileName string, value any) error {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, value)
+}
+
+func storeJsonFile(fileName string, value any) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, content, 0644)
+}
+
+// addUserCourse records courseName in the selections of uid, without touching the roster.
+func addUserCourse(uid string, courseName string) {
+	course_map, ok := userCourseMap.ReadPair(uid)
+	if !ok {
+		course_map = concurrentmap.NewConcurrentMap[string, struct{}]()
+		userCourseMap.WritePair(uid, &course_map)
+	}
+	course_map.WritePair(courseName, &struct{}{})
+}
+
+// removeUserCourse is the reverse of addUserCourse, forgetting uid once it holds nothing.
+func removeUserCourse(uid string, courseName string) {
+	course_map, ok := userCourseMap.ReadPair(uid)
+	if !ok {
+		return
+	}
+	course_map.DeletePair(courseName)
+	if len(course_map.ReadAll()) == 0 {
+		userCourseMap.DeletePair(uid)
+	}
+}
+
+// StoreCourseData writes every map under courseMutex, since some are changed in place under it.
 func StoreCourseData() {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
 	err := courseInfoMap.Store(courseInfoPath)
 	if err != nil {
 		courseLogger.Log(logger.Error, "Failed to store course Info: %v", err)
@@ -88,48 +233,269 @@ func StoreCourseData() {
 	if err != nil {
 		courseLogger.Log(logger.Error, "Failed to store user course map: %v", err)
 	}
+	err = waitlistMap.Store(waitlistPath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store waitlist map: %v", err)
+	}
+	err = completedMap.Store(completedPath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store completed courses: %v", err)
+	}
+	err = roundMap.Store(roundPath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store rounds: %v", err)
+	}
+	err = intentMap.Store(intentPath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store intents: %v", err)
+	}
+	err = preferenceMap.Store(preferencePath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store preferences: %v", err)
+	}
+	err = noticeMap.Store(noticePath)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store notifications: %v", err)
+	}
+	err = storeJsonFile(selectionLimitPath, &selectionLimit)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store selection limit: %v", err)
+	}
+	err = storeJsonFile(currentTermPath, &currentTerm)
+	if err != nil {
+		courseLogger.Log(logger.Error, "Failed to store current term: %v", err)
+	}
 	courseLogger.Log(logger.Info, "Course data stored successfully")
 }
 
-func AddCourse(CourseName string, teacher string, MaxStudents int) error {
+func AddCourse(CourseName string, teacher string, MaxStudents int, credits int, slots ...TimeSlot) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	return addCourse(CourseName, teacher, MaxStudents, credits, CourseDetails{}, slots)
+}
+
+// AddCourseWithDetails applies AddCourse and SetCourseDetails as a single change, so a refused
+// course is not left behind without its details.
+func AddCourseWithDetails(CourseName string, teacher string, MaxStudents int, credits int, details CourseDetails, slots ...TimeSlot) error {
+	if err := details.Validate(); err != nil {
+		courseLogger.Log(logger.Warn, "Addition failed: Course %s has %v", CourseName, err)
+		return fmt.Errorf("course %s has %v", CourseName, err)
+	}
+	details.normalize()
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	return addCourse(CourseName, teacher, MaxStudents, credits, details, slots)
+}
+
+// addCourse checks everything before writing. The caller holds courseMutex.
+func addCourse(CourseName string, teacher string, MaxStudents int, credits int, details CourseDetails, slots []TimeSlot) error {
 	if _, ok := courseInfoMap.ReadPair(CourseName); ok {
 		courseLogger.Log(logger.Warn, "Addition failed: Course %s already exists", CourseName)
 		return fmt.Errorf("course %s already exists", CourseName)
 	}
+	if err := validateSlots(slots); err != nil {
+		courseLogger.Log(logger.Warn, "Addition failed: Course %s has %v", CourseName, err)
+		return fmt.Errorf("course %s has %v", CourseName, err)
+	}
 	new_course := CourseInfo{
-		CourseName:  CourseName,
-		Teacher:     teacher,
-		MaxStudents: MaxStudents,
-		NowStudents: 0,
-		Launched:    false,
+		CourseName:    CourseName,
+		Teacher:       teacher,
+		MaxStudents:   MaxStudents,
+		NowStudents:   0,
+		Launched:      false,
+		Credits:       credits,
+		Slots:         slots,
+		CourseDetails: details,
 	}
 	courseInfoMap.WritePair(CourseName, &new_course)
 	return nil
 }
 
-func ModifyCourse(courseName string, teacher string, MaxStudents int) error {
-	if _, exist := launchedMap.ReadPair(courseName); exist {
-		courseLogger.Log(logger.Warn, "Modification failed: Course %s is already launched", courseName)
-		return fmt.Errorf("course %s is already launched", courseName)
-	}
+// ModifyCourse replaces the settings of a course. Once it is launched only the teacher and the
+// seats may change, never below the students already in; credits and slots are what students
+// chose the course by.
+func ModifyCourse(courseName string, teacher string, MaxStudents int, credits int, slots ...TimeSlot) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	return modifyCourse(courseName, teacher, MaxStudents, credits, slots)
+}
+
+// modifyCourse checks everything before writing. The caller holds courseMutex.
+func modifyCourse(courseName string, teacher string, MaxStudents int, credits int, slots []TimeSlot) error {
 	course_Info, ok := courseInfoMap.ReadPair(courseName)
 	if !ok {
 		courseLogger.Log(logger.Warn, "Modification failed: Course %s does not exist", courseName)
 		return fmt.Errorf("course %s does not exist", courseName)
 	}
+	if course_Info.Archived {
+		courseLogger.Log(logger.Warn, "Modification failed: Course %s is archived", courseName)
+		return fmt.Errorf("course %s is archived", courseName)
+	}
+	if err := validateSlots(slots); err != nil {
+		courseLogger.Log(logger.Warn, "Modification failed: Course %s has %v", courseName, err)
+		return fmt.Errorf("course %s has %v", courseName, err)
+	}
+	_, launched := launchedMap.ReadPair(courseName)
+	if launched {
+		if credits != course_Info.Credits {
+			courseLogger.Log(logger.Warn, "Modification failed: Credits of launched course %s cannot change", courseName)
+			return fmt.Errorf("credits of launched course %s cannot change", courseName)
+		}
+		if !slices.Equal(slots, course_Info.Slots) {
+			courseLogger.Log(logger.Warn, "Modification failed: Slots of launched course %s cannot change", courseName)
+			return fmt.Errorf("slots of launched course %s cannot change", courseName)
+		}
+		if MaxStudents < course_Info.NowStudents {
+			courseLogger.Log(logger.Warn, "Modification failed: Course %s already has %d students", courseName, course_Info.NowStudents)
+			return fmt.Errorf("course %s already has %d students", courseName, course_Info.NowStudents)
+		}
+	}
 	course_Info.CourseName = courseName
 	course_Info.Teacher = teacher
 	course_Info.MaxStudents = MaxStudents
+	course_Info.Credits = credits
+	course_Info.Slots = slots
 	courseInfoMap.WritePair(courseName, &course_Info)
+	if launched {
+		promoteWaitlist(courseName)
+	}
+	return nil
+}
+
+// RenameCourse moves a course and everything naming it, rosters, waitlist, rounds, intents,
+// preferences, completions and the prerequisites of other courses, to newName at once.
+func RenameCourse(courseName string, newName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if err := checkRename(courseName, newName); err != nil {
+		return err
+	}
+	renameCourse(courseName, newName)
+	return nil
+}
+
+// EditCourse applies ModifyCourse, SetCourseDetails and, unless newName is empty or the same,
+// RenameCourse as a single change: all of it is checked before anything is written, so a refused
+// edit leaves the course as it was.
+func EditCourse(courseName string, newName string, teacher string, MaxStudents int, credits int, details CourseDetails, slots ...TimeSlot) error {
+	if err := details.Validate(); err != nil {
+		courseLogger.Log(logger.Warn, "Modification failed: Course %s has %v", courseName, err)
+		return fmt.Errorf("course %s has %v", courseName, err)
+	}
+	details.normalize()
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	rename := newName != "" && newName != courseName
+	if rename {
+		if err := checkRename(courseName, newName); err != nil {
+			return err
+		}
+	}
+	// modifyCourse refuses archived courses, so the details below cannot fail anymore.
+	if err := modifyCourse(courseName, teacher, MaxStudents, credits, slots); err != nil {
+		return err
+	}
+	courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) { courseInfo.CourseDetails = details })
+	if rename {
+		renameCourse(courseName, newName)
+	}
 	return nil
 }
 
+func checkRename(courseName string, newName string) error {
+	if _, ok := courseInfoMap.ReadPair(courseName); !ok {
+		courseLogger.Log(logger.Warn, "Rename failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	if newName == "" {
+		courseLogger.Log(logger.Warn, "Rename failed: Empty name for course %s", courseName)
+		return fmt.Errorf("course name cannot be empty")
+	}
+	if _, exist := courseInfoMap.ReadPair(newName); exist {
+		courseLogger.Log(logger.Warn, "Rename failed: Course %s already exists", newName)
+		return fmt.Errorf("course %s already exists", newName)
+	}
+	return nil
+}
+
+// renameCourse does the moves of RenameCourse once checkRename passed. The caller holds courseMutex.
+func renameCourse(courseName string, newName string) {
+	courseInfo, _ := courseInfoMap.ReadPair(courseName)
+	courseInfo.CourseName = newName
+	courseInfoMap.WritePair(newName, &courseInfo)
+	courseInfoMap.DeletePair(courseName)
+	for otherName, otherInfo := range courseInfoMap.ReadAll() {
+		if otherInfo.Eligibility == nil {
+			continue
+		}
+		if rule, renamed := otherInfo.Eligibility.renameCourse(courseName, newName); renamed {
+			courseInfoMap.ModifyPair(otherName, func(info *CourseInfo) { info.Eligibility = &rule })
+		}
+	}
+	if _, launched := launchedMap.ReadPair(courseName); launched {
+		launchedMap.WritePair(newName, &struct{}{})
+		launchedMap.DeletePair(courseName)
+	}
+	if user_map, ok := courseUserMap.ReadPair(courseName); ok {
+		for uid := range user_map.ReadAll() {
+			removeUserCourse(uid, courseName)
+			addUserCourse(uid, newName)
+		}
+		courseUserMap.WritePair(newName, &user_map)
+		courseUserMap.DeletePair(courseName)
+	}
+	if waitlist, ok := waitlistMap.ReadPair(courseName); ok {
+		waitlistMap.WritePair(newName, &waitlist)
+		waitlistMap.DeletePair(courseName)
+	}
+	for _, course_map := range completedMap.ReadAll() {
+		if term, ok := course_map.ReadPair(courseName); ok {
+			course_map.WritePair(newName, &term)
+			course_map.DeletePair(courseName)
+		}
+	}
+	for roundName, round := range roundMap.ReadAll() {
+		if index := slices.Index(round.Courses, courseName); index >= 0 {
+			roundMap.ModifyPair(roundName, func(round *Round) {
+				round.Courses = slices.Clone(round.Courses)
+				round.Courses[index] = newName
+			})
+		}
+	}
+	for roundName, intents := range intentMap.ReadAll() {
+		if applicants, ok := intents[courseName]; ok {
+			intentMap.ModifyPair(roundName, func(intents *map[string][]string) {
+				delete(*intents, courseName)
+				(*intents)[newName] = applicants
+			})
+		}
+	}
+	for roundName, preferences := range preferenceMap.ReadAll() {
+		for uid, courseNames := range preferences {
+			if index := slices.Index(courseNames, courseName); index >= 0 {
+				preferenceMap.ModifyPair(roundName, func(preferences *map[string][]string) {
+					renamed := slices.Clone(courseNames)
+					renamed[index] = newName
+					(*preferences)[uid] = renamed
+				})
+			}
+		}
+	}
+	courseLogger.Log(logger.Info, "Course %s renamed to %s", courseName, newName)
+}
+
 func LaunchCourse(courseName string) error {
-	_, ok := courseInfoMap.ReadPair(courseName)
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	courseInfo, ok := courseInfoMap.ReadPair(courseName)
 	if !ok {
 		courseLogger.Log(logger.Warn, "Launch failed: Course %s does not exist", courseName)
 		return fmt.Errorf("course %s does not exist", courseName)
 	}
+	if courseInfo.Archived {
+		courseLogger.Log(logger.Warn, "Launch failed: Course %s is archived", courseName)
+		return fmt.Errorf("course %s is archived", courseName)
+	}
 	if _, exist := launchedMap.ReadPair(courseName); exist {
 		courseLogger.Log(logger.Warn, "Launch failed: Course %s is already launched", courseName)
 		return fmt.Errorf("course %s is already launched", courseName)
@@ -137,63 +503,201 @@ func LaunchCourse(courseName string) error {
 	launchedMap.WritePair(courseName, &struct{}{})
 	temp_map := concurrentmap.NewConcurrentMap[string, struct{}]()
 	courseUserMap.WritePair(courseName, &temp_map)
+	courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) { courseInfo.Launched = true })
 	courseLogger.Log(logger.Info, "Course %s launched successfully", courseName)
 	return nil
 }
 
+// SetSelectionLimit changes the caps for later selections; what students already hold is kept.
+func SetSelectionLimit(limit SelectionLimit) error {
+	if limit.MaxCourses < 0 || limit.MaxCredits < 0 {
+		courseLogger.Log(logger.Warn, "SetSelectionLimit failed: Negative limit %+v", limit)
+		return fmt.Errorf("selection limit cannot be negative")
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	selectionLimit = limit
+	courseLogger.Log(logger.Info, "Selection limit set to %d courses and %d credits", limit.MaxCourses, limit.MaxCredits)
+	return nil
+}
+
+func GetSelectionLimit() SelectionLimit {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	return selectionLimit
+}
+
 func SelectCourse(uid string, courseName string) error {
 	courseMutex.Lock()
 	defer courseMutex.Unlock()
-	if _, ok := userCourseMap.ReadPair(uid); ok {
-		courseLogger.Log(logger.Warn, "Selection failed: User %s has already selected a course", uid)
-		return fmt.Errorf("user %s has already selected a course", uid)
-	}
 	if _, exist := launchedMap.ReadPair(courseName); !exist {
 		courseLogger.Log(logger.Warn, "Selection failed: Course %s is not launched", courseName)
 		return fmt.Errorf("course %s is not launched", courseName)
 	}
+	if err := checkRound(uid, courseName, false); err != nil {
+		courseLogger.Log(logger.Warn, "Selection failed: %v", err)
+		return err
+	}
+	held := make(map[string]struct{})
+	if course_map, ok := userCourseMap.ReadPair(uid); ok {
+		held = course_map.ReadAll()
+	}
+	if _, ok := held[courseName]; ok {
+		courseLogger.Log(logger.Warn, "Selection failed: User %s has already selected course %s", uid, courseName)
+		return fmt.Errorf("user %s has already selected course %s", uid, courseName)
+	}
 	courseInfo, _ := courseInfoMap.ReadPair(courseName)
 	if courseInfo.NowStudents >= courseInfo.MaxStudents {
 		courseLogger.Log(logger.Warn, "Selection failed: Course %s is full", courseName)
 		return fmt.Errorf("course %s is full", courseName)
 	}
-	user_map, _ := courseUserMap.ReadPair(courseName)
-	user_map.WritePair(uid, &struct{}{})
-	userCourseMap.WritePair(uid, &courseName)
-	courseInfo.NowStudents++
-	courseInfoMap.WritePair(courseName, &courseInfo)
+	if err := checkSelection(uid, held, &courseInfo); err != nil {
+		courseLogger.Log(logger.Warn, "Selection failed: %v", err)
+		return err
+	}
+	enrollUser(uid, &courseInfo)
 	courseLogger.Log(logger.Info, "User %s selected course %s successfully", uid, courseName)
 	return nil
 }
 
-func DropCourse(uid string) error {
+// checkSelection tells whether uid, holding held, may also take courseInfo: eligible, within the
+// selection limit and without a schedule conflict. The caller holds courseMutex.
+func checkSelection(uid string, held map[string]struct{}, courseInfo *CourseInfo) error {
+	if err := checkEligibility(uid, courseInfo); err != nil {
+		return err
+	}
+	if selectionLimit.MaxCourses > 0 && len(held)+1 > selectionLimit.MaxCourses {
+		return fmt.Errorf("user %s cannot select more than %d courses", uid, selectionLimit.MaxCourses)
+	}
+	if selectionLimit.MaxCredits > 0 {
+		credits := courseInfo.Credits
+		for heldCourse := range held {
+			heldInfo, _ := courseInfoMap.ReadPair(heldCourse)
+			credits += heldInfo.Credits
+		}
+		if credits > selectionLimit.MaxCredits {
+			return fmt.Errorf("user %s cannot hold more than %d credits", uid, selectionLimit.MaxCredits)
+		}
+	}
+	return checkScheduleConflict(held, courseInfo)
+}
+
+// enrollUser takes a seat of courseInfo for uid and leaves its waitlist. The caller holds courseMutex.
+func enrollUser(uid string, courseInfo *CourseInfo) {
+	user_map, _ := courseUserMap.ReadPair(courseInfo.CourseName)
+	user_map.WritePair(uid, &struct{}{})
+	addUserCourse(uid, courseInfo.CourseName)
+	removeFromWaitlist(uid, courseInfo.CourseName)
+	courseInfo.NowStudents++
+	courseInfoMap.WritePair(courseInfo.CourseName, courseInfo)
+}
+
+func DropCourse(uid string, courseName string) error {
 	courseMutex.Lock()
 	defer courseMutex.Unlock()
-	courseName, ok := userCourseMap.ReadPair(uid)
+	course_map, ok := userCourseMap.ReadPair(uid)
 	if !ok {
 		courseLogger.Log(logger.Warn, "Drop failed: User %s has not selected any course", uid)
 		return fmt.Errorf("user %s has not selected any course", uid)
 	}
+	if _, ok := course_map.ReadPair(courseName); !ok {
+		courseLogger.Log(logger.Warn, "Drop failed: User %s has not selected course %s", uid, courseName)
+		return fmt.Errorf("user %s has not selected course %s", uid, courseName)
+	}
+	if err := checkRound(uid, courseName, true); err != nil {
+		courseLogger.Log(logger.Warn, "Drop failed: %v", err)
+		return err
+	}
 	userMap, ok := courseUserMap.ReadPair(courseName)
 	if !ok {
 		courseLogger.Log(logger.Error, "Inconsistent state: Course %s for user %s does not exist in courseUserMap", courseName, uid)
 		return fmt.Errorf("inconsistent state: course %s for user %s does not exist in courseUserMap", courseName, uid)
 	}
 	userMap.DeletePair(uid)
-	userCourseMap.DeletePair(uid)
+	removeUserCourse(uid, courseName)
 	courseInfo, _ := courseInfoMap.ReadPair(courseName)
 	courseInfo.NowStudents--
 	courseInfoMap.WritePair(courseName, &courseInfo)
 	courseLogger.Log(logger.Info, "User %s dropped course %s successfully", uid, courseName)
+	promoteWaitlist(courseName)
 	return nil
 }
 
+// ForgetUser erases uid from the course system when its account is removed: its seats, freed for
+// the waitlists, its waitlist places, intents, preferences, completions and notices.
+func ForgetUser(uid string) {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	dropped := releaseUser(uid)
+	completedMap.DeletePair(uid)
+	noticeMap.DeletePair(uid)
+	courseLogger.Log(logger.Info, "User %s forgotten, %d enrollments dropped", uid, len(dropped))
+}
+
+// ReleaseUser frees everything uid holds in the course system, as for a graduate, and returns the
+// courses it was enrolled in. Completions and notices are kept.
+func ReleaseUser(uid string) []string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	dropped := releaseUser(uid)
+	courseLogger.Log(logger.Info, "User %s released, %d enrollments dropped", uid, len(dropped))
+	return dropped
+}
+
+// releaseUser drops every seat, waitlist place, intent and preference of uid, then fills the freed
+// seats from the waitlists, and returns the courses uid was enrolled in. The caller holds courseMutex.
+func releaseUser(uid string) []string {
+	dropped := make([]string, 0)
+	if course_map, ok := userCourseMap.ReadPair(uid); ok {
+		for courseName := range course_map.ReadAll() {
+			dropped = append(dropped, courseName)
+		}
+	}
+	sort.Strings(dropped)
+	for _, courseName := range dropped {
+		if user_map, ok := courseUserMap.ReadPair(courseName); ok {
+			user_map.DeletePair(uid)
+		}
+		removeUserCourse(uid, courseName)
+		courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) { courseInfo.NowStudents-- })
+	}
+	for courseName := range waitlistMap.ReadAll() {
+		removeFromWaitlist(uid, courseName)
+	}
+	for roundName, intents := range intentMap.ReadAll() {
+		for courseName, applicants := range intents {
+			index := slices.Index(applicants, uid)
+			if index < 0 {
+				continue
+			}
+			intentMap.ModifyPair(roundName, func(intents *map[string][]string) {
+				if rest := slices.Delete(slices.Clone(applicants), index, index+1); len(rest) > 0 {
+					(*intents)[courseName] = rest
+				} else {
+					delete(*intents, courseName)
+				}
+			})
+		}
+	}
+	for roundName, preferences := range preferenceMap.ReadAll() {
+		if _, ok := preferences[uid]; ok {
+			preferenceMap.ModifyPair(roundName, func(preferences *map[string][]string) { delete(*preferences, uid) })
+		}
+	}
+	for _, courseName := range dropped {
+		promoteWaitlist(courseName)
+	}
+	return dropped
+}
+
+// GetAllCoursesInfo lists every course sorted by name; SearchCourses filters and pages them.
 func GetAllCoursesInfo() []*CourseInfo {
 	resultMap := courseInfoMap.ReadAll()
 	result := make([]*CourseInfo, 0, len(resultMap))
 	for _, courseInfo := range resultMap {
 		result = append(result, &courseInfo)
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CourseName < result[j].CourseName })
 	return result
 }
 
@@ -210,3 +714,27 @@ func GetCourseUsers(courseName string) []string {
 	}
 	return result
 }
+
+func GetCourseInfo(courseName string) (*CourseInfo, error) {
+	courseInfo, ok := courseInfoMap.ReadPair(courseName)
+	if !ok {
+		courseLogger.Log(logger.Warn, "GetCourseInfo failed: Course %s does not exist", courseName)
+		return nil, fmt.Errorf("course %s does not exist", courseName)
+	}
+	return &courseInfo, nil
+}
+
+// GetUserCourses lists the courses uid has selected, sorted by name.
+func GetUserCourses(uid string) []string {
+	course_map, ok := userCourseMap.ReadPair(uid)
+	if !ok {
+		return nil
+	}
+	courseNames := course_map.ReadAll()
+	result := make([]string, 0, len(courseNames))
+	for courseName := range courseNames {
+		result = append(result, courseName)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -1,16 +1,28 @@
 package course
 
 import (
+	"encoding/csv"
 	"fmt"
 	"os"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
 )
 
+// TestMain 只设置一次日志文件，使子测试和并发测试中的 setupCourseTest 不再重新打开它。
+func TestMain(m *testing.M) {
+	courseLogger = logger.GetLogger()
+	os.Remove("course_test.log") // 删除旧的日志文件
+	courseLogger.SetLogFile("course_test.log")
+	os.Exit(m.Run())
+}
+
 // setupCourseTest 是一个辅助函数，用于在每个测试之前初始化或重置系统状态。
 // 它在内存中创建所有需要的数据结构，避免了对文件系统的依赖。
 func setupCourseTest() {
@@ -19,10 +31,15 @@ func setupCourseTest() {
 	// 建议在未来将其更正为 "Launched"。
 	launchedMap = concurrentmap.NewConcurrentMap[string, struct{}]()
 	courseUserMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]()
-	userCourseMap = concurrentmap.NewConcurrentMap[string, string]()
-	courseLogger = logger.GetLogger()
-	os.Remove("course_test.log") // 删除旧的日志文件
-	courseLogger.SetLogFile("course_test.log")
+	userCourseMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]()
+	waitlistMap = concurrentmap.NewConcurrentMap[string, []string]()
+	completedMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, string]]()
+	roundMap = concurrentmap.NewConcurrentMap[string, Round]()
+	intentMap = concurrentmap.NewConcurrentMap[string, map[string][]string]()
+	preferenceMap = concurrentmap.NewConcurrentMap[string, map[string][]string]()
+	noticeMap = concurrentmap.NewConcurrentMap[string, []Notice]()
+	selectionLimit = SelectionLimit{}
+	currentTerm = ""
 }
 
 // TestAddAndModifyCourse 测试课程的创建和修改功能。
@@ -32,7 +49,7 @@ func TestAddAndModifyCourse(t *testing.T) {
 	teacher := "Prof. Gopher"
 
 	t.Run("SuccessfulAdd", func(t *testing.T) {
-		err := AddCourse(courseName, teacher, 30)
+		err := AddCourse(courseName, teacher, 30, 1)
 		if err != nil {
 			t.Fatalf("添加新课程失败: %v", err)
 		}
@@ -46,7 +63,7 @@ func TestAddAndModifyCourse(t *testing.T) {
 	})
 
 	t.Run("AddExistingCourse", func(t *testing.T) {
-		err := AddCourse(courseName, teacher, 30)
+		err := AddCourse(courseName, teacher, 30, 1)
 		if err == nil {
 			t.Error("添加已存在的课程时，期望得到一个错误，但实际为 nil")
 		}
@@ -54,7 +71,7 @@ func TestAddAndModifyCourse(t *testing.T) {
 
 	t.Run("SuccessfulModifyUnlaunched", func(t *testing.T) {
 		newTeacher := "Dr. Gemini"
-		err := ModifyCourse(courseName, newTeacher, 40)
+		err := ModifyCourse(courseName, newTeacher, 40, 1)
 		if err != nil {
 			t.Fatalf("修改未发布的课程失败: %v", err)
 		}
@@ -65,7 +82,7 @@ func TestAddAndModifyCourse(t *testing.T) {
 	})
 
 	t.Run("ModifyNonExistent", func(t *testing.T) {
-		err := ModifyCourse("NonExistentCourse", "Some Teacher", 20)
+		err := ModifyCourse("NonExistentCourse", "Some Teacher", 20, 1)
 		if err == nil {
 			t.Error("修改不存在的课程时，期望得到一个错误，但实际为 nil")
 		}
@@ -76,7 +93,7 @@ func TestAddAndModifyCourse(t *testing.T) {
 func TestLaunchCourse(t *testing.T) {
 	setupCourseTest()
 	courseName := "Advanced Go"
-	AddCourse(courseName, "Prof. Gopher", 25)
+	AddCourse(courseName, "Prof. Gopher", 25, 1)
 
 	t.Run("SuccessfulLaunch", func(t *testing.T) {
 		err := LaunchCourse(courseName)
@@ -92,10 +109,19 @@ func TestLaunchCourse(t *testing.T) {
 	})
 
 	t.Run("ModifyLaunchedCourse", func(t *testing.T) {
-		// 此时课程已发布
-		err := ModifyCourse(courseName, "New Teacher", 30)
-		if err == nil {
-			t.Error("修改已发布的课程时，期望得到一个错误，但实际为 nil")
+		// 此时课程已发布，只允许修改教师和名额
+		if err := ModifyCourse(courseName, "New Teacher", 30, 1); err != nil {
+			t.Fatalf("修改已发布课程的教师和名额失败: %v", err)
+		}
+		if info, _ := courseInfoMap.ReadPair(courseName); info.Teacher != "New Teacher" || info.MaxStudents != 30 {
+			t.Errorf("修改后，课程信息未正确更新: %+v", info)
+		}
+		if err := ModifyCourse(courseName, "New Teacher", 30, 2); err == nil {
+			t.Error("修改已发布课程的学分时，期望得到一个错误，但实际为 nil")
+		}
+		SelectCourse("s1", courseName)
+		if err := ModifyCourse(courseName, "New Teacher", 0, 1); err == nil {
+			t.Error("将名额降到已选人数以下时，期望得到一个错误，但实际为 nil")
 		}
 	})
 
@@ -114,6 +140,136 @@ func TestLaunchCourse(t *testing.T) {
 	})
 }
 
+// TestRenameCourse 测试课程改名会同步更新所有引用该课程的数据。
+func TestRenameCourse(t *testing.T) {
+	setupCourseTest()
+	AddCourse("Go 101", "t1", 10, 1)
+	AddCourse("Go 201", "t1", 10, 1)
+	LaunchCourse("Go 101")
+	SelectCourse("s1", "Go 101")
+	RecordCompletion("s2", "Go 101", "2023-1")
+	SetCourseEligibility("Go 201", &Rule{Any: []Rule{{Completed: "Go 101"}, {Grades: []int{3}}}})
+
+	if err := RenameCourse("Go 101", "Go 201"); err == nil {
+		t.Error("改为已存在的课程名时，期望得到一个错误，但实际为 nil")
+	}
+	if err := RenameCourse("Go 101", "Intro to Go"); err != nil {
+		t.Fatalf("课程改名失败: %v", err)
+	}
+	if _, err := GetCourseInfo("Go 101"); err == nil {
+		t.Error("改名后仍能找到旧课程名")
+	}
+	if info, err := GetCourseInfo("Intro to Go"); err != nil || info.CourseName != "Intro to Go" || !info.Launched {
+		t.Errorf("改名后的课程信息不正确: %+v, %v", info, err)
+	}
+	if courses := GetUserCourses("s1"); !slices.Equal(courses, []string{"Intro to Go"}) {
+		t.Errorf("期望 s1 的课程为 [Intro to Go]，实际为 %v", courses)
+	}
+	if users := GetCourseUsers("Intro to Go"); !slices.Equal(users, []string{"s1"}) {
+		t.Errorf("期望新课程名册为 [s1]，实际为 %v", users)
+	}
+	if err := CheckEligibility("s2", "Go 201"); err != nil {
+		t.Errorf("先修课改名后，修读记录应仍然有效: %v", err)
+	}
+	if info, _ := GetCourseInfo("Go 201"); !strings.Contains(info.Eligibility.Describe(), "Intro to Go") {
+		t.Errorf("选课条件应指向新课程名，实际为 %s", info.Eligibility.Describe())
+	}
+}
+
+// TestEditCourse 检查一次编辑中任何一项被拒绝时，课程保持原样。
+func TestEditCourse(t *testing.T) {
+	setupCourseTest()
+	AddCourse("Go 101", "t1", 10, 1)
+	AddCourse("Go 201", "t1", 10, 1)
+	details := CourseDetails{Description: "Basics", Category: CategoryScience}
+
+	if err := EditCourse("Go 101", "Go 201", "t2", 20, 2, details); err == nil {
+		t.Error("改为已存在的课程名时，期望得到一个错误，但实际为 nil")
+	}
+	if info, _ := GetCourseInfo("Go 101"); info.Teacher != "t1" || info.MaxStudents != 10 || info.Description != "" {
+		t.Errorf("编辑被拒绝后，课程不应有任何改动: %+v", info)
+	}
+	if err := EditCourse("Go 101", "Go 102", "t2", 20, 2, CourseDetails{Category: "cooking"}); err == nil {
+		t.Error("非法的课程类别应返回错误")
+	}
+	if err := EditCourse("Go 101", "Go 102", "t2", 20, 2, details); err != nil {
+		t.Fatalf("编辑课程失败: %v", err)
+	}
+	if info, err := GetCourseInfo("Go 102"); err != nil || info.Teacher != "t2" || info.MaxStudents != 20 || info.Description != "Basics" {
+		t.Errorf("编辑后的课程信息不正确: %+v, %v", info, err)
+	}
+}
+
+// TestWithdrawCourse 测试课程的下线、归档和删除。
+func TestWithdrawCourse(t *testing.T) {
+	t.Run("UnlaunchCascades", func(t *testing.T) {
+		setupCourseTest()
+		AddCourse("Busy", "t1", 1, 1)
+		LaunchCourse("Busy")
+		SelectCourse("s1", "Busy")
+		JoinWaitlist("s2", "Busy")
+		if _, err := UnlaunchCourse("Busy", false); err == nil {
+			t.Error("课程仍有学生时下线，期望得到一个错误，但实际为 nil")
+		}
+		dropped, err := UnlaunchCourse("Busy", true)
+		if err != nil {
+			t.Fatalf("级联下线课程失败: %v", err)
+		}
+		if !slices.Equal(dropped, []string{"s1"}) || len(GetUserCourses("s1")) != 0 {
+			t.Errorf("期望 s1 被退课，实际退课名单为 %v，s1 的课程为 %v", dropped, GetUserCourses("s1"))
+		}
+		if info, _ := GetCourseInfo("Busy"); info.Launched || info.NowStudents != 0 {
+			t.Errorf("下线后的课程信息不正确: %+v", info)
+		}
+		for _, uid := range []string{"s1", "s2"} {
+			if notices := GetNotifications(uid, true); len(notices) != 1 || !strings.Contains(notices[0].Message, "Busy") {
+				t.Errorf("期望 %s 收到一条关于 Busy 的通知，实际为 %v", uid, notices)
+			}
+		}
+		if notices := GetNotifications("s1", false); len(notices) != 0 {
+			t.Errorf("清空后期望没有通知，实际为 %v", notices)
+		}
+	})
+
+	t.Run("ArchiveAndRemove", func(t *testing.T) {
+		setupCourseTest()
+		AddCourse("Old", "t1", 10, 1)
+		AddCourse("Typo", "t1", 10, 1)
+		RecordCompletion("s1", "Old", "2023-1")
+		if err := RemoveCourse("Old"); err == nil {
+			t.Error("删除有修读记录的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := ArchiveCourse("Old"); err != nil {
+			t.Fatalf("归档课程失败: %v", err)
+		}
+		if err := LaunchCourse("Old"); err == nil {
+			t.Error("开设已归档的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := ModifyCourse("Old", "t2", 10, 1); err == nil {
+			t.Error("修改已归档的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := ResizeCourse("Old", 20); err == nil {
+			t.Error("调整已归档课程的容量时，期望得到一个错误，但实际为 nil")
+		}
+		AddCourse("Follow-up", "t1", 10, 1)
+		SetCourseEligibility("Follow-up", &Rule{Any: []Rule{{Grades: []int{3}}, {Not: &Rule{Completed: "Typo"}}}})
+		if err := RemoveCourse("Typo"); err == nil || !strings.Contains(err.Error(), "prerequisite of Follow-up") {
+			t.Errorf("删除被其他课程作为先修的课程时，期望得到一个错误，实际为 %v", err)
+		}
+		SetCourseEligibility("Follow-up", nil)
+		LaunchCourse("Typo")
+		if err := RemoveCourse("Typo"); err != nil {
+			t.Fatalf("删除没有学生的已开设课程失败: %v", err)
+		}
+		if _, err := GetCourseInfo("Typo"); err == nil {
+			t.Error("删除后仍能找到课程 Typo")
+		}
+		if _, launched := launchedMap.ReadPair("Typo"); launched {
+			t.Error("删除后课程 Typo 仍处于开设状态")
+		}
+	})
+}
+
 // TestSelectAndDropCourse 测试学生选课和退课的核心流程。
 func TestSelectAndDropCourse(t *testing.T) {
 	setupCourseTest()
@@ -123,9 +279,9 @@ func TestSelectAndDropCourse(t *testing.T) {
 	student1, student2 := "student1", "student2"
 
 	// 设置场景
-	AddCourse(courseFull, "teacher", 1)
-	AddCourse(courseAvailable, "teacher", 2)
-	AddCourse(courseNotLaunched, "teacher", 5)
+	AddCourse(courseFull, "teacher", 1, 1)
+	AddCourse(courseAvailable, "teacher", 2, 1)
+	AddCourse(courseNotLaunched, "teacher", 5, 1)
 	LaunchCourse(courseFull)
 	LaunchCourse(courseAvailable)
 
@@ -138,9 +294,8 @@ func TestSelectAndDropCourse(t *testing.T) {
 		if info.NowStudents != 1 {
 			t.Errorf("选课后，课程人数应为 1, 实际为 %d", info.NowStudents)
 		}
-		cName, _ := userCourseMap.ReadPair(student1)
-		if cName != courseAvailable {
-			t.Errorf("选课后，userCourseMap 记录不正确")
+		if courses := GetUserCourses(student1); len(courses) != 1 || courses[0] != courseAvailable {
+			t.Errorf("选课后，userCourseMap 记录不正确: %v", courses)
 		}
 	})
 
@@ -154,11 +309,11 @@ func TestSelectAndDropCourse(t *testing.T) {
 		}
 	})
 
-	t.Run("SelectAlreadyHasCourse", func(t *testing.T) {
+	t.Run("SelectSameCourseTwice", func(t *testing.T) {
 		// student1 已经选了 courseAvailable
-		err := SelectCourse(student1, courseFull)
+		err := SelectCourse(student1, courseAvailable)
 		if err == nil {
-			t.Error("已选课的学生再次选课时，期望得到一个错误，但实际为 nil")
+			t.Error("重复选择同一门课程时，期望得到一个错误，但实际为 nil")
 		}
 	})
 
@@ -170,7 +325,7 @@ func TestSelectAndDropCourse(t *testing.T) {
 	})
 
 	t.Run("SuccessfulDrop", func(t *testing.T) {
-		err := DropCourse(student1)
+		err := DropCourse(student1, courseAvailable)
 		if err != nil {
 			t.Fatalf("学生 %s 退课失败: %v", student1, err)
 		}
@@ -185,20 +340,771 @@ func TestSelectAndDropCourse(t *testing.T) {
 
 	t.Run("DropWithoutCourse", func(t *testing.T) {
 		// student2 从未成功选课
-		err := DropCourse(student2)
+		err := DropCourse(student2, courseAvailable)
 		if err == nil {
 			t.Error("未选课的学生退课时，期望得到一个错误，但实际为 nil")
 		}
 	})
 }
 
+// TestSelectionLimit 测试多门选课及其门数、学分上限。
+func TestSelectionLimit(t *testing.T) {
+	setupCourseTest()
+	student := "student1"
+	AddCourse("Math", "t1", 10, 4)
+	AddCourse("Physics", "t2", 10, 3)
+	AddCourse("Art", "t3", 10, 2)
+	AddCourse("Music", "t4", 10, 1)
+	for _, courseName := range []string{"Math", "Physics", "Art", "Music"} {
+		LaunchCourse(courseName)
+	}
+
+	t.Run("MultipleCourses", func(t *testing.T) {
+		if err := SelectCourse(student, "Math"); err != nil {
+			t.Fatalf("选择第一门课程失败: %v", err)
+		}
+		if err := SelectCourse(student, "Physics"); err != nil {
+			t.Fatalf("选择第二门课程失败: %v", err)
+		}
+		courses := GetUserCourses(student)
+		if len(courses) != 2 || courses[0] != "Math" || courses[1] != "Physics" {
+			t.Errorf("期望已选课程为 [Math Physics]，实际为 %v", courses)
+		}
+	})
+
+	t.Run("CreditLimit", func(t *testing.T) {
+		if err := SetSelectionLimit(SelectionLimit{MaxCredits: 8}); err != nil {
+			t.Fatalf("设置选课上限失败: %v", err)
+		}
+		// 已有 7 学分，再选 2 学分会超出上限
+		if err := SelectCourse(student, "Art"); err == nil {
+			t.Error("超出学分上限时，期望得到一个错误，但实际为 nil")
+		}
+		if err := SelectCourse(student, "Music"); err != nil {
+			t.Errorf("恰好达到学分上限时应当成功，实际错误: %v", err)
+		}
+	})
+
+	t.Run("CourseLimit", func(t *testing.T) {
+		SetSelectionLimit(SelectionLimit{MaxCourses: 3})
+		if err := SelectCourse(student, "Art"); err == nil {
+			t.Error("超出课程门数上限时，期望得到一个错误，但实际为 nil")
+		}
+		DropCourse(student, "Music")
+		if err := SelectCourse(student, "Art"); err != nil {
+			t.Errorf("退课后应可以再选一门，实际错误: %v", err)
+		}
+	})
+
+	t.Run("NegativeLimit", func(t *testing.T) {
+		if err := SetSelectionLimit(SelectionLimit{MaxCourses: -1}); err == nil {
+			t.Error("设置负数上限时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("DropOneOfMany", func(t *testing.T) {
+		if err := DropCourse(student, "Music"); err == nil {
+			t.Error("退掉未选的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := DropCourse(student, "Math"); err != nil {
+			t.Fatalf("退课失败: %v", err)
+		}
+		courses := GetUserCourses(student)
+		if len(courses) != 2 || courses[0] != "Art" || courses[1] != "Physics" {
+			t.Errorf("退课后已选课程应为 [Art Physics]，实际为 %v", courses)
+		}
+	})
+}
+
+// TestScheduleConflict 测试上课时间的校验以及选课时的时间冲突检测。
+func TestScheduleConflict(t *testing.T) {
+	setupCourseTest()
+	monday := TimeSlot{Day: 1, StartPeriod: 1, EndPeriod: 2, FirstWeek: 1, LastWeek: 16}
+	AddCourse("Morning", "t1", 5, 1, monday)
+	AddCourse("Overlap", "t2", 5, 1, TimeSlot{Day: 1, StartPeriod: 2, EndPeriod: 3, FirstWeek: 8, LastWeek: 8})
+	AddCourse("LaterWeeks", "t3", 5, 1, TimeSlot{Day: 1, StartPeriod: 1, EndPeriod: 2, FirstWeek: 17, LastWeek: 18})
+	AddCourse("Tuesday", "t4", 5, 1, TimeSlot{Day: 2, StartPeriod: 1, EndPeriod: 2, FirstWeek: 1, LastWeek: 16})
+	for _, courseName := range []string{"Morning", "Overlap", "LaterWeeks", "Tuesday"} {
+		LaunchCourse(courseName)
+	}
+	SelectCourse("s1", "Morning")
+
+	t.Run("InvalidSlots", func(t *testing.T) {
+		if err := AddCourse("BadDay", "t", 5, 1, TimeSlot{Day: 8, StartPeriod: 1, EndPeriod: 1, FirstWeek: 1, LastWeek: 1}); err == nil {
+			t.Error("星期超出范围时，期望得到一个错误，但实际为 nil")
+		}
+		if err := AddCourse("SelfOverlap", "t", 5, 1, monday, monday); err == nil {
+			t.Error("课程自身时间重叠时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		err := SelectCourse("s1", "Overlap")
+		if err == nil {
+			t.Fatal("选择时间冲突的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if !strings.Contains(err.Error(), "Morning") {
+			t.Errorf("错误信息应指明冲突的课程 Morning，实际为: %v", err)
+		}
+	})
+
+	t.Run("NoConflict", func(t *testing.T) {
+		if err := SelectCourse("s1", "LaterWeeks"); err != nil {
+			t.Errorf("周次不重叠的课程应当可选，实际错误: %v", err)
+		}
+		if err := SelectCourse("s1", "Tuesday"); err != nil {
+			t.Errorf("不同日期的课程应当可选，实际错误: %v", err)
+		}
+	})
+}
+
+// TestEligibility 测试年级、班级、先修课程及其组合的选课资格规则。
+func TestEligibility(t *testing.T) {
+	setupCourseTest()
+	classes := map[string]ClassRef{"junior": {Grade: 1, Class: 1}, "senior": {Grade: 2, Class: 3}}
+	SetClassResolver(func(uid string) (ClassRef, bool) {
+		classref, ok := classes[uid]
+		return classref, ok
+	})
+	defer SetClassResolver(func(string) (ClassRef, bool) { return ClassRef{}, false })
+	AddCourse("Basics", "t1", 5, 1)
+	AddCourse("Advanced", "t2", 5, 1)
+	LaunchCourse("Advanced")
+
+	t.Run("InvalidRule", func(t *testing.T) {
+		if err := SetCourseEligibility("Advanced", &Rule{Grades: []int{1}, Completed: "Basics"}); err == nil {
+			t.Error("规则同时设置多个字段时，期望得到一个错误，但实际为 nil")
+		}
+		for _, empty := range []*Rule{{Grades: []int{}}, {Classes: []ClassRef{}}, {All: []Rule{}}, {Not: &Rule{Any: []Rule{}}}} {
+			if err := SetCourseEligibility("Advanced", empty); err == nil {
+				t.Errorf("规则 %+v 的列表为空，期望得到一个错误，但实际为 nil", empty)
+			}
+		}
+	})
+
+	rule := &Rule{Any: []Rule{
+		{Classes: []ClassRef{{Grade: 1, Class: 1}}},
+		{All: []Rule{{Grades: []int{2}}, {Completed: "Basics"}}},
+	}}
+	if err := SetCourseEligibility("Advanced", rule); err != nil {
+		t.Fatalf("设置选课资格失败: %v", err)
+	}
+
+	t.Run("ClassAllowed", func(t *testing.T) {
+		if err := CheckEligibility("junior", "Advanced"); err != nil {
+			t.Errorf("1-1 班学生应有资格，实际错误: %v", err)
+		}
+	})
+
+	t.Run("MissingPrerequisite", func(t *testing.T) {
+		err := SelectCourse("senior", "Advanced")
+		if err == nil {
+			t.Fatal("缺少先修课程时，期望得到一个错误，但实际为 nil")
+		}
+		if !strings.Contains(err.Error(), "course Basics completed in a prior term") {
+			t.Errorf("错误信息应说明缺少的条件，实际为: %v", err)
+		}
+	})
+
+	t.Run("PriorTermOnly", func(t *testing.T) {
+		SetCurrentTerm("2024-2")
+		RecordCompletion("senior", "Basics", "2024-2")
+		if CheckEligibility("senior", "Advanced") == nil {
+			t.Error("本学期完成的课程不应算作先修课程")
+		}
+		RecordCompletion("senior", "Basics", "2024-1")
+		if err := SelectCourse("senior", "Advanced"); err != nil {
+			t.Errorf("上学期已完成先修课程的学生应可选课，实际错误: %v", err)
+		}
+	})
+
+	t.Run("TermOrder", func(t *testing.T) {
+		if err := SetCurrentTerm("2025-10"); err != nil {
+			t.Fatalf("设置学期失败: %v", err)
+		}
+		RecordCompletion("senior", "Basics", "2025-9")
+		if err := CheckEligibility("senior", "Advanced"); err != nil {
+			t.Errorf("学期应按数字比较，2025-9 早于 2025-10，实际错误: %v", err)
+		}
+		if err := SetCurrentTerm("2025-fall"); err == nil {
+			t.Error("格式错误的学期应返回错误")
+		}
+		if err := RecordCompletion("senior", "Basics", "25-1"); err == nil {
+			t.Error("格式错误的修读学期应返回错误")
+		}
+		SetCurrentTerm("2024-2")
+	})
+
+	t.Run("Not", func(t *testing.T) {
+		SetCourseEligibility("Basics", &Rule{Not: &Rule{Grades: []int{2}}})
+		if CheckEligibility("senior", "Basics") == nil {
+			t.Error("二年级学生不应有资格选择排除二年级的课程")
+		}
+		if err := CheckEligibility("unknown", "Basics"); err != nil {
+			t.Errorf("未知年级的学生应满足否定规则，实际错误: %v", err)
+		}
+	})
+}
+
+// TestWaitlist 测试候补名单的加入、排位以及退课和扩容时的自动递补。
+func TestWaitlist(t *testing.T) {
+	setupCourseTest()
+	courseName := "Popular"
+	AddCourse(courseName, "t1", 1, 2)
+	AddCourse("Other", "t2", 5, 3)
+	LaunchCourse(courseName)
+	LaunchCourse("Other")
+	SelectCourse("s1", courseName)
+
+	t.Run("JoinAndPosition", func(t *testing.T) {
+		if err := JoinWaitlist("s2", courseName); err != nil {
+			t.Fatalf("加入候补名单失败: %v", err)
+		}
+		if err := JoinWaitlist("s3", courseName); err != nil {
+			t.Fatalf("加入候补名单失败: %v", err)
+		}
+		if position, _ := GetWaitlistPosition("s3", courseName); position != 2 {
+			t.Errorf("s3 的候补位置应为 2，实际为 %d", position)
+		}
+		if err := JoinWaitlist("s2", courseName); err == nil {
+			t.Error("重复加入候补名单时，期望得到一个错误，但实际为 nil")
+		}
+		if err := JoinWaitlist("s1", courseName); err == nil {
+			t.Error("已选课学生加入候补名单时，期望得到一个错误，但实际为 nil")
+		}
+		if err := JoinWaitlist("s2", "Other"); err == nil {
+			t.Error("课程仍有空位时加入候补名单，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("PromoteOnDrop", func(t *testing.T) {
+		if err := DropCourse("s1", courseName); err != nil {
+			t.Fatalf("退课失败: %v", err)
+		}
+		users := GetCourseUsers(courseName)
+		if len(users) != 1 || users[0] != "s2" {
+			t.Errorf("退课后应递补 s2，实际名册为 %v", users)
+		}
+		if position, _ := GetWaitlistPosition("s3", courseName); position != 1 {
+			t.Errorf("递补后 s3 的候补位置应为 1，实际为 %d", position)
+		}
+		if _, err := GetWaitlistPosition("s2", courseName); err == nil {
+			t.Error("已递补的学生不应再留在候补名单中")
+		}
+	})
+
+	t.Run("SkipIneligible", func(t *testing.T) {
+		SetSelectionLimit(SelectionLimit{MaxCredits: 4})
+		defer SetSelectionLimit(SelectionLimit{})
+		SelectCourse("s3", "Other")
+		JoinWaitlist("s4", courseName)
+		// s3 已有 3 学分，再递补 2 学分会超出上限，因此应跳过 s3 递补 s4
+		if err := ResizeCourse(courseName, 2); err != nil {
+			t.Fatalf("扩容失败: %v", err)
+		}
+		users := GetCourseUsers(courseName)
+		sort.Strings(users)
+		if len(users) != 2 || users[1] != "s4" {
+			t.Errorf("扩容后应递补 s4，实际名册为 %v", users)
+		}
+		if position, _ := GetWaitlistPosition("s3", courseName); position != 1 {
+			t.Errorf("被跳过的 s3 应保留候补位置 1，实际为 %d", position)
+		}
+	})
+
+	t.Run("ResizeBelowEnrolled", func(t *testing.T) {
+		if err := ResizeCourse(courseName, 1); err == nil {
+			t.Error("容量缩减到已选人数以下时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		if err := LeaveWaitlist("s3", courseName); err != nil {
+			t.Fatalf("退出候补名单失败: %v", err)
+		}
+		if GetWaitlistLength(courseName) != 0 {
+			t.Error("退出后候补名单应为空")
+		}
+		if err := LeaveWaitlist("s3", courseName); err == nil {
+			t.Error("重复退出候补名单时，期望得到一个错误，但实际为 nil")
+		}
+	})
+}
+
+// TestRounds 测试选课轮次的创建、修改、关闭以及选课和退课的时间窗口。
+func TestRounds(t *testing.T) {
+	setupCourseTest()
+	start := time.Date(2024, 9, 1, 8, 0, 0, 0, time.UTC)
+	now := start
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	SetClassResolver(func(uid string) (ClassRef, bool) { return ClassRef{Grade: 1, Class: 1}, true })
+	defer SetClassResolver(func(string) (ClassRef, bool) { return ClassRef{}, false })
+	AddCourse("Covered", "t1", 5, 1)
+	AddCourse("Uncovered", "t2", 5, 1)
+	LaunchCourse("Covered")
+	LaunchCourse("Uncovered")
+
+	t.Run("NoRoundsStayOpen", func(t *testing.T) {
+		if err := SelectCourse("s1", "Uncovered"); err != nil {
+			t.Errorf("尚未创建轮次时应可直接选课，实际错误: %v", err)
+		}
+	})
+
+	round := Round{
+		Name:    "first",
+		Start:   start,
+		End:     start.Add(72 * time.Hour),
+		Courses: []string{"Covered"},
+		Grades:  []int{1},
+		Select:  Window{Start: start, End: start.Add(24 * time.Hour)},
+		Drop:    Window{Start: start.Add(24 * time.Hour), End: start.Add(48 * time.Hour)},
+	}
+
+	t.Run("InvalidRound", func(t *testing.T) {
+		bad := round
+		bad.Select = Window{Start: start.Add(-time.Hour), End: start.Add(time.Hour)}
+		if err := CreateRound(bad); err == nil {
+			t.Error("窗口超出轮次范围时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	if err := CreateRound(round); err != nil {
+		t.Fatalf("创建轮次失败: %v", err)
+	}
+
+	t.Run("SelectWindow", func(t *testing.T) {
+		if err := SelectCourse("s1", "Covered"); err != nil {
+			t.Fatalf("选课窗口内选课失败: %v", err)
+		}
+		if err := SelectCourse("s2", "Uncovered"); err == nil {
+			t.Error("选择不在轮次内的课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := DropCourse("s1", "Covered"); err == nil {
+			t.Error("退课窗口开始前退课时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("DropWindow", func(t *testing.T) {
+		now = start.Add(30 * time.Hour)
+		if err := SelectCourse("s2", "Covered"); err == nil {
+			t.Error("选课窗口结束后选课时，期望得到一个错误，但实际为 nil")
+		}
+		if err := DropCourse("s1", "Covered"); err != nil {
+			t.Errorf("退课窗口内退课失败: %v", err)
+		}
+	})
+
+	t.Run("ModifyAndClose", func(t *testing.T) {
+		round.Select.End = start.Add(36 * time.Hour)
+		if err := ModifyRound(round); err != nil {
+			t.Fatalf("修改轮次失败: %v", err)
+		}
+		if err := SelectCourse("s2", "Covered"); err != nil {
+			t.Errorf("延长选课窗口后应可选课，实际错误: %v", err)
+		}
+		if err := CloseRound("first"); err != nil {
+			t.Fatalf("关闭轮次失败: %v", err)
+		}
+		if err := SelectCourse("s3", "Covered"); err == nil {
+			t.Error("轮次关闭后选课时，期望得到一个错误，但实际为 nil")
+		}
+		if err := ModifyRound(round); err == nil {
+			t.Error("修改已关闭的轮次时，期望得到一个错误，但实际为 nil")
+		}
+		if rounds := GetRounds(); len(rounds) != 1 || !rounds[0].Closed {
+			t.Errorf("期望列出 1 个已关闭的轮次，实际为 %+v", rounds)
+		}
+	})
+}
+
+// TestLottery 测试抽签模式：提交意向不占名额，轮次结束后按种子可复现地抽签。
+func TestLottery(t *testing.T) {
+	start := time.Date(2024, 9, 1, 8, 0, 0, 0, time.UTC)
+	now := start.Add(time.Hour)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	applicants := []string{"s1", "s2", "s3", "s4", "s5"}
+
+	// draw 在全新的环境中提交全部意向并以 seed 抽签，返回抽签报告。
+	draw := func(t *testing.T, seed int64) *LotteryReport {
+		setupCourseTest()
+		AddCourse("Popular", "t1", 2, 1)
+		LaunchCourse("Popular")
+		round := Round{Name: "ballot", Start: start, End: start.Add(24 * time.Hour), Mode: AllocationLottery,
+			Select: Window{Start: start, End: start.Add(24 * time.Hour)}}
+		if err := CreateRound(round); err != nil {
+			t.Fatalf("创建抽签轮次失败: %v", err)
+		}
+		for _, uid := range applicants {
+			if err := SubmitIntent(uid, "Popular"); err != nil {
+				t.Fatalf("提交意向失败: %v", err)
+			}
+		}
+		if _, err := RunLottery("ballot", seed); err == nil {
+			t.Error("轮次未结束时抽签，期望得到一个错误，但实际为 nil")
+		}
+		CloseRound("ballot")
+		report, err := RunLottery("ballot", seed)
+		if err != nil {
+			t.Fatalf("抽签失败: %v", err)
+		}
+		return report
+	}
+
+	t.Run("IntentsHoldNoSeat", func(t *testing.T) {
+		setupCourseTest()
+		AddCourse("Popular", "t1", 2, 1)
+		LaunchCourse("Popular")
+		CreateRound(Round{Name: "ballot", Start: start, End: start.Add(24 * time.Hour), Mode: AllocationLottery,
+			Select: Window{Start: start, End: start.Add(24 * time.Hour)}})
+		if err := SelectCourse("s1", "Popular"); err == nil {
+			t.Error("抽签轮次中直接选课时，期望得到一个错误，但实际为 nil")
+		}
+		SubmitIntent("s1", "Popular")
+		if info, _ := courseInfoMap.ReadPair("Popular"); info.NowStudents != 0 {
+			t.Errorf("提交意向不应占用名额，实际人数为 %d", info.NowStudents)
+		}
+		if intents := GetUserIntents("s1"); len(intents) != 1 || intents[0] != "Popular" {
+			t.Errorf("期望意向为 [Popular]，实际为 %v", intents)
+		}
+		if err := WithdrawIntent("s1", "Popular"); err != nil || len(GetUserIntents("s1")) != 0 {
+			t.Errorf("撤回意向失败: %v", err)
+		}
+	})
+
+	t.Run("Reproducible", func(t *testing.T) {
+		first := draw(t, 42)
+		if len(first.Courses) != 1 || len(first.Courses[0].Winners) != 2 || len(first.Courses[0].Losers) != 3 {
+			t.Fatalf("期望 2 人中签、3 人未中签，实际报告为 %+v", first)
+		}
+		winners := GetCourseUsers("Popular")
+		sort.Strings(winners)
+		expected := slices.Clone(first.Courses[0].Winners)
+		sort.Strings(expected)
+		if !slices.Equal(winners, expected) {
+			t.Errorf("课程名册 %v 与中签名单 %v 不一致", winners, expected)
+		}
+		if _, err := RunLottery("ballot", 42); err == nil {
+			t.Error("重复抽签时，期望得到一个错误，但实际为 nil")
+		}
+		second := draw(t, 42)
+		if !slices.Equal(first.Courses[0].Winners, second.Courses[0].Winners) {
+			t.Errorf("相同种子的抽签结果应一致: %v 与 %v", first.Courses[0].Winners, second.Courses[0].Winners)
+		}
+	})
+
+	t.Run("AlreadyEnrolled", func(t *testing.T) {
+		setupCourseTest()
+		AddCourse("Popular", "t1", 2, 1)
+		LaunchCourse("Popular")
+		CreateRound(Round{Name: "ballot", Start: start, End: start.Add(24 * time.Hour), Mode: AllocationLottery,
+			Select: Window{Start: start, End: start.Add(24 * time.Hour)}})
+		SubmitIntent("s1", "Popular")
+		SubmitIntent("s2", "Popular")
+		// 提交意向后 s1 已通过其他途径入选该课程
+		courseInfo, _ := courseInfoMap.ReadPair("Popular")
+		enrollUser("s1", &courseInfo)
+		CloseRound("ballot")
+		report, err := RunLottery("ballot", 7)
+		if err != nil {
+			t.Fatalf("抽签失败: %v", err)
+		}
+		result := report.Courses[0]
+		if !slices.Equal(result.Winners, []string{"s2"}) || len(result.Losers) != 1 || result.Losers[0].Uid != "s1" ||
+			!strings.Contains(result.Losers[0].Reason, "already enrolled") {
+			t.Errorf("已入选的申请者应记为未中签并注明原因，实际报告为 %+v", result)
+		}
+	})
+}
+
+// TestPreferenceAllocation 测试志愿提交以及两种匹配算法的分配和预演。
+func TestPreferenceAllocation(t *testing.T) {
+	start := time.Date(2024, 9, 1, 8, 0, 0, 0, time.UTC)
+	now := start.Add(time.Hour)
+	timeNow = func() time.Time { return now }
+	grades := map[string]int{"senior": 3, "junior": 1, "fresh": 1}
+	SetClassResolver(func(uid string) (ClassRef, bool) {
+		grade, ok := grades[uid]
+		return ClassRef{Grade: grade, Class: 1}, ok
+	})
+	defer func() {
+		timeNow = time.Now
+		SetClassResolver(func(string) (ClassRef, bool) { return ClassRef{}, false })
+	}()
+
+	// prepare 在全新的环境中建立两门各有一个名额的课程，三名学生都把 A 排在 B 之前。
+	prepare := func(t *testing.T) {
+		setupCourseTest()
+		AddCourse("A", "t1", 1, 1)
+		AddCourse("B", "t2", 1, 1)
+		LaunchCourse("A")
+		LaunchCourse("B")
+		round := Round{Name: "wish", Start: start, End: start.Add(24 * time.Hour), Mode: AllocationPreference,
+			Select: Window{Start: start, End: start.Add(24 * time.Hour)}}
+		if err := CreateRound(round); err != nil {
+			t.Fatalf("创建志愿轮次失败: %v", err)
+		}
+		for _, uid := range []string{"senior", "junior", "fresh"} {
+			if err := SubmitPreferences(uid, []string{"A", "B"}); err != nil {
+				t.Fatalf("提交志愿失败: %v", err)
+			}
+		}
+		CloseRound("wish")
+	}
+
+	t.Run("Submit", func(t *testing.T) {
+		prepare(t)
+		if err := SelectCourse("senior", "A"); err == nil {
+			t.Error("志愿轮次中直接选课时，期望得到一个错误，但实际为 nil")
+		}
+		if preferences := GetUserPreferences("junior"); len(preferences) != 1 || !slices.Equal(preferences["wish"], []string{"A", "B"}) {
+			t.Errorf("期望轮次 wish 的志愿为 [A B]，实际为 %v", preferences)
+		}
+		CreateRound(Round{Name: "wish2", Start: start, End: start.Add(24 * time.Hour), Mode: AllocationPreference,
+			Select: Window{Start: start, End: start.Add(24 * time.Hour)}})
+		if err := SubmitPreferences("senior", []string{"A", "A"}); err == nil {
+			t.Error("重复填报同一课程时，期望得到一个错误，但实际为 nil")
+		}
+		if err := SubmitPreferences("senior", []string{}); err == nil {
+			t.Error("提交空志愿时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("DeferredAcceptancePrefersSeniors", func(t *testing.T) {
+		prepare(t)
+		report, err := RunAllocation("wish", AlgorithmDeferredAcceptance, 7, true)
+		if err != nil {
+			t.Fatalf("预演分配失败: %v", err)
+		}
+		if len(GetCourseUsers("A")) != 0 {
+			t.Error("预演不应改变选课结果")
+		}
+		for _, assignment := range report.Assignments {
+			if assignment.Uid == "senior" && (assignment.CourseName != "A" || assignment.Rank != 1) {
+				t.Errorf("高年级学生应获得第一志愿 A，实际为 %+v", assignment)
+			}
+		}
+		for _, fill := range report.Courses {
+			if fill.Seats != 1 || fill.Assigned != 1 || fill.FillRate() != 1 {
+				t.Errorf("期望课程 %s 满员，实际为 %+v", fill.CourseName, fill)
+			}
+		}
+		if _, err := RunAllocation("wish", AlgorithmDeferredAcceptance, 7, false); err != nil {
+			t.Fatalf("分配失败: %v", err)
+		}
+		if users := GetCourseUsers("A"); !slices.Equal(users, []string{"senior"}) {
+			t.Errorf("期望课程 A 的名册为 [senior]，实际为 %v", users)
+		}
+		if _, err := RunAllocation("wish", AlgorithmDeferredAcceptance, 7, false); err == nil {
+			t.Error("重复分配时，期望得到一个错误，但实际为 nil")
+		}
+	})
+
+	t.Run("SerialDictatorshipIsReproducible", func(t *testing.T) {
+		prepare(t)
+		first, err := RunAllocation("wish", AlgorithmSerialDictatorship, 42, true)
+		if err != nil {
+			t.Fatalf("预演分配失败: %v", err)
+		}
+		second, _ := RunAllocation("wish", AlgorithmSerialDictatorship, 42, true)
+		if !slices.Equal(first.Assignments, second.Assignments) {
+			t.Errorf("相同种子的分配结果应一致: %v 与 %v", first.Assignments, second.Assignments)
+		}
+		assigned := 0
+		for _, assignment := range first.Assignments {
+			if assignment.CourseName != "" {
+				assigned++
+			}
+		}
+		if assigned != 2 {
+			t.Errorf("期望 2 名学生获得课程，实际为 %d", assigned)
+		}
+		if _, err := RunAllocation("wish", "unknown", 42, true); err == nil {
+			t.Error("使用未知算法时，期望得到一个错误，但实际为 nil")
+		}
+	})
+}
+
+// TestLegacyUserCourseMigration 测试旧的单课程选课数据能被迁移到多课程格式。
+func TestLegacyUserCourseMigration(t *testing.T) {
+	os.MkdirAll("data", 0755)
+	defer os.RemoveAll("data")
+	os.WriteFile(courseInfoPath, []byte(`{"Go":{"CourseName":"Go","Teacher":"t","MaxStudents":5,"NowStudents":0,"Launched":true}}`), 0644)
+	os.WriteFile(launchedMapPath, []byte(`{"Go":{}}`), 0644)
+	os.WriteFile(courseUserPath, []byte(`{"Go":{}}`), 0644)
+	os.WriteFile(userCoursePath, []byte(`{"student1":"Go","student2":"Go"}`), 0644)
+	InitCourseSystem()
+
+	if courses := GetUserCourses("student1"); len(courses) != 1 || courses[0] != "Go" {
+		t.Errorf("迁移后 student1 的课程应为 [Go]，实际为 %v", courses)
+	}
+	if users := GetCourseUsers("Go"); len(users) != 2 {
+		t.Errorf("迁移后课程名册应有 2 人，实际为 %v", users)
+	}
+	if info, _ := courseInfoMap.ReadPair("Go"); info.NowStudents != 2 {
+		t.Errorf("迁移后课程人数应为 2，实际为 %d", info.NowStudents)
+	}
+}
+
+// TestCourseDetails 测试课程简介、教室、类别和标签的设置。
+func TestCourseDetails(t *testing.T) {
+	setupCourseTest()
+	AddCourse("Painting", "t1", 10, 2)
+	details := CourseDetails{Description: "Oil and watercolour", Room: "A101", Category: CategoryArts, Tags: []string{" studio ", "", "studio", "beginner"}}
+	if err := SetCourseDetails("Painting", details); err != nil {
+		t.Fatalf("设置课程详情失败: %v", err)
+	}
+	info, _ := GetCourseInfo("Painting")
+	if info.Description != "Oil and watercolour" || info.Room != "A101" || info.Category != CategoryArts {
+		t.Errorf("课程详情未正确保存: %+v", info.CourseDetails)
+	}
+	if !slices.Equal(info.Tags, []string{"studio", "beginner"}) {
+		t.Errorf("期望标签为 [studio beginner]，实际为 %v", info.Tags)
+	}
+	if err := SetCourseDetails("Painting", CourseDetails{Category: "cooking"}); err == nil {
+		t.Error("使用未知类别时，期望得到一个错误，但实际为 nil")
+	}
+	ArchiveCourse("Painting")
+	if err := SetCourseDetails("Painting", details); err == nil {
+		t.Error("修改已归档课程的详情时，期望得到一个错误，但实际为 nil")
+	}
+	if err := AddCourseWithDetails("Cooking", "t1", 10, 1, CourseDetails{Category: "cooking"}); err == nil {
+		t.Error("以未知类别创建课程时，期望得到一个错误，但实际为 nil")
+	}
+	if _, err := GetCourseInfo("Cooking"); err == nil {
+		t.Error("创建被拒绝后，不应留下没有详情的课程")
+	}
+	if err := AddCourseWithDetails("Sculpture", "t1", 10, 1, details); err != nil {
+		t.Fatalf("创建带详情的课程失败: %v", err)
+	}
+	if info, _ := GetCourseInfo("Sculpture"); info.Room != "A101" || !slices.Equal(info.Tags, []string{"studio", "beginner"}) {
+		t.Errorf("创建时的课程详情未正确保存: %+v", info.CourseDetails)
+	}
+}
+
+// TestSearchCourses 测试课程的搜索、筛选、排序和分页。
+func TestSearchCourses(t *testing.T) {
+	setupCourseTest()
+	AddCourse("Algebra", "Alice", 3, 2)
+	AddCourse("Biology", "Bob", 5, 2)
+	AddCourse("Chess", "alice", 4, 1)
+	AddCourse("Drawing", "Dora", 2, 1)
+	SetCourseDetails("Biology", CourseDetails{Description: "Cells and genes", Category: CategoryScience})
+	SetCourseDetails("Drawing", CourseDetails{Category: CategoryArts})
+	for _, courseName := range []string{"Algebra", "Biology", "Chess"} {
+		LaunchCourse(courseName)
+	}
+	SelectCourse("s1", "Algebra")
+	SelectCourse("s2", "Algebra")
+	SelectCourse("s3", "Algebra")
+	SelectCourse("s1", "Chess")
+	SetCourseEligibility("Chess", &Rule{Grades: []int{3}})
+
+	names := func(page *CoursePage) []string {
+		result := []string{}
+		for _, courseInfo := range page.Courses {
+			result = append(result, courseInfo.CourseName)
+		}
+		return result
+	}
+	launched := true
+	tests := []struct {
+		name     string
+		query    CourseQuery
+		expected []string
+	}{
+		{"All", CourseQuery{}, []string{"Algebra", "Biology", "Chess", "Drawing"}},
+		{"TextInDescription", CourseQuery{Text: "GENES"}, []string{"Biology"}},
+		{"Teacher", CourseQuery{Teacher: "ALICE"}, []string{"Algebra", "Chess"}},
+		{"Category", CourseQuery{Categories: []Category{CategoryArts, CategoryScience}}, []string{"Biology", "Drawing"}},
+		{"LaunchedWithSeats", CourseQuery{Launched: &launched, HasSeats: true}, []string{"Biology", "Chess"}},
+		{"Eligible", CourseQuery{EligibleFor: "s1"}, []string{"Algebra", "Biology", "Drawing"}},
+		{"Seats", CourseQuery{Sort: SortBySeats}, []string{"Biology", "Chess", "Drawing", "Algebra"}},
+		{"Popularity", CourseQuery{Sort: SortByPopularity}, []string{"Algebra", "Chess", "Biology", "Drawing"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := SearchCourses(test.query)
+			if err != nil {
+				t.Fatalf("搜索课程失败: %v", err)
+			}
+			if !slices.Equal(names(page), test.expected) {
+				t.Errorf("期望结果为 %v，实际为 %v", test.expected, names(page))
+			}
+		})
+	}
+
+	t.Run("Grade", func(t *testing.T) {
+		// 班级规则只接纳该年级的部分学生，先修课取决于学生本人，二者都不应把年级排除
+		SetCourseEligibility("Algebra", &Rule{All: []Rule{{Classes: []ClassRef{{Grade: 2, Class: 1}}}, {Completed: "Biology"}}})
+		SetCourseEligibility("Drawing", &Rule{Not: &Rule{Grades: []int{2}}})
+		defer SetCourseEligibility("Algebra", nil)
+		defer SetCourseEligibility("Drawing", nil)
+		for grade, expected := range map[int][]string{
+			2: {"Algebra", "Biology"},
+			3: {"Biology", "Chess", "Drawing"},
+		} {
+			page, err := SearchCourses(CourseQuery{Grade: grade})
+			if err != nil {
+				t.Fatalf("按年级搜索课程失败: %v", err)
+			}
+			if !slices.Equal(names(page), expected) {
+				t.Errorf("年级 %d 期望结果为 %v，实际为 %v", grade, expected, names(page))
+			}
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		query := CourseQuery{Sort: SortBySeats, Limit: 3}
+		first, _ := SearchCourses(query)
+		if first.Total != 4 || len(first.Courses) != 3 || first.NextCursor == "" {
+			t.Fatalf("第一页不正确: %v, 共 %d 门, 游标 %q", names(first), first.Total, first.NextCursor)
+		}
+		// 翻页之间课程人数变化，也不应重复或遗漏课程
+		SelectCourse("s4", "Biology")
+		query.Cursor = first.NextCursor
+		second, err := SearchCourses(query)
+		if err != nil {
+			t.Fatalf("获取第二页失败: %v", err)
+		}
+		if !slices.Equal(names(second), []string{"Algebra"}) || second.NextCursor != "" {
+			t.Errorf("期望第二页为 [Algebra] 且没有下一页，实际为 %v, %q", names(second), second.NextCursor)
+		}
+		query.Sort = SortByName
+		if _, err := SearchCourses(query); err == nil {
+			t.Error("游标与排序方式不一致时，期望得到一个错误，但实际为 nil")
+		}
+	})
+}
+
+// TestLegacyCourseInfoLoad 测试没有课程详情的旧数据能被正常加载，且非法的详情会被清理。
+func TestLegacyCourseInfoLoad(t *testing.T) {
+	os.MkdirAll("data", 0755)
+	defer os.RemoveAll("data")
+	os.WriteFile(courseInfoPath, []byte(`{"Go":{"CourseName":"Go","Teacher":"t","MaxStudents":5,"NowStudents":0,"Launched":false},`+
+		`"Yoga":{"CourseName":"Yoga","Teacher":"t","MaxStudents":5,"Category":"wellness","Tags":["calm","calm"]}}`), 0644)
+	InitCourseSystem()
+
+	info, err := GetCourseInfo("Go")
+	if err != nil || info.Teacher != "t" || info.MaxStudents != 5 {
+		t.Fatalf("旧格式的课程未能正确加载: %+v, %v", info, err)
+	}
+	if info.Description != "" || info.Category != CategoryNone || len(info.Tags) != 0 {
+		t.Errorf("旧格式的课程应没有详情，实际为 %+v", info.CourseDetails)
+	}
+	if info, _ := GetCourseInfo("Yoga"); info.Category != CategoryNone || !slices.Equal(info.Tags, []string{"calm"}) {
+		t.Errorf("期望清理未知类别和重复标签，实际为 %+v", info.CourseDetails)
+	}
+}
+
 // TestGetters 测试数据获取功能。
 func TestGetters(t *testing.T) {
 	setupCourseTest()
 	c1, c2 := "Course1", "Course2"
 	s1, s2 := "student1", "student2"
-	AddCourse(c1, "t1", 3)
-	AddCourse(c2, "t2", 2)
+	AddCourse(c1, "t1", 3, 1)
+	AddCourse(c2, "t2", 2, 1)
 	LaunchCourse(c1)
 	SelectCourse(s1, c1)
 	SelectCourse(s2, c1)
@@ -232,6 +1138,31 @@ func TestGetters(t *testing.T) {
 	})
 }
 
+// TestExportFillReport 检查课程填充报告的 CSV 导出。
+func TestExportFillReport(t *testing.T) {
+	setupCourseTest()
+	AddCourse("数学", "张老师", 2, 1)
+	AddCourse("Art", "t2", 0, 1)
+	LaunchCourse("数学")
+	SelectCourse("s1", "数学")
+	SelectCourse("s2", "数学")
+	JoinWaitlist("s3", "数学")
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(ExportFillReport()), "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("无法读取导出的 CSV: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "course" {
+		t.Fatalf("期望表头加 2 门课程，实际为 %q", records)
+	}
+	if got := strings.Join(records[1], ","); got != "Art,t2,,false,false,0,0,0," {
+		t.Errorf("容量为 0 的课程行不正确: %s", got)
+	}
+	if got := strings.Join(records[2], ","); got != "数学,张老师,,true,false,2,2,1,100.0%" {
+		t.Errorf("已满课程行不正确: %s", got)
+	}
+}
+
 // TestFullConcurrencyCourseSelection 运行一个高强度的并发测试，
 // 模拟大量学生同时抢一门容量有限的课程，以验证选课和退课操作的原子性。
 func TestFullConcurrencyCourseSelection(t *testing.T) {
@@ -243,7 +1174,7 @@ func TestFullConcurrencyCourseSelection(t *testing.T) {
 	courseName := "Concurrent Programming"
 
 	// --- 场景设置 ---
-	AddCourse(courseName, "Prof. Race", courseCapacity)
+	AddCourse(courseName, "Prof. Race", courseCapacity, 1)
 	LaunchCourse(courseName)
 
 	var wg sync.WaitGroup
@@ -260,7 +1191,7 @@ func TestFullConcurrencyCourseSelection(t *testing.T) {
 			err := SelectCourse(uid, courseName)
 			if err == nil {
 				// 选课成功，立即退课
-				_ = DropCourse(uid)
+				_ = DropCourse(uid, courseName)
 			}
 		}(i)
 	}
@@ -0,0 +1,80 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+	"strings"
+)
+
+/*
+CourseDetails describe a course to the students choosing it and play no part in selection. They
+are embedded in CourseInfo, so course_Info.json keeps them as plain fields next to the others and
+files written before they existed load with every detail empty.
+*/
+
+type Category string
+
+const (
+	CategoryNone    Category = ""
+	CategoryArts    Category = "arts"
+	CategoryScience Category = "science"
+	CategorySports  Category = "sports"
+)
+
+var categories = []Category{CategoryNone, CategoryArts, CategoryScience, CategorySports}
+
+type CourseDetails struct {
+	Description string
+	Room        string
+	Category    Category
+	Tags        []string // free-form labels, kept in the order given
+}
+
+// Validate checks the category, the only detail that cannot take any value.
+func (details *CourseDetails) Validate() error {
+	if !slices.Contains(categories, details.Category) {
+		return fmt.Errorf("unknown category %q", details.Category)
+	}
+	return nil
+}
+
+// normalize trims the tags and drops empty and repeated ones.
+func (details *CourseDetails) normalize() {
+	tags := make([]string, 0, len(details.Tags))
+	for _, tag := range details.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	details.Tags = tags
+}
+
+// SetCourseDetails replaces the details of a course, launched or not, unless it is archived.
+func SetCourseDetails(courseName string, details CourseDetails) error {
+	if err := details.Validate(); err != nil {
+		courseLogger.Log(logger.Warn, "SetCourseDetails failed: Course %s has %v", courseName, err)
+		return fmt.Errorf("course %s has %v", courseName, err)
+	}
+	details.normalize()
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	archived := false
+	exist := courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) {
+		archived = courseInfo.Archived
+		if !archived {
+			courseInfo.CourseDetails = details
+		}
+	})
+	if !exist {
+		courseLogger.Log(logger.Warn, "SetCourseDetails failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	if archived {
+		courseLogger.Log(logger.Warn, "SetCourseDetails failed: Course %s is archived", courseName)
+		return fmt.Errorf("course %s is archived", courseName)
+	}
+	courseLogger.Log(logger.Info, "Details of course %s set", courseName)
+	return nil
+}
@@ -0,0 +1,434 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Eligibility rules decide who may select a course. A Rule is a tree whose every node sets exactly
+one field: the leaves test the grade, the class or a prerequisite completed in a prior term, and
+All, Any and Not combine them. A course without a rule is open to everyone.
+The account package owns the classes, so it registers a ClassResolver instead of being imported.
+*/
+
+// ClassRef names a class as account.ClassID does, which converts to it directly.
+type ClassRef struct {
+	Grade int
+	Class int
+}
+
+func (classref ClassRef) String() string {
+	return fmt.Sprintf("%d-%d", classref.Grade, classref.Class)
+}
+
+type Rule struct {
+	All       []Rule
+	Any       []Rule
+	Not       *Rule
+	Grades    []int
+	Classes   []ClassRef
+	Completed string // name of a prerequisite course
+}
+
+// ClassResolver returns the class of uid, and false for unknown users.
+type ClassResolver func(uid string) (ClassRef, bool)
+
+var (
+	classResolver ClassResolver = func(string) (ClassRef, bool) { return ClassRef{}, false }
+	// uid -> course -> term it was completed in
+	completedMap *concurrentmap.ConcurrentMap[string, *concurrentmap.ConcurrentMap[string, string]]
+	currentTerm  string // guarded by courseMutex
+)
+
+func SetClassResolver(resolver ClassResolver) {
+	classResolver = resolver
+}
+
+func (rule *Rule) validate() error {
+	set := 0
+	for _, present := range []bool{rule.All != nil, rule.Any != nil, rule.Not != nil, rule.Grades != nil, rule.Classes != nil, rule.Completed != ""} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("every rule needs exactly one of all, any, not, grades, classes and completed")
+	}
+	if (rule.All != nil && len(rule.All) == 0) || (rule.Any != nil && len(rule.Any) == 0) ||
+		(rule.Grades != nil && len(rule.Grades) == 0) || (rule.Classes != nil && len(rule.Classes) == 0) {
+		return fmt.Errorf("all, any, grades and classes need at least one entry")
+	}
+	for i := range rule.All {
+		if err := rule.All[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range rule.Any {
+		if err := rule.Any[i].validate(); err != nil {
+			return err
+		}
+	}
+	if rule.Not != nil {
+		return rule.Not.validate()
+	}
+	return nil
+}
+
+// Describe writes the rule as a readable requirement, e.g. "grade 1 or 2 and course Go completed".
+func (rule *Rule) Describe() string {
+	switch {
+	case rule.All != nil:
+		return describeRules(rule.All, " and ")
+	case rule.Any != nil:
+		return describeRules(rule.Any, " or ")
+	case rule.Not != nil:
+		return "not " + rule.Not.describeNested()
+	case rule.Grades != nil:
+		grades := make([]string, 0, len(rule.Grades))
+		for _, grade := range rule.Grades {
+			grades = append(grades, fmt.Sprint(grade))
+		}
+		return "grade " + strings.Join(grades, " or ")
+	case rule.Classes != nil:
+		classes := make([]string, 0, len(rule.Classes))
+		for _, classref := range rule.Classes {
+			classes = append(classes, classref.String())
+		}
+		return "class " + strings.Join(classes, " or ")
+	default:
+		return fmt.Sprintf("course %s completed in a prior term", rule.Completed)
+	}
+}
+
+func (rule *Rule) describeNested() string {
+	if len(rule.All) > 1 || len(rule.Any) > 1 {
+		return "(" + rule.Describe() + ")"
+	}
+	return rule.Describe()
+}
+
+func describeRules(rules []Rule, separator string) string {
+	parts := make([]string, 0, len(rules))
+	for i := range rules {
+		parts = append(parts, rules[i].describeNested())
+	}
+	return strings.Join(parts, separator)
+}
+
+// renameCourse returns a copy of the rule with the prerequisites naming courseName pointed to
+// newName, and whether there were any.
+func (rule Rule) renameCourse(courseName string, newName string) (Rule, bool) {
+	renamed := false
+	if rule.Completed == courseName {
+		rule.Completed = newName
+		renamed = true
+	}
+	for _, children := range []*[]Rule{&rule.All, &rule.Any} {
+		if *children == nil {
+			continue
+		}
+		copied := make([]Rule, len(*children))
+		for i, child := range *children {
+			var changed bool
+			copied[i], changed = child.renameCourse(courseName, newName)
+			renamed = renamed || changed
+		}
+		*children = copied
+	}
+	if rule.Not != nil {
+		not, changed := rule.Not.renameCourse(courseName, newName)
+		rule.Not = &not
+		renamed = renamed || changed
+	}
+	return rule, renamed
+}
+
+// requires tells whether a prerequisite of the rule names courseName.
+func (rule *Rule) requires(courseName string) bool {
+	if rule.Completed == courseName {
+		return true
+	}
+	for _, children := range [][]Rule{rule.All, rule.Any} {
+		for i := range children {
+			if children[i].requires(courseName) {
+				return true
+			}
+		}
+	}
+	return rule.Not != nil && rule.Not.requires(courseName)
+}
+
+// admitsGrade tells whether some student of grade may satisfy the rule (may) and whether every
+// one does (must). A class leaf admits only part of a grade and a prerequisite depends on the student.
+func (rule *Rule) admitsGrade(grade int) (may bool, must bool) {
+	switch {
+	case rule.All != nil:
+		may, must = true, true
+		for i := range rule.All {
+			childMay, childMust := rule.All[i].admitsGrade(grade)
+			may, must = may && childMay, must && childMust
+		}
+	case rule.Any != nil:
+		for i := range rule.Any {
+			childMay, childMust := rule.Any[i].admitsGrade(grade)
+			may, must = may || childMay, must || childMust
+		}
+	case rule.Not != nil:
+		childMay, childMust := rule.Not.admitsGrade(grade)
+		may, must = !childMust, !childMay
+	case rule.Grades != nil:
+		may = slices.Contains(rule.Grades, grade)
+		must = may
+	case rule.Classes != nil:
+		may = slices.ContainsFunc(rule.Classes, func(classref ClassRef) bool { return classref.Grade == grade })
+	default:
+		may = true
+	}
+	return may, must
+}
+
+// namesClass tells whether a class leaf of the rule lists classref.
+func (rule *Rule) namesClass(classref ClassRef) bool {
+	if slices.Contains(rule.Classes, classref) {
+		return true
+	}
+	for _, children := range [][]Rule{rule.All, rule.Any} {
+		for i := range children {
+			if children[i].namesClass(classref) {
+				return true
+			}
+		}
+	}
+	return rule.Not != nil && rule.Not.namesClass(classref)
+}
+
+// namesGrades tells whether a grade or class leaf of the rule names a grade from minGrade to maxGrade.
+func (rule *Rule) namesGrades(minGrade int, maxGrade int) bool {
+	inRange := func(grade int) bool { return grade >= minGrade && grade <= maxGrade }
+	if slices.ContainsFunc(rule.Grades, inRange) ||
+		slices.ContainsFunc(rule.Classes, func(classref ClassRef) bool { return inRange(classref.Grade) }) {
+		return true
+	}
+	for _, children := range [][]Rule{rule.All, rule.Any} {
+		for i := range children {
+			if children[i].namesGrades(minGrade, maxGrade) {
+				return true
+			}
+		}
+	}
+	return rule.Not != nil && rule.Not.namesGrades(minGrade, maxGrade)
+}
+
+// evaluate returns nil when uid satisfies the rule, otherwise the requirement it misses.
+func (rule *Rule) evaluate(uid string) error {
+	switch {
+	case rule.All != nil:
+		for i := range rule.All {
+			if err := rule.All[i].evaluate(uid); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rule.Any != nil:
+		for i := range rule.Any {
+			if rule.Any[i].evaluate(uid) == nil {
+				return nil
+			}
+		}
+	case rule.Not != nil:
+		if rule.Not.evaluate(uid) != nil {
+			return nil
+		}
+	case rule.Grades != nil:
+		if classref, ok := classResolver(uid); ok {
+			for _, grade := range rule.Grades {
+				if classref.Grade == grade {
+					return nil
+				}
+			}
+		}
+	case rule.Classes != nil:
+		if classref, ok := classResolver(uid); ok {
+			for _, allowed := range rule.Classes {
+				if classref == allowed {
+					return nil
+				}
+			}
+		}
+	default:
+		if hasCompleted(uid, rule.Completed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("requires %s", rule.Describe())
+}
+
+// hasCompleted tells whether uid completed courseName before the current term. The caller holds courseMutex.
+func hasCompleted(uid string, courseName string) bool {
+	course_map, ok := completedMap.ReadPair(uid)
+	if !ok {
+		return false
+	}
+	term, ok := course_map.ReadPair(courseName)
+	return ok && (currentTerm == "" || termBefore(term, currentTerm))
+}
+
+// schoolTerm is a term written "<year>-<number>", such as "2025-1", compared as numbers so that
+// "2025-9" comes before "2025-10".
+type schoolTerm struct {
+	Year   int
+	Number int
+}
+
+var termPattern = regexp.MustCompile(`^([0-9]{4})-([1-9][0-9]?)$`)
+
+func parseTerm(term string) (schoolTerm, error) {
+	match := termPattern.FindStringSubmatch(term)
+	if match == nil {
+		return schoolTerm{}, fmt.Errorf("term %q must be written as <year>-<number>, such as 2025-1", term)
+	}
+	year, _ := strconv.Atoi(match[1])
+	number, _ := strconv.Atoi(match[2])
+	return schoolTerm{Year: year, Number: number}, nil
+}
+
+// termBefore orders terms by year, then number. Records that do not parse, written before terms
+// were checked, fall back to comparing as strings.
+func termBefore(term string, other string) bool {
+	parsed, err := parseTerm(term)
+	parsedOther, otherErr := parseTerm(other)
+	if err != nil || otherErr != nil {
+		return term < other
+	}
+	if parsed.Year != parsedOther.Year {
+		return parsed.Year < parsedOther.Year
+	}
+	return parsed.Number < parsedOther.Number
+}
+
+// checkEligibility tells whether uid may select courseInfo. The caller holds courseMutex.
+func checkEligibility(uid string, courseInfo *CourseInfo) error {
+	if courseInfo.Eligibility == nil {
+		return nil
+	}
+	if err := courseInfo.Eligibility.evaluate(uid); err != nil {
+		return fmt.Errorf("user %s is not eligible for course %s: %v", uid, courseInfo.CourseName, err)
+	}
+	return nil
+}
+
+// CheckEligibility tells whether uid may select courseName, with the reason when not.
+func CheckEligibility(uid string, courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	courseInfo, ok := courseInfoMap.ReadPair(courseName)
+	if !ok {
+		courseLogger.Log(logger.Warn, "CheckEligibility failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	return checkEligibility(uid, &courseInfo)
+}
+
+// CoursesNamingClass lists by name the courses whose eligibility names classref.
+func CoursesNamingClass(classref ClassRef) []string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	result := make([]string, 0)
+	for courseName, courseInfo := range courseInfoMap.ReadAll() {
+		if courseInfo.Eligibility != nil && courseInfo.Eligibility.namesClass(classref) {
+			result = append(result, courseName)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CoursesNamingGrades lists by name the courses whose eligibility names a grade from minGrade to
+// maxGrade, or a class of one.
+func CoursesNamingGrades(minGrade int, maxGrade int) []string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	result := make([]string, 0)
+	for courseName, courseInfo := range courseInfoMap.ReadAll() {
+		if courseInfo.Eligibility != nil && courseInfo.Eligibility.namesGrades(minGrade, maxGrade) {
+			result = append(result, courseName)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// SetCourseEligibility replaces the rule of a course, nil opening it to everyone.
+// Students already enrolled keep their seats.
+func SetCourseEligibility(courseName string, rule *Rule) error {
+	if rule != nil {
+		if err := rule.validate(); err != nil {
+			courseLogger.Log(logger.Warn, "SetCourseEligibility failed: Invalid rule for course %s: %v", courseName, err)
+			return fmt.Errorf("invalid rule for course %s: %v", courseName, err)
+		}
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if !courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) { courseInfo.Eligibility = rule }) {
+		courseLogger.Log(logger.Warn, "SetCourseEligibility failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	courseLogger.Log(logger.Info, "Eligibility of course %s set", courseName)
+	return nil
+}
+
+// SetCurrentTerm names the running term, or clears it when empty. Terms are written
+// "<year>-<number>" and compare by year, then number, so "2024-2" < "2024-10" < "2025-1", and only
+// completions of earlier terms count as prerequisites.
+func SetCurrentTerm(term string) error {
+	if term != "" {
+		if _, err := parseTerm(term); err != nil {
+			courseLogger.Log(logger.Warn, "SetCurrentTerm failed: %v", err)
+			return err
+		}
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	currentTerm = term
+	courseLogger.Log(logger.Info, "Current term set to %s", term)
+	return nil
+}
+
+func GetCurrentTerm() string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	return currentTerm
+}
+
+// RecordCompletion notes that uid completed courseName in term.
+func RecordCompletion(uid string, courseName string, term string) error {
+	if term == "" {
+		courseLogger.Log(logger.Warn, "RecordCompletion failed: Empty term for user %s", uid)
+		return fmt.Errorf("term cannot be empty")
+	}
+	if _, err := parseTerm(term); err != nil {
+		courseLogger.Log(logger.Warn, "RecordCompletion failed: %v", err)
+		return err
+	}
+	if _, ok := courseInfoMap.ReadPair(courseName); !ok {
+		courseLogger.Log(logger.Warn, "RecordCompletion failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	course_map, ok := completedMap.ReadPair(uid)
+	if !ok {
+		course_map = concurrentmap.NewConcurrentMap[string, string]()
+		completedMap.WritePair(uid, &course_map)
+	}
+	course_map.WritePair(courseName, &term)
+	courseLogger.Log(logger.Info, "User %s completed course %s in term %s", uid, courseName, term)
+	return nil
+}
@@ -0,0 +1,32 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/spreadsheet"
+	"strconv"
+)
+
+// ExportFillReport writes every course, archived ones included, with its seats and waitlist as a
+// CSV for spreadsheets, sorted by name as in GetAllCoursesInfo.
+func ExportFillReport() []byte {
+	rows := [][]string{{"course", "teacher", "category", "launched", "archived", "enrolled", "capacity", "waiting", "fill rate"}}
+	for _, courseInfo := range GetAllCoursesInfo() {
+		waitlist, _ := waitlistMap.ReadPair(courseInfo.CourseName)
+		fillRate := ""
+		if courseInfo.MaxStudents > 0 {
+			fillRate = fmt.Sprintf("%.1f%%", 100*float64(courseInfo.NowStudents)/float64(courseInfo.MaxStudents))
+		}
+		rows = append(rows, []string{
+			courseInfo.CourseName,
+			courseInfo.Teacher,
+			string(courseInfo.Category),
+			strconv.FormatBool(courseInfo.Launched),
+			strconv.FormatBool(courseInfo.Archived),
+			strconv.Itoa(courseInfo.NowStudents),
+			strconv.Itoa(courseInfo.MaxStudents),
+			strconv.Itoa(len(waitlist)),
+			fillRate,
+		})
+	}
+	return spreadsheet.EncodeCSV(rows)
+}
@@ -0,0 +1,176 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+/*
+In a lottery round SelectCourse is refused: students submit intents, which hold no seat, and once
+the round is closed or over an admin runs the draw. The draw walks the courses by name and shuffles
+the applicants of each with a generator seeded by the admin, so the same seed and intents always
+give the same allocation. Every applicant still passes the usual checks when its turn comes.
+*/
+
+// LotteryLoser is an applicant left without a seat and why.
+type LotteryLoser struct {
+	Uid    string
+	Reason string
+}
+
+type CourseDraw struct {
+	CourseName string
+	Seats      int // free seats before the draw
+	Winners    []string
+	Losers     []LotteryLoser
+}
+
+type LotteryReport struct {
+	Round   string
+	Seed    int64
+	Courses []CourseDraw
+}
+
+// SubmitIntent enters uid in the draw for courseName of the lottery round open right now.
+func SubmitIntent(uid string, courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	courseInfo, ok := courseInfoMap.ReadPair(courseName)
+	if _, launched := launchedMap.ReadPair(courseName); !ok || !launched {
+		courseLogger.Log(logger.Warn, "SubmitIntent failed: Course %s is not launched", courseName)
+		return fmt.Errorf("course %s is not launched", courseName)
+	}
+	round, err := findRound(uid, courseName, false)
+	if err == nil && (round == nil || round.Mode != AllocationLottery) {
+		err = fmt.Errorf("course %s is not allocated by lottery now, select it directly", courseName)
+	}
+	if err != nil {
+		courseLogger.Log(logger.Warn, "SubmitIntent failed: %v", err)
+		return err
+	}
+	if user_map, ok := courseUserMap.ReadPair(courseName); ok {
+		if _, enrolled := user_map.ReadPair(uid); enrolled {
+			courseLogger.Log(logger.Warn, "SubmitIntent failed: User %s has already selected course %s", uid, courseName)
+			return fmt.Errorf("user %s has already selected course %s", uid, courseName)
+		}
+	}
+	if err := checkEligibility(uid, &courseInfo); err != nil {
+		courseLogger.Log(logger.Warn, "SubmitIntent failed: %v", err)
+		return err
+	}
+	intents, _ := intentMap.ReadPair(round.Name)
+	if intents == nil {
+		intents = make(map[string][]string)
+	}
+	if slices.Contains(intents[courseName], uid) {
+		courseLogger.Log(logger.Warn, "SubmitIntent failed: User %s already applied for course %s", uid, courseName)
+		return fmt.Errorf("user %s already applied for course %s", uid, courseName)
+	}
+	// Kept sorted, so when an intent was submitted has no say in the draw.
+	applicants := append(slices.Clone(intents[courseName]), uid)
+	sort.Strings(applicants)
+	intents[courseName] = applicants
+	intentMap.WritePair(round.Name, &intents)
+	courseLogger.Log(logger.Info, "User %s applied for course %s in round %s", uid, courseName, round.Name)
+	return nil
+}
+
+// WithdrawIntent takes uid out of the draw for courseName in every round not drawn yet.
+func WithdrawIntent(uid string, courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	withdrawn := false
+	for roundName, intents := range intentMap.ReadAll() {
+		index := slices.Index(intents[courseName], uid)
+		if index < 0 {
+			continue
+		}
+		intentMap.ModifyPair(roundName, func(intents *map[string][]string) {
+			applicants := slices.Delete(slices.Clone((*intents)[courseName]), index, index+1)
+			if len(applicants) == 0 {
+				delete(*intents, courseName)
+			} else {
+				(*intents)[courseName] = applicants
+			}
+		})
+		withdrawn = true
+	}
+	if !withdrawn {
+		courseLogger.Log(logger.Warn, "WithdrawIntent failed: User %s has not applied for course %s", uid, courseName)
+		return fmt.Errorf("user %s has not applied for course %s", uid, courseName)
+	}
+	courseLogger.Log(logger.Info, "User %s withdrew from course %s", uid, courseName)
+	return nil
+}
+
+// GetUserIntents lists the courses uid applied for and not drawn yet, sorted by name.
+func GetUserIntents(uid string) []string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	result := []string{}
+	for _, intents := range intentMap.ReadAll() {
+		for courseName, applicants := range intents {
+			if slices.Contains(applicants, uid) {
+				result = append(result, courseName)
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// RunLottery draws the seats of a lottery round that is closed or over, once.
+func RunLottery(roundName string, seed int64) (*LotteryReport, error) {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	round, err := readyRound(roundName, AllocationLottery)
+	if err != nil {
+		courseLogger.Log(logger.Warn, "RunLottery failed: %v", err)
+		return nil, err
+	}
+	intents, _ := intentMap.ReadPair(roundName)
+	courseNames := make([]string, 0, len(intents))
+	for courseName := range intents {
+		courseNames = append(courseNames, courseName)
+	}
+	sort.Strings(courseNames)
+	generator := rand.New(rand.NewSource(seed))
+	report := &LotteryReport{Round: roundName, Seed: seed}
+	for _, courseName := range courseNames {
+		applicants := slices.Clone(intents[courseName])
+		generator.Shuffle(len(applicants), func(i, j int) { applicants[i], applicants[j] = applicants[j], applicants[i] })
+		courseInfo, _ := courseInfoMap.ReadPair(courseName)
+		draw := CourseDraw{CourseName: courseName, Seats: max(courseInfo.MaxStudents-courseInfo.NowStudents, 0)}
+		for _, uid := range applicants {
+			held := make(map[string]struct{})
+			if course_map, ok := userCourseMap.ReadPair(uid); ok {
+				held = course_map.ReadAll()
+			}
+			if _, enrolled := held[courseName]; enrolled {
+				draw.Losers = append(draw.Losers, LotteryLoser{Uid: uid, Reason: fmt.Sprintf("already enrolled in course %s", courseName)})
+				continue
+			}
+			courseInfo, _ = courseInfoMap.ReadPair(courseName)
+			if courseInfo.NowStudents >= courseInfo.MaxStudents {
+				draw.Losers = append(draw.Losers, LotteryLoser{Uid: uid, Reason: fmt.Sprintf("course %s is full", courseName)})
+				continue
+			}
+			if err := checkSelection(uid, held, &courseInfo); err != nil {
+				draw.Losers = append(draw.Losers, LotteryLoser{Uid: uid, Reason: err.Error()})
+				continue
+			}
+			enrollUser(uid, &courseInfo)
+			draw.Winners = append(draw.Winners, uid)
+		}
+		courseLogger.Log(logger.Info, "Lottery of round %s gave course %s to %d of %d applicants", roundName, courseName, len(draw.Winners), len(applicants))
+		report.Courses = append(report.Courses, draw)
+	}
+	round.Drawn = true
+	roundMap.WritePair(roundName, &round)
+	intentMap.DeletePair(roundName)
+	courseLogger.Log(logger.Info, "Lottery of round %s drawn with seed %d", roundName, seed)
+	return report, nil
+}
@@ -0,0 +1,38 @@
+package course
+
+import (
+	"fmt"
+	"time"
+)
+
+/*
+Notices tell a student about changes made to its courses by somebody else, such as a course being
+withdrawn while it was enrolled. They wait in a per-user inbox, persisted with the other course
+data, until the student clears them.
+*/
+
+type Notice struct {
+	Time    time.Time
+	Message string
+}
+
+// notify appends a notice to the inbox of uid. The caller holds courseMutex.
+func notify(uid string, format string, args ...any) {
+	notices, _ := noticeMap.ReadPair(uid)
+	notices = append(notices, Notice{Time: timeNow(), Message: fmt.Sprintf(format, args...)})
+	noticeMap.WritePair(uid, &notices)
+}
+
+// GetNotifications returns the notices of uid, oldest first, and empties the inbox when clear is set.
+func GetNotifications(uid string, clear bool) []Notice {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	notices, _ := noticeMap.ReadPair(uid)
+	if clear {
+		noticeMap.DeletePair(uid)
+	}
+	if notices == nil {
+		return []Notice{}
+	}
+	return notices
+}
@@ -0,0 +1,266 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+/*
+In a preference round students rank the courses they want, and once the round is closed or over an
+admin computes an assignment giving each student at most one of them. Two deterministic algorithms
+are offered, both drawing their random tie-breaks from a seed chosen by the admin:
+  - random serial dictatorship: students are shuffled, then each in turn takes its best course
+    still having a free seat;
+  - deferred acceptance: students propose down their lists and courses keep the applicants of
+    highest priority, seniors first and then by lottery number, which yields a stable matching.
+A student never gets a course it is not allowed to select, and a dry run reports the outcome and
+the fill rates without enrolling anyone.
+*/
+
+type AllocationAlgorithm string
+
+const (
+	AlgorithmSerialDictatorship AllocationAlgorithm = "serial-dictatorship"
+	AlgorithmDeferredAcceptance AllocationAlgorithm = "deferred-acceptance"
+)
+
+// Assignment is the course a student gets and its rank in the preferences, both zero for none.
+type Assignment struct {
+	Uid        string
+	CourseName string
+	Rank       int
+}
+
+type CourseFill struct {
+	CourseName string
+	Seats      int // free seats before the allocation
+	Assigned   int
+}
+
+func (fill CourseFill) FillRate() float64 {
+	if fill.Seats == 0 {
+		return 0
+	}
+	return float64(fill.Assigned) / float64(fill.Seats)
+}
+
+type AllocationReport struct {
+	Round       string
+	Algorithm   AllocationAlgorithm
+	Seed        int64
+	DryRun      bool
+	Assignments []Assignment // by uid
+	Courses     []CourseFill // by course name
+}
+
+// SubmitPreferences replaces the ranked preferences of uid in the preference round open right now,
+// which every course listed must belong to.
+func SubmitPreferences(uid string, courseNames []string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if len(courseNames) == 0 {
+		courseLogger.Log(logger.Warn, "SubmitPreferences failed: Empty preferences of user %s", uid)
+		return fmt.Errorf("preferences cannot be empty")
+	}
+	var roundName string
+	for i, courseName := range courseNames {
+		if slices.Contains(courseNames[:i], courseName) {
+			courseLogger.Log(logger.Warn, "SubmitPreferences failed: Course %s ranked twice by user %s", courseName, uid)
+			return fmt.Errorf("course %s is ranked twice", courseName)
+		}
+		courseInfo, ok := courseInfoMap.ReadPair(courseName)
+		if _, launched := launchedMap.ReadPair(courseName); !ok || !launched {
+			courseLogger.Log(logger.Warn, "SubmitPreferences failed: Course %s is not launched", courseName)
+			return fmt.Errorf("course %s is not launched", courseName)
+		}
+		round, err := findRound(uid, courseName, false)
+		if err == nil && (round == nil || round.Mode != AllocationPreference) {
+			err = fmt.Errorf("course %s is not allocated by preference now, select it directly", courseName)
+		}
+		if err == nil && roundName != "" && round.Name != roundName {
+			err = fmt.Errorf("course %s belongs to round %s instead of %s", courseName, round.Name, roundName)
+		}
+		if err == nil {
+			err = checkEligibility(uid, &courseInfo)
+		}
+		if err != nil {
+			courseLogger.Log(logger.Warn, "SubmitPreferences failed: %v", err)
+			return err
+		}
+		roundName = round.Name
+	}
+	preferences, _ := preferenceMap.ReadPair(roundName)
+	if preferences == nil {
+		preferences = make(map[string][]string)
+	}
+	preferences[uid] = slices.Clone(courseNames)
+	preferenceMap.WritePair(roundName, &preferences)
+	courseLogger.Log(logger.Info, "User %s ranked %d courses in round %s", uid, len(courseNames), roundName)
+	return nil
+}
+
+// GetUserPreferences returns the ranked preferences of uid by round, for the rounds not allocated yet.
+func GetUserPreferences(uid string) map[string][]string {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	result := make(map[string][]string)
+	for roundName, preferences := range preferenceMap.ReadAll() {
+		if courseNames, ok := preferences[uid]; ok {
+			result[roundName] = slices.Clone(courseNames)
+		}
+	}
+	return result
+}
+
+// RunAllocation assigns the seats of a preference round that is closed or over. A dry run only
+// returns the report; otherwise students are enrolled and the round cannot be allocated again.
+func RunAllocation(roundName string, algorithm AllocationAlgorithm, seed int64, dryRun bool) (*AllocationReport, error) {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if algorithm != AlgorithmSerialDictatorship && algorithm != AlgorithmDeferredAcceptance {
+		courseLogger.Log(logger.Warn, "RunAllocation failed: Unknown algorithm %q", algorithm)
+		return nil, fmt.Errorf("unknown allocation algorithm %q", algorithm)
+	}
+	round, err := readyRound(roundName, AllocationPreference)
+	if err != nil {
+		courseLogger.Log(logger.Warn, "RunAllocation failed: %v", err)
+		return nil, err
+	}
+	preferences, _ := preferenceMap.ReadPair(roundName)
+	students := make([]string, 0, len(preferences))
+	for uid := range preferences {
+		students = append(students, uid)
+	}
+	sort.Strings(students)
+	seats := make(map[string]int)
+	for _, courseNames := range preferences {
+		for _, courseName := range courseNames {
+			courseInfo, _ := courseInfoMap.ReadPair(courseName)
+			seats[courseName] = max(courseInfo.MaxStudents-courseInfo.NowStudents, 0)
+		}
+	}
+	// Random order for the dictatorship, lottery numbers for the ties of deferred acceptance.
+	order := slices.Clone(students)
+	rand.New(rand.NewSource(seed)).Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	var assigned map[string]string
+	if algorithm == AlgorithmSerialDictatorship {
+		assigned = serialDictatorship(order, preferences, seats)
+	} else {
+		assigned = deferredAcceptance(order, preferences, seats)
+	}
+
+	report := &AllocationReport{Round: roundName, Algorithm: algorithm, Seed: seed, DryRun: dryRun}
+	filled := make(map[string]int)
+	for _, uid := range students {
+		assignment := Assignment{Uid: uid}
+		if courseName, ok := assigned[uid]; ok {
+			assignment.CourseName = courseName
+			assignment.Rank = slices.Index(preferences[uid], courseName) + 1
+			filled[courseName]++
+		}
+		report.Assignments = append(report.Assignments, assignment)
+	}
+	courseNames := make([]string, 0, len(seats))
+	for courseName := range seats {
+		courseNames = append(courseNames, courseName)
+	}
+	sort.Strings(courseNames)
+	for _, courseName := range courseNames {
+		report.Courses = append(report.Courses, CourseFill{CourseName: courseName, Seats: seats[courseName], Assigned: filled[courseName]})
+	}
+	if dryRun {
+		courseLogger.Log(logger.Info, "Dry run of round %s with %s assigned %d of %d students", roundName, algorithm, len(assigned), len(students))
+		return report, nil
+	}
+	for _, assignment := range report.Assignments {
+		if assignment.CourseName == "" {
+			continue
+		}
+		courseInfo, _ := courseInfoMap.ReadPair(assignment.CourseName)
+		enrollUser(assignment.Uid, &courseInfo)
+	}
+	round.Drawn = true
+	roundMap.WritePair(roundName, &round)
+	preferenceMap.DeletePair(roundName)
+	courseLogger.Log(logger.Info, "Round %s allocated with %s and seed %d, %d of %d students assigned", roundName, algorithm, seed, len(assigned), len(students))
+	return report, nil
+}
+
+// acceptable tells whether uid may be given courseName, as SelectCourse would. The caller holds courseMutex.
+func acceptable(uid string, courseName string) bool {
+	held := make(map[string]struct{})
+	if course_map, ok := userCourseMap.ReadPair(uid); ok {
+		held = course_map.ReadAll()
+	}
+	if _, enrolled := held[courseName]; enrolled {
+		return false
+	}
+	courseInfo, _ := courseInfoMap.ReadPair(courseName)
+	return checkSelection(uid, held, &courseInfo) == nil
+}
+
+func serialDictatorship(order []string, preferences map[string][]string, seats map[string]int) map[string]string {
+	assigned := make(map[string]string)
+	taken := make(map[string]int)
+	for _, uid := range order {
+		for _, courseName := range preferences[uid] {
+			if taken[courseName] < seats[courseName] && acceptable(uid, courseName) {
+				assigned[uid] = courseName
+				taken[courseName]++
+				break
+			}
+		}
+	}
+	return assigned
+}
+
+func deferredAcceptance(order []string, preferences map[string][]string, seats map[string]int) map[string]string {
+	lottery := make(map[string]int, len(order))
+	grades := make(map[string]int, len(order))
+	for number, uid := range order {
+		lottery[uid] = number
+		if classref, ok := classResolver(uid); ok {
+			grades[uid] = classref.Grade
+		}
+	}
+	// before tells whether a has priority over b at every course.
+	before := func(a string, b string) bool {
+		if grades[a] != grades[b] {
+			return grades[a] > grades[b]
+		}
+		return lottery[a] < lottery[b]
+	}
+	next := make(map[string]int)      // uid -> index of the next course to propose to
+	held := make(map[string][]string) // course -> tentatively accepted students
+	free := slices.Clone(order)
+	for len(free) > 0 {
+		uid := free[0]
+		free = free[1:]
+		for next[uid] < len(preferences[uid]) {
+			courseName := preferences[uid][next[uid]]
+			next[uid]++
+			if seats[courseName] == 0 || !acceptable(uid, courseName) {
+				continue
+			}
+			applicants := append(slices.Clone(held[courseName]), uid)
+			sort.Slice(applicants, func(i, j int) bool { return before(applicants[i], applicants[j]) })
+			if len(applicants) > seats[courseName] {
+				rejected := applicants[len(applicants)-1]
+				applicants = applicants[:len(applicants)-1]
+				free = append(free, rejected)
+			}
+			held[courseName] = applicants
+			break
+		}
+	}
+	assigned := make(map[string]string)
+	for courseName, applicants := range held {
+		for _, uid := range applicants {
+			assigned[uid] = courseName
+		}
+	}
+	return assigned
+}
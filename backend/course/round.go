@@ -0,0 +1,241 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+	"sort"
+	"time"
+)
+
+/*
+A selection round opens a set of courses to a set of grades between Start and End, with its own
+windows for selecting and for dropping inside that span. Until the first round is created
+selection stays open whenever a course is launched, as it always was; from then on SelectCourse,
+JoinWaitlist and DropCourse need an open round covering the course and the grade of the student.
+Lottery rounds take intents instead of selections, see lottery.go, and preference rounds take
+ranked preferences, see preference.go.
+*/
+
+// AllocationMode decides how a round hands out seats.
+type AllocationMode string
+
+const (
+	AllocationFirstCome  AllocationMode = ""           // SelectCourse takes a seat at once
+	AllocationLottery    AllocationMode = "lottery"    // intents are drawn once the round is over
+	AllocationPreference AllocationMode = "preference" // ranked preferences are matched once the round is over
+)
+
+// Window is a span of time, Start included and End excluded. A zero window never opens.
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (window Window) contains(t time.Time) bool {
+	return !window.Start.IsZero() && !t.Before(window.Start) && t.Before(window.End)
+}
+
+type Round struct {
+	Name    string
+	Start   time.Time
+	End     time.Time
+	Courses []string // empty for every course
+	Grades  []int    // empty for every grade
+	Select  Window
+	Drop    Window
+	Mode    AllocationMode
+	Closed  bool
+	Drawn   bool // seats of a lottery or preference round are allocated
+}
+
+// timeNow is replaced in tests to move the clock.
+var timeNow = time.Now
+
+func (round *Round) validate() error {
+	if round.Name == "" {
+		return fmt.Errorf("round name cannot be empty")
+	}
+	if round.Mode != AllocationFirstCome && round.Mode != AllocationLottery && round.Mode != AllocationPreference {
+		return fmt.Errorf("unknown allocation mode %q", round.Mode)
+	}
+	if !round.Start.Before(round.End) {
+		return fmt.Errorf("round %s must start before it ends", round.Name)
+	}
+	for _, window := range []struct {
+		name   string
+		window Window
+	}{{"selection", round.Select}, {"drop", round.Drop}} {
+		if window.window == (Window{}) {
+			continue
+		}
+		if !window.window.Start.Before(window.window.End) {
+			return fmt.Errorf("%s window of round %s must start before it ends", window.name, round.Name)
+		}
+		if window.window.Start.Before(round.Start) || window.window.End.After(round.End) {
+			return fmt.Errorf("%s window of round %s must lie within the round", window.name, round.Name)
+		}
+	}
+	for _, courseName := range round.Courses {
+		courseInfo, ok := courseInfoMap.ReadPair(courseName)
+		if !ok {
+			return fmt.Errorf("course %s does not exist", courseName)
+		}
+		if courseInfo.Archived {
+			return fmt.Errorf("course %s is archived", courseName)
+		}
+	}
+	return nil
+}
+
+// covers tells whether the round applies to courseName for a student of grade, known or not.
+func (round *Round) covers(courseName string, grade int, gradeKnown bool) bool {
+	if len(round.Courses) > 0 && !slices.Contains(round.Courses, courseName) {
+		return false
+	}
+	return len(round.Grades) == 0 || (gradeKnown && slices.Contains(round.Grades, grade))
+}
+
+func CreateRound(round Round) error {
+	if err := round.validate(); err != nil {
+		courseLogger.Log(logger.Warn, "CreateRound failed: %v", err)
+		return err
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if _, exist := roundMap.ReadPair(round.Name); exist {
+		courseLogger.Log(logger.Warn, "CreateRound failed: Round %s already exists", round.Name)
+		return fmt.Errorf("round %s already exists", round.Name)
+	}
+	round.Closed = false
+	round.Drawn = false
+	roundMap.WritePair(round.Name, &round)
+	courseLogger.Log(logger.Info, "Round %s created, running from %s to %s", round.Name, round.Start.Format(time.RFC3339), round.End.Format(time.RFC3339))
+	return nil
+}
+
+// ModifyRound replaces every setting of an existing round that is not closed yet.
+func ModifyRound(round Round) error {
+	if err := round.validate(); err != nil {
+		courseLogger.Log(logger.Warn, "ModifyRound failed: %v", err)
+		return err
+	}
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	old_round, exist := roundMap.ReadPair(round.Name)
+	if !exist {
+		courseLogger.Log(logger.Warn, "ModifyRound failed: Round %s does not exist", round.Name)
+		return fmt.Errorf("round %s does not exist", round.Name)
+	}
+	if old_round.Closed {
+		courseLogger.Log(logger.Warn, "ModifyRound failed: Round %s is closed", round.Name)
+		return fmt.Errorf("round %s is closed", round.Name)
+	}
+	roundMap.WritePair(round.Name, &round)
+	courseLogger.Log(logger.Info, "Round %s modified", round.Name)
+	return nil
+}
+
+// CloseRound ends a round at once, whatever its windows say.
+func CloseRound(name string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	closed := false
+	exist := roundMap.ModifyPair(name, func(round *Round) {
+		closed = round.Closed
+		round.Closed = true
+	})
+	if !exist {
+		courseLogger.Log(logger.Warn, "CloseRound failed: Round %s does not exist", name)
+		return fmt.Errorf("round %s does not exist", name)
+	}
+	if closed {
+		courseLogger.Log(logger.Warn, "CloseRound failed: Round %s is already closed", name)
+		return fmt.Errorf("round %s is already closed", name)
+	}
+	courseLogger.Log(logger.Info, "Round %s closed", name)
+	return nil
+}
+
+// GetRounds lists every round ordered by start time.
+func GetRounds() []Round {
+	all_rounds := roundMap.ReadAll()
+	result := make([]Round, 0, len(all_rounds))
+	for _, round := range all_rounds {
+		result = append(result, round)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Start.Equal(result[j].Start) {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+// readyRound returns the round roundName if its seats can be allocated now: of the given mode,
+// closed or over, and not allocated yet. The caller holds courseMutex.
+func readyRound(roundName string, mode AllocationMode) (Round, error) {
+	round, ok := roundMap.ReadPair(roundName)
+	if !ok {
+		return round, fmt.Errorf("round %s does not exist", roundName)
+	}
+	if round.Mode != mode {
+		return round, fmt.Errorf("round %s is not a %s round", roundName, mode)
+	}
+	if !round.Closed && timeNow().Before(round.End) {
+		return round, fmt.Errorf("round %s is still open", roundName)
+	}
+	if round.Drawn {
+		return round, fmt.Errorf("round %s is already allocated", roundName)
+	}
+	return round, nil
+}
+
+// findRound returns an open round letting uid select, or drop when dropping is set, courseName
+// right now, and nil while no round exists at all. The caller holds courseMutex.
+func findRound(uid string, courseName string, dropping bool) (*Round, error) {
+	all_rounds := roundMap.ReadAll()
+	if len(all_rounds) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(all_rounds))
+	for name := range all_rounds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := timeNow()
+	classref, gradeKnown := classResolver(uid)
+	for _, name := range names {
+		round := all_rounds[name]
+		if round.Closed || !round.covers(courseName, classref.Grade, gradeKnown) {
+			continue
+		}
+		window := round.Select
+		if dropping {
+			window = round.Drop
+		}
+		if window.contains(now) {
+			return &round, nil
+		}
+	}
+	if dropping {
+		return nil, fmt.Errorf("no open round allows dropping course %s now", courseName)
+	}
+	return nil, fmt.Errorf("no open round allows selecting course %s now", courseName)
+}
+
+// checkRound is findRound for first-come selections, which lottery rounds refuse. The caller holds courseMutex.
+func checkRound(uid string, courseName string, dropping bool) error {
+	round, err := findRound(uid, courseName, dropping)
+	if err != nil {
+		return err
+	}
+	if round != nil && !dropping && round.Mode == AllocationLottery {
+		return fmt.Errorf("course %s is allocated by lottery in round %s, submit an intent instead", courseName, round.Name)
+	}
+	if round != nil && !dropping && round.Mode == AllocationPreference {
+		return fmt.Errorf("course %s is allocated by preference in round %s, submit preferences instead", courseName, round.Name)
+	}
+	return nil
+}
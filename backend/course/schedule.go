@@ -0,0 +1,73 @@
+package course
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TimeSlot is one weekly meeting of a course: Day 1 (Monday) to 7, periods and weeks of term both inclusive.
+type TimeSlot struct {
+	Day         int
+	StartPeriod int
+	EndPeriod   int
+	FirstWeek   int
+	LastWeek    int
+}
+
+func (slot TimeSlot) String() string {
+	return fmt.Sprintf("day %d periods %d-%d weeks %d-%d", slot.Day, slot.StartPeriod, slot.EndPeriod, slot.FirstWeek, slot.LastWeek)
+}
+
+func (slot TimeSlot) validate() error {
+	if slot.Day < 1 || slot.Day > 7 {
+		return fmt.Errorf("invalid day %d, expecting 1 to 7", slot.Day)
+	}
+	if slot.StartPeriod < 1 || slot.EndPeriod < slot.StartPeriod {
+		return fmt.Errorf("invalid periods %d-%d", slot.StartPeriod, slot.EndPeriod)
+	}
+	if slot.FirstWeek < 1 || slot.LastWeek < slot.FirstWeek {
+		return fmt.Errorf("invalid weeks %d-%d", slot.FirstWeek, slot.LastWeek)
+	}
+	return nil
+}
+
+// Overlaps reports whether both slots meet on the same day, in a common week and a common period.
+func (slot TimeSlot) Overlaps(other TimeSlot) bool {
+	return slot.Day == other.Day &&
+		slot.StartPeriod <= other.EndPeriod && other.StartPeriod <= slot.EndPeriod &&
+		slot.FirstWeek <= other.LastWeek && other.FirstWeek <= slot.LastWeek
+}
+
+func validateSlots(slots []TimeSlot) error {
+	for i, slot := range slots {
+		if err := slot.validate(); err != nil {
+			return err
+		}
+		for _, other := range slots[:i] {
+			if slot.Overlaps(other) {
+				return fmt.Errorf("slots %s and %s overlap", other, slot)
+			}
+		}
+	}
+	return nil
+}
+
+// checkScheduleConflict names the first course in held, by name, meeting at the same time as courseInfo.
+func checkScheduleConflict(held map[string]struct{}, courseInfo *CourseInfo) error {
+	heldCourses := make([]string, 0, len(held))
+	for heldCourse := range held {
+		heldCourses = append(heldCourses, heldCourse)
+	}
+	sort.Strings(heldCourses)
+	for _, heldCourse := range heldCourses {
+		heldInfo, _ := courseInfoMap.ReadPair(heldCourse)
+		for _, slot := range courseInfo.Slots {
+			for _, heldSlot := range heldInfo.Slots {
+				if slot.Overlaps(heldSlot) {
+					return fmt.Errorf("course %s conflicts with course %s on %s", courseInfo.CourseName, heldCourse, heldSlot)
+				}
+			}
+		}
+	}
+	return nil
+}
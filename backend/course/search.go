@@ -0,0 +1,164 @@
+package course
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+SearchCourses filters and sorts the catalogue and returns it a page at a time. Pages are cut by a
+cursor carrying the sort key and the name of the last course returned rather than by an offset,
+so in the name sort courses appearing or leaving between two requests never make a page repeat or
+skip another. The seats and popularity keys move as students enroll, though: a course whose key
+changes between two requests may cross the cursor and show on two pages or on none.
+*/
+
+type CourseSortKey string
+
+const (
+	SortByName       CourseSortKey = "name"       // A to Z
+	SortBySeats      CourseSortKey = "seats"      // most free seats first
+	SortByPopularity CourseSortKey = "popularity" // most students enrolled and waiting first
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type CourseQuery struct {
+	Text            string     // case-insensitive, in the name, the teacher or the description
+	Teacher         string     // exact, case-insensitive
+	Categories      []Category // empty for any
+	Launched        *bool      // nil for both
+	HasSeats        bool
+	EligibleFor     string // uid whose eligibility the courses must satisfy, empty for anybody
+	Grade           int    // grade some of whose students the rule may admit, 0 for any
+	IncludeArchived bool
+	Sort            CourseSortKey // empty for SortByName
+	Cursor          string        // NextCursor of the previous page, empty for the first
+	Limit           int           // 0 for defaultPageSize, at most maxPageSize
+}
+
+type CoursePage struct {
+	Courses    []CourseInfo
+	Total      int    // courses matching the query on every page
+	NextCursor string // empty on the last page
+}
+
+// courseCursor marks where a page ended.
+type courseCursor struct {
+	Sort CourseSortKey `json:"s"`
+	Key  int           `json:"k"`
+	Name string        `json:"n"`
+}
+
+func SearchCourses(query CourseQuery) (*CoursePage, error) {
+	if query.Sort == "" {
+		query.Sort = SortByName
+	}
+	if query.Sort != SortByName && query.Sort != SortBySeats && query.Sort != SortByPopularity {
+		courseLogger.Log(logger.Warn, "SearchCourses failed: Unknown sort key %q", query.Sort)
+		return nil, fmt.Errorf("unknown sort key %q", query.Sort)
+	}
+	if query.Limit < 0 || query.Limit > maxPageSize {
+		courseLogger.Log(logger.Warn, "SearchCourses failed: Page size %d out of range", query.Limit)
+		return nil, fmt.Errorf("page size must be between 1 and %d", maxPageSize)
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultPageSize
+	}
+	var after *courseCursor
+	if query.Cursor != "" {
+		after = &courseCursor{}
+		content, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+		if err == nil {
+			err = json.Unmarshal(content, after)
+		}
+		if err != nil || after.Sort != query.Sort {
+			courseLogger.Log(logger.Warn, "SearchCourses failed: Invalid cursor %q", query.Cursor)
+			return nil, fmt.Errorf("invalid cursor")
+		}
+	}
+	text := strings.ToLower(query.Text)
+
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	type match struct {
+		info CourseInfo
+		key  int
+	}
+	matches := make([]match, 0)
+	for _, courseInfo := range courseInfoMap.ReadAll() {
+		if courseInfo.Archived && !query.IncludeArchived {
+			continue
+		}
+		if text != "" && !strings.Contains(strings.ToLower(courseInfo.CourseName), text) &&
+			!strings.Contains(strings.ToLower(courseInfo.Teacher), text) &&
+			!strings.Contains(strings.ToLower(courseInfo.Description), text) {
+			continue
+		}
+		if query.Teacher != "" && !strings.EqualFold(courseInfo.Teacher, query.Teacher) {
+			continue
+		}
+		if len(query.Categories) > 0 && !slices.Contains(query.Categories, courseInfo.Category) {
+			continue
+		}
+		if query.Launched != nil && courseInfo.Launched != *query.Launched {
+			continue
+		}
+		if query.HasSeats && courseInfo.NowStudents >= courseInfo.MaxStudents {
+			continue
+		}
+		if query.EligibleFor != "" && checkEligibility(query.EligibleFor, &courseInfo) != nil {
+			continue
+		}
+		if query.Grade != 0 && courseInfo.Eligibility != nil {
+			if may, _ := courseInfo.Eligibility.admitsGrade(query.Grade); !may {
+				continue
+			}
+		}
+		var key int
+		switch query.Sort {
+		case SortBySeats:
+			key = courseInfo.MaxStudents - courseInfo.NowStudents
+		case SortByPopularity:
+			waitlist, _ := waitlistMap.ReadPair(courseInfo.CourseName)
+			key = courseInfo.NowStudents + len(waitlist)
+		}
+		matches = append(matches, match{info: courseInfo, key: key})
+	}
+	// Larger keys come first, and names settle ties so the order is total.
+	before := func(key int, name string, otherKey int, otherName string) bool {
+		if key != otherKey {
+			return key > otherKey
+		}
+		return name < otherName
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return before(matches[i].key, matches[i].info.CourseName, matches[j].key, matches[j].info.CourseName)
+	})
+
+	page := &CoursePage{Courses: []CourseInfo{}, Total: len(matches)}
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matches), func(i int) bool {
+			return before(after.Key, after.Name, matches[i].key, matches[i].info.CourseName)
+		})
+	}
+	end := min(start+query.Limit, len(matches))
+	for _, m := range matches[start:end] {
+		page.Courses = append(page.Courses, m.info)
+	}
+	if end < len(matches) {
+		last := matches[end-1]
+		content, _ := json.Marshal(courseCursor{Sort: query.Sort, Key: last.key, Name: last.info.CourseName})
+		page.NextCursor = base64.RawURLEncoding.EncodeToString(content)
+	}
+	return page, nil
+}
@@ -0,0 +1,144 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+)
+
+/*
+A full launched course keeps an ordered waitlist. Whenever a seat frees up, by DropCourse or by
+ResizeCourse raising MaxStudents, the first waiting student who is eligible, within the selection
+limit and free at that time is enrolled. Students kept out stay in place, so they move up once they drop elsewhere.
+Every function here holds courseMutex, like SelectCourse and DropCourse.
+*/
+
+func JoinWaitlist(uid string, courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if _, exist := launchedMap.ReadPair(courseName); !exist {
+		courseLogger.Log(logger.Warn, "JoinWaitlist failed: Course %s is not launched", courseName)
+		return fmt.Errorf("course %s is not launched", courseName)
+	}
+	if err := checkRound(uid, courseName, false); err != nil {
+		courseLogger.Log(logger.Warn, "JoinWaitlist failed: %v", err)
+		return err
+	}
+	if user_map, ok := courseUserMap.ReadPair(courseName); ok {
+		if _, enrolled := user_map.ReadPair(uid); enrolled {
+			courseLogger.Log(logger.Warn, "JoinWaitlist failed: User %s has already selected course %s", uid, courseName)
+			return fmt.Errorf("user %s has already selected course %s", uid, courseName)
+		}
+	}
+	courseInfo, _ := courseInfoMap.ReadPair(courseName)
+	if courseInfo.NowStudents < courseInfo.MaxStudents {
+		courseLogger.Log(logger.Warn, "JoinWaitlist failed: Course %s still has seats", courseName)
+		return fmt.Errorf("course %s still has seats, select it directly", courseName)
+	}
+	waitlist, _ := waitlistMap.ReadPair(courseName)
+	if slices.Contains(waitlist, uid) {
+		courseLogger.Log(logger.Warn, "JoinWaitlist failed: User %s is already waiting for course %s", uid, courseName)
+		return fmt.Errorf("user %s is already waiting for course %s", uid, courseName)
+	}
+	waitlist = append(waitlist, uid)
+	waitlistMap.WritePair(courseName, &waitlist)
+	courseLogger.Log(logger.Info, "User %s joined the waitlist of course %s at position %d", uid, courseName, len(waitlist))
+	return nil
+}
+
+func LeaveWaitlist(uid string, courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if !removeFromWaitlist(uid, courseName) {
+		courseLogger.Log(logger.Warn, "LeaveWaitlist failed: User %s is not waiting for course %s", uid, courseName)
+		return fmt.Errorf("user %s is not waiting for course %s", uid, courseName)
+	}
+	courseLogger.Log(logger.Info, "User %s left the waitlist of course %s", uid, courseName)
+	return nil
+}
+
+// GetWaitlistPosition returns the 1-based position of uid in the waitlist of courseName.
+func GetWaitlistPosition(uid string, courseName string) (int, error) {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	waitlist, _ := waitlistMap.ReadPair(courseName)
+	index := slices.Index(waitlist, uid)
+	if index < 0 {
+		courseLogger.Log(logger.Warn, "GetWaitlistPosition failed: User %s is not waiting for course %s", uid, courseName)
+		return 0, fmt.Errorf("user %s is not waiting for course %s", uid, courseName)
+	}
+	return index + 1, nil
+}
+
+// GetWaitlistLength returns how many students wait for courseName.
+func GetWaitlistLength(courseName string) int {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	waitlist, _ := waitlistMap.ReadPair(courseName)
+	return len(waitlist)
+}
+
+// ResizeCourse changes the capacity of a course, launched or not but not archived, and fills new seats from the waitlist.
+// It cannot go below the students already enrolled.
+func ResizeCourse(courseName string, MaxStudents int) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	courseInfo, ok := courseInfoMap.ReadPair(courseName)
+	if !ok {
+		courseLogger.Log(logger.Warn, "Resize failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	if courseInfo.Archived {
+		courseLogger.Log(logger.Warn, "Resize failed: Course %s is archived", courseName)
+		return fmt.Errorf("course %s is archived", courseName)
+	}
+	if MaxStudents < courseInfo.NowStudents {
+		courseLogger.Log(logger.Warn, "Resize failed: Course %s already has %d students", courseName, courseInfo.NowStudents)
+		return fmt.Errorf("course %s already has %d students", courseName, courseInfo.NowStudents)
+	}
+	courseInfo.MaxStudents = MaxStudents
+	courseInfoMap.WritePair(courseName, &courseInfo)
+	courseLogger.Log(logger.Info, "Course %s resized to %d seats", courseName, MaxStudents)
+	promoteWaitlist(courseName)
+	return nil
+}
+
+// promoteWaitlist enrolls waiting students into the free seats of courseName. The caller holds courseMutex.
+func promoteWaitlist(courseName string) {
+	waitlist, _ := waitlistMap.ReadPair(courseName)
+	for _, uid := range waitlist {
+		courseInfo, ok := courseInfoMap.ReadPair(courseName)
+		if !ok || courseInfo.NowStudents >= courseInfo.MaxStudents {
+			return
+		}
+		held := make(map[string]struct{})
+		if course_map, ok := userCourseMap.ReadPair(uid); ok {
+			held = course_map.ReadAll()
+		}
+		if err := checkSelection(uid, held, &courseInfo); err != nil {
+			courseLogger.Log(logger.Info, "Waitlist of course %s skipped user %s: %v", courseName, uid, err)
+			continue
+		}
+		enrollUser(uid, &courseInfo)
+		courseLogger.Log(logger.Info, "User %s promoted from the waitlist into course %s", uid, courseName)
+	}
+}
+
+// removeFromWaitlist reports whether uid was waiting for courseName. The caller holds courseMutex.
+func removeFromWaitlist(uid string, courseName string) bool {
+	waitlist, ok := waitlistMap.ReadPair(courseName)
+	if !ok {
+		return false
+	}
+	index := slices.Index(waitlist, uid)
+	if index < 0 {
+		return false
+	}
+	waitlist = slices.Delete(slices.Clone(waitlist), index, index+1)
+	if len(waitlist) == 0 {
+		waitlistMap.DeletePair(courseName)
+	} else {
+		waitlistMap.WritePair(courseName, &waitlist)
+	}
+	return true
+}
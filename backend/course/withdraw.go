@@ -0,0 +1,158 @@
+package course
+
+import (
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"slices"
+	"sort"
+	"strings"
+)
+
+/*
+A course leaves the catalogue in three steps. UnlaunchCourse closes selection; it refuses while
+students are enrolled unless asked to cascade, in which case their seats are dropped and they get a
+notice. ArchiveCourse then retires a course that is not launched: it stays in course_Info.json, so
+completions and old rounds keep pointing at something, but it can no longer be launched, modified
+or scheduled. RemoveCourse deletes a course for good and is only meant for mistakes: the course must
+not be launched, or launched with nobody in it, nobody may have completed it and no other course may
+require it.
+*/
+
+// UnlaunchCourse closes a launched course and returns the students it dropped, sorted.
+// Without cascade it refuses while anybody is enrolled.
+func UnlaunchCourse(courseName string, cascade bool) ([]string, error) {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	user_map, ok := courseUserMap.ReadPair(courseName)
+	if _, launched := launchedMap.ReadPair(courseName); !launched || !ok {
+		courseLogger.Log(logger.Warn, "Unlaunch failed: Course %s is not launched", courseName)
+		return nil, fmt.Errorf("course %s is not launched", courseName)
+	}
+	dropped := make([]string, 0)
+	for uid := range user_map.ReadAll() {
+		dropped = append(dropped, uid)
+	}
+	sort.Strings(dropped)
+	if len(dropped) > 0 && !cascade {
+		courseLogger.Log(logger.Warn, "Unlaunch failed: Course %s still has %d students", courseName, len(dropped))
+		return nil, fmt.Errorf("course %s still has %d students, drop them first or cascade", courseName, len(dropped))
+	}
+	for _, uid := range dropped {
+		removeUserCourse(uid, courseName)
+		notify(uid, "Course %s was withdrawn and your enrollment in it was dropped", courseName)
+	}
+	unlaunch(courseName)
+	courseLogger.Log(logger.Info, "Course %s unlaunched, %d students dropped", courseName, len(dropped))
+	return dropped, nil
+}
+
+// ArchiveCourse retires a course that is not launched, keeping it for history.
+func ArchiveCourse(courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if _, launched := launchedMap.ReadPair(courseName); launched {
+		courseLogger.Log(logger.Warn, "Archive failed: Course %s is launched", courseName)
+		return fmt.Errorf("course %s is launched, unlaunch it first", courseName)
+	}
+	archived := false
+	exist := courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) {
+		archived = courseInfo.Archived
+		courseInfo.Archived = true
+	})
+	if !exist {
+		courseLogger.Log(logger.Warn, "Archive failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	if archived {
+		courseLogger.Log(logger.Warn, "Archive failed: Course %s is already archived", courseName)
+		return fmt.Errorf("course %s is already archived", courseName)
+	}
+	courseLogger.Log(logger.Info, "Course %s archived", courseName)
+	return nil
+}
+
+// RemoveCourse deletes a course that is not launched or has nobody enrolled, that nobody completed
+// and that no other course names as a prerequisite.
+func RemoveCourse(courseName string) error {
+	courseMutex.Lock()
+	defer courseMutex.Unlock()
+	if _, ok := courseInfoMap.ReadPair(courseName); !ok {
+		courseLogger.Log(logger.Warn, "Removal failed: Course %s does not exist", courseName)
+		return fmt.Errorf("course %s does not exist", courseName)
+	}
+	if user_map, ok := courseUserMap.ReadPair(courseName); ok && len(user_map.ReadAll()) > 0 {
+		courseLogger.Log(logger.Warn, "Removal failed: Course %s still has students", courseName)
+		return fmt.Errorf("course %s still has students, unlaunch it first", courseName)
+	}
+	for uid, course_map := range completedMap.ReadAll() {
+		if _, ok := course_map.ReadPair(courseName); ok {
+			courseLogger.Log(logger.Warn, "Removal failed: User %s completed course %s", uid, courseName)
+			return fmt.Errorf("course %s has completion records, archive it instead", courseName)
+		}
+	}
+	dependents := make([]string, 0)
+	for otherName, otherInfo := range courseInfoMap.ReadAll() {
+		if otherName != courseName && otherInfo.Eligibility != nil && otherInfo.Eligibility.requires(courseName) {
+			dependents = append(dependents, otherName)
+		}
+	}
+	if len(dependents) > 0 {
+		sort.Strings(dependents)
+		courseLogger.Log(logger.Warn, "Removal failed: Course %s is a prerequisite of %s", courseName, strings.Join(dependents, ", "))
+		return fmt.Errorf("course %s is a prerequisite of %s, change their eligibility first", courseName, strings.Join(dependents, ", "))
+	}
+	now := timeNow()
+	for name, round := range roundMap.ReadAll() {
+		if !round.Closed && now.Before(round.End) && slices.Contains(round.Courses, courseName) {
+			courseLogger.Log(logger.Warn, "Removal failed: Course %s is part of round %s", courseName, name)
+			return fmt.Errorf("course %s is part of round %s", courseName, name)
+		}
+	}
+	if _, launched := launchedMap.ReadPair(courseName); launched {
+		unlaunch(courseName)
+	}
+	courseInfoMap.DeletePair(courseName)
+	courseLogger.Log(logger.Info, "Course %s removed", courseName)
+	return nil
+}
+
+// unlaunch takes an empty roster offline and forgets the waitlist, intents and preferences naming
+// the course, telling the students concerned. The caller holds courseMutex.
+func unlaunch(courseName string) {
+	waitlist, _ := waitlistMap.ReadPair(courseName)
+	for _, uid := range waitlist {
+		notify(uid, "Course %s was withdrawn and you left its waitlist", courseName)
+	}
+	waitlistMap.DeletePair(courseName)
+	for roundName, intents := range intentMap.ReadAll() {
+		if _, ok := intents[courseName]; !ok {
+			continue
+		}
+		for _, uid := range intents[courseName] {
+			notify(uid, "Course %s was withdrawn and your intent for it was dropped", courseName)
+		}
+		intentMap.ModifyPair(roundName, func(intents *map[string][]string) { delete(*intents, courseName) })
+	}
+	for roundName, preferences := range preferenceMap.ReadAll() {
+		for uid, courseNames := range preferences {
+			index := slices.Index(courseNames, courseName)
+			if index < 0 {
+				continue
+			}
+			notify(uid, "Course %s was withdrawn and left your preferences", courseName)
+			preferenceMap.ModifyPair(roundName, func(preferences *map[string][]string) {
+				if rest := slices.Delete(slices.Clone(courseNames), index, index+1); len(rest) > 0 {
+					(*preferences)[uid] = rest
+				} else {
+					delete(*preferences, uid)
+				}
+			})
+		}
+	}
+	courseUserMap.DeletePair(courseName)
+	launchedMap.DeletePair(courseName)
+	courseInfoMap.ModifyPair(courseName, func(courseInfo *CourseInfo) {
+		courseInfo.Launched = false
+		courseInfo.NowStudents = 0
+	})
+}
@@ -3,22 +3,140 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/TOmorrowarc1/ClassSelectionSystem/account"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/audit"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/spreadsheet"
 )
 
 var (
 	system_logger *logger.Logger
 )
 
+// Sessions survive restarts so a deploy does not log the whole school out.
+const sessionsPath = "data/sessions.json"
+
+const signingKeysEnv = "TOKEN_SIGNING_KEYS"
+
+// An optional capability -> roles file overriding privilege.DefaultPermissionPolicy.
+const permissionsPath = "data/permissions.json"
+
+// actionCapabilities lists the capability each action requires. Actions missing here, such as
+// LogIn or ModifyPassword, only concern the caller itself and are open to everyone logged in.
+var actionCapabilities = map[string]string{
+	"Register":             privilege.CapabilityUserCreate,
+	"Remove":               privilege.CapabilityUserRemove,
+	"ResetPassword":        privilege.CapabilityUserResetPassword,
+	"ListSessions":         privilege.CapabilitySessionRead,
+	"RevokeSessions":       privilege.CapabilitySessionRevoke,
+	"GetUserInfo":          privilege.CapabilityUserRead,
+	"GetAllUsersInfo":      privilege.CapabilityUserReadAll,
+	"SetHomeroomTeacher":   privilege.CapabilityClassHomeroom,
+	"AddCourse":            privilege.CapabilityCourseCreate,
+	"ModifyCourse":         privilege.CapabilityCourseModify,
+	"LaunchCourse":         privilege.CapabilityCourseLaunch,
+	"GetAllCoursesInfo":    privilege.CapabilityCourseRead,
+	"SelectCourse":         privilege.CapabilityCourseSelect,
+	"DropCourse":           privilege.CapabilityCourseDrop,
+	"SetSelectionLimit":    privilege.CapabilityCourseLimit,
+	"ResizeCourse":         privilege.CapabilityCourseModify,
+	"JoinWaitlist":         privilege.CapabilityCourseWaitlist,
+	"LeaveWaitlist":        privilege.CapabilityCourseWaitlist,
+	"GetWaitlistPosition":  privilege.CapabilityCourseWaitlist,
+	"SetCourseEligibility": privilege.CapabilityCourseModify,
+	"SetCurrentTerm":       privilege.CapabilityCourseTerm,
+	"RecordCompletion":     privilege.CapabilityCourseTerm,
+	"CreateRound":          privilege.CapabilityCourseRound,
+	"ModifyRound":          privilege.CapabilityCourseRound,
+	"CloseRound":           privilege.CapabilityCourseRound,
+	"GetRounds":            privilege.CapabilityCourseRead,
+	"SubmitIntent":         privilege.CapabilityCourseIntent,
+	"WithdrawIntent":       privilege.CapabilityCourseIntent,
+	"GetIntents":           privilege.CapabilityCourseIntent,
+	"RunLottery":           privilege.CapabilityCourseRound,
+	"SubmitPreferences":    privilege.CapabilityCourseIntent,
+	"GetPreferences":       privilege.CapabilityCourseIntent,
+	"RunAllocation":        privilege.CapabilityCourseRound,
+	"UnlaunchCourse":       privilege.CapabilityCourseLaunch,
+	"ArchiveCourse":        privilege.CapabilityCourseRemove,
+	"RemoveCourse":         privilege.CapabilityCourseRemove,
+	"SearchCourses":        privilege.CapabilityCourseRead,
+	"SearchUsers":          privilege.CapabilityUserReadAll,
+	"ImportUsers":          privilege.CapabilityUserCreate,
+	"ModifyUser":           privilege.CapabilityUserModify,
+	"PromoteStudents":      privilege.CapabilityUserPromote,
+	"GetAuditLog":          privilege.CapabilityAuditRead,
+	"CreateClass":          privilege.CapabilityClassManage,
+	"ModifyClass":          privilege.CapabilityClassManage,
+	"RenameClass":          privilege.CapabilityClassManage,
+	"DeleteClass":          privilege.CapabilityClassManage,
+	"GetClasses":           privilege.CapabilityClassRead,
+	"SetUserRole":          privilege.CapabilityUserModify,
+}
+
+// requiredCapability resolves the capability of a request, GetPartUsersInfo depending on its way
+// and ExportReport on its report.
+func requiredCapability(action string, parameters json.RawMessage) (string, bool) {
+	if action == "ExportReport" {
+		var params struct {
+			Report string `json:"report"`
+		}
+		json.Unmarshal(parameters, &params)
+		switch params.Report {
+		case "class":
+			return privilege.CapabilityUserReadClass, true
+		case "course":
+			return privilege.CapabilityUserReadCourse, true
+		default:
+			return privilege.CapabilityCourseRead, true
+		}
+	}
+	if action == "GetPartUsersInfo" {
+		var params struct {
+			Way int `json:"way"`
+		}
+		json.Unmarshal(parameters, &params)
+		if params.Way == 1 {
+			return privilege.CapabilityUserReadCourse, true
+		}
+		return privilege.CapabilityUserReadClass, true
+	}
+	capability, ok := actionCapabilities[action]
+	return capability, ok
+}
+
+// roleOf returns the role accountInfo is authorized as. Sessions stored before roles existed
+// have none and fall back to the name of their privilege.
+func roleOf(accountInfo privilege.AccountInfo) string {
+	if accountInfo.Role != "" {
+		return accountInfo.Role
+	}
+	return account.PrivilegeToString(accountInfo.Privilege)
+}
+
+// canReadAnyUser tells whether accountInfo may skip the ownership checks on user listings.
+func canReadAnyUser(accountInfo privilege.AccountInfo) bool {
+	return privilege.Authorize(roleOf(accountInfo), privilege.CapabilityUserReadAny)
+}
+
+func writeErrorMessage(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"errorMessage"`
+	}{message})
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// 这是我们梦寐以求的日志！它会在任何路由逻辑之前执行。
@@ -37,6 +155,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5500")
 			w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
 
 			// 如果是预检请求，直接响应并返回
 			if r.Method == "OPTIONS" {
@@ -55,10 +174,20 @@ func main() {
 	system_logger.SetLogFile("system.log")
 	system_logger.SetLogLevel(logger.Debug)
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
 	system_logger.Log(logger.Info, "System starting...")
 	account.InitAccountSystem()
 	course.InitCourseSystem()
+	privilege.SetSessionStore(privilege.NewFileSessionStore(sessionsPath))
+	configureSigningKeys()
 	privilege.InitPrivilegeSystem()
+	if _, err := os.Stat(permissionsPath); err == nil {
+		if err = privilege.LoadPermissionPolicy(permissionsPath); err != nil {
+			system_logger.Log(logger.Error, "Failed to load permission policy: %v", err)
+		}
+	}
 	system_logger.Log(logger.Info, "All systems initialized.")
 
 	mux := http.NewServeMux()
@@ -73,7 +202,7 @@ func main() {
 
 	go func() {
 		system_logger.Log(logger.Info, "Starting HTTP server on :8080")
-		if err := server.ListenAndServe(); err != nil {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			system_logger.Log(logger.Fatal, "Failed to start server: %v", err)
 		}
 		system_logger.Log(logger.Info, "Server stopped.")
@@ -84,17 +213,44 @@ func main() {
 
 	<-quit_channel
 	system_logger.Log(logger.Warn, "Shutdown signal received. Starting graceful shutdown...")
-	account.StoreAccountData()
-	course.StoreCourseData()
-	system_logger.Log(logger.Info, "All systems closed.")
-
+	// Requests still in flight finish before the data is stored, so none of them is lost or torn.
 	shutdown_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	server.Shutdown(shutdown_ctx)
 	system_logger.Log(logger.Info, "Server gracefully stopped.")
+
+	account.StoreAccountData()
+	course.StoreCourseData()
+	privilege.StopPrivilegeSystem()
+	privilege.StorePrivilegeData()
+	system_logger.Log(logger.Info, "All systems closed.")
 	system_logger.Close()
 }
 
+// configureSigningKeys switches to signed tokens when TOKEN_SIGNING_KEYS holds "kid:secret" pairs
+// separated by commas, the first one signing and the rest only verifying, so that several
+// instances behind a load balancer accept each other's tokens.
+func configureSigningKeys() {
+	setting := os.Getenv(signingKeysEnv)
+	if setting == "" {
+		return
+	}
+	var keys []privilege.SigningKey
+	for _, pair := range strings.Split(setting, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || id == "" || secret == "" {
+			system_logger.Log(logger.Error, "Ignoring malformed signing key in %s", signingKeysEnv)
+			continue
+		}
+		keys = append(keys, privilege.SigningKey{ID: id, Secret: []byte(secret)})
+	}
+	if len(keys) == 0 {
+		return
+	}
+	privilege.SetSigningKeys(&keys[0], keys[1:]...)
+	system_logger.Log(logger.Info, "Signed tokens enabled with active key %s", keys[0].ID)
+}
+
 func RequestRoute(w http.ResponseWriter, r *http.Request) {
 
 	type Request struct {
@@ -131,35 +287,128 @@ func RequestRoute(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// A user holding a temporary password may do nothing but replace it or leave.
+	if req.Action != "LogIn" && req.Action != "LogOut" && req.Action != "ModifyPassword" && account.PasswordChangeRequired(accountInfo.UserName) {
+		writeErrorMessage(w, "Password change required")
+		return
+	}
+
+	if capability, ok := requiredCapability(req.Action, req.Parameters); ok {
+		if !privilege.Authorize(roleOf(accountInfo), capability) {
+			writeErrorMessage(w, "Permission denied")
+			return
+		}
+	}
+
 	switch req.Action {
 	case "Register":
-		HandleRegister(w, req.Parameters, accountInfo.Privilege)
+		HandleRegister(w, req.Parameters)
 	case "Remove":
-		HandleRemove(w, req.Parameters, accountInfo.Privilege)
+		HandleRemove(w, req.Parameters)
 	case "LogIn":
 		HandleLogIn(w, req.Parameters)
 	case "LogOut":
 		HandleLogOut(w, req.Token)
 	case "ModifyPassword":
-		HandleModifyPassword(w, req.Parameters, accountInfo.UserName)
+		HandleModifyPassword(w, req.Parameters, accountInfo)
+	case "ResetPassword":
+		HandleResetPassword(w, req.Parameters)
+	case "ListSessions":
+		HandleListSessions(w, req.Parameters)
+	case "RevokeSessions":
+		HandleRevokeSessions(w, req.Parameters)
 	case "GetUserInfo":
-		HandleGetUserInfo(w, req.Parameters, accountInfo.Privilege)
+		HandleGetUserInfo(w, req.Parameters, accountInfo)
 	case "GetAllUsersInfo":
-		HandleGetAllUsersInfo(w, req.Parameters, accountInfo.Privilege)
+		HandleGetAllUsersInfo(w, req.Parameters)
 	case "GetPartUsersInfo":
-		HandleGetPartUsersInfo(w, req.Parameters, accountInfo.Privilege)
+		HandleGetPartUsersInfo(w, req.Parameters, accountInfo)
+	case "SearchUsers":
+		HandleSearchUsers(w, req.Parameters)
+	case "ImportUsers":
+		HandleImportUsers(w, req.Parameters)
+	case "ModifyUser":
+		HandleModifyUser(w, req.Parameters)
+	case "SetUserRole":
+		HandleSetUserRole(w, req.Parameters)
+	case "PromoteStudents":
+		HandlePromoteStudents(w, req.Parameters, accountInfo)
+	case "GetAuditLog":
+		HandleGetAuditLog(w)
+	case "CreateClass":
+		HandleCreateClass(w, req.Parameters)
+	case "ModifyClass":
+		HandleModifyClass(w, req.Parameters)
+	case "RenameClass":
+		HandleRenameClass(w, req.Parameters)
+	case "DeleteClass":
+		HandleDeleteClass(w, req.Parameters)
+	case "GetClasses":
+		HandleGetClasses(w, req.Parameters)
+	case "ExportReport":
+		HandleExportReport(w, req.Parameters, accountInfo)
+	case "SetHomeroomTeacher":
+		HandleSetHomeroomTeacher(w, req.Parameters)
 	case "AddCourse":
-		HandleAddCourse(w, req.Parameters, accountInfo.Privilege)
+		HandleAddCourse(w, req.Parameters)
 	case "ModifyCourse":
-		HandleModifyCourse(w, req.Parameters, accountInfo.Privilege)
+		HandleModifyCourse(w, req.Parameters)
 	case "LaunchCourse":
-		HandleLaunchCourse(w, req.Parameters, accountInfo.Privilege)
+		HandleLaunchCourse(w, req.Parameters)
+	case "UnlaunchCourse":
+		HandleUnlaunchCourse(w, req.Parameters)
+	case "ArchiveCourse":
+		HandleArchiveCourse(w, req.Parameters)
+	case "RemoveCourse":
+		HandleRemoveCourse(w, req.Parameters)
+	case "GetNotifications":
+		HandleGetNotifications(w, req.Parameters, accountInfo)
 	case "GetAllCoursesInfo":
-		HandleGetAllCoursesInfo(w, req.Parameters)
+		HandleGetAllCoursesInfo(w, req.Parameters, accountInfo)
+	case "SearchCourses":
+		HandleSearchCourses(w, req.Parameters, accountInfo)
 	case "SelectCourse":
 		HandleSelectCourse(w, req.Parameters, accountInfo)
 	case "DropCourse":
 		HandleDropCourse(w, req.Parameters, accountInfo)
+	case "SetSelectionLimit":
+		HandleSetSelectionLimit(w, req.Parameters)
+	case "ResizeCourse":
+		HandleResizeCourse(w, req.Parameters)
+	case "JoinWaitlist":
+		HandleJoinWaitlist(w, req.Parameters, accountInfo)
+	case "LeaveWaitlist":
+		HandleLeaveWaitlist(w, req.Parameters, accountInfo)
+	case "GetWaitlistPosition":
+		HandleGetWaitlistPosition(w, req.Parameters, accountInfo)
+	case "SetCourseEligibility":
+		HandleSetCourseEligibility(w, req.Parameters)
+	case "SetCurrentTerm":
+		HandleSetCurrentTerm(w, req.Parameters)
+	case "RecordCompletion":
+		HandleRecordCompletion(w, req.Parameters)
+	case "CreateRound":
+		HandleCreateRound(w, req.Parameters)
+	case "ModifyRound":
+		HandleModifyRound(w, req.Parameters)
+	case "CloseRound":
+		HandleCloseRound(w, req.Parameters)
+	case "GetRounds":
+		HandleGetRounds(w, req.Parameters)
+	case "SubmitIntent":
+		HandleSubmitIntent(w, req.Parameters, accountInfo)
+	case "WithdrawIntent":
+		HandleWithdrawIntent(w, req.Parameters, accountInfo)
+	case "GetIntents":
+		HandleGetIntents(w, req.Parameters, accountInfo)
+	case "RunLottery":
+		HandleRunLottery(w, req.Parameters)
+	case "SubmitPreferences":
+		HandleSubmitPreferences(w, req.Parameters, accountInfo)
+	case "GetPreferences":
+		HandleGetPreferences(w, req.Parameters, accountInfo)
+	case "RunAllocation":
+		HandleRunAllocation(w, req.Parameters)
 	default:
 		http.Error(w, "Unknown action", http.StatusBadRequest)
 	}
@@ -177,13 +426,28 @@ type UserInfoJson struct {
 	}
 }
 
-func userInfoJsonConstruct(userInfo *account.UserInfo) UserInfoJson {
-	var user UserInfoJson
+// UserViewJson is the public view of an account returned by listings, which never carries credentials.
+type UserViewJson struct {
+	UserName      string `json:"username"`
+	Identity_info struct {
+		Class struct {
+			Grade int `json:"grade"`
+			Class int `json:"class"`
+		}
+		Privilege string `json:"privilege"`
+	}
+	Role   string `json:"role"`
+	Alumni bool   `json:"alumni"`
+}
+
+func userViewJsonConstruct(userInfo *account.UserInfo) UserViewJson {
+	var user UserViewJson
 	user.UserName = userInfo.Uid
-	user.Password = userInfo.Password
 	user.Identity_info.Class.Grade = userInfo.Classid.Grade
 	user.Identity_info.Class.Class = userInfo.Classid.Class
 	user.Identity_info.Privilege = account.PrivilegeToString(userInfo.Privilege)
+	user.Role = userInfo.Role
+	user.Alumni = userInfo.Alumni
 	return user
 }
 
@@ -197,8 +461,9 @@ func userInfoJsonDeconstruct(userInfo *UserInfoJson) account.UserInfo {
 	return user
 }
 
-// Typical logic for my work handler: (check privilege), decode parameters, execute the corresponding function and write back http reponse.
-func HandleRegister(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+// Typical logic for my work handler: decode parameters, execute the corresponding function and write back http reponse.
+// Permissions are already checked by RequestRoute against actionCapabilities.
+func HandleRegister(w http.ResponseWriter, parameters json.RawMessage) {
 	type Parameters struct {
 		UserInfo UserInfoJson `json:"userInfo"`
 	}
@@ -208,15 +473,42 @@ func HandleRegister(w http.ResponseWriter, parameters json.RawMessage, privilege
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
+		err = account.Register(userInfoJsonDeconstruct(&params.UserInfo))
 		if err != nil {
-			response.Message = "Invalid parameters"
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleModifyUser(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		UserInfo UserViewJson `json:"userInfo"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		userInfo := params.UserInfo
+		// StringToPrivilege falls back to student, which must not silently demote anybody here.
+		newPrivilege := account.StringToPrivilege(userInfo.Identity_info.Privilege)
+		if account.PrivilegeToString(newPrivilege) != userInfo.Identity_info.Privilege {
+			response.Message = fmt.Sprintf("unknown privilege %q", userInfo.Identity_info.Privilege)
 		} else {
-			err = account.Register(userInfoJsonDeconstruct(&params.UserInfo))
+			classid := account.ClassID{Grade: userInfo.Identity_info.Class.Grade, Class: userInfo.Identity_info.Class.Class}
+			err = account.ModifyUser(userInfo.UserName, classid, newPrivilege)
 			if err != nil {
 				response.Message = err.Error()
 			}
@@ -225,7 +517,32 @@ func HandleRegister(w http.ResponseWriter, parameters json.RawMessage, privilege
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleRemove(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+// HandleSetUserRole gives a user a role of the permission policy, or clears it with an empty role.
+func HandleSetUserRole(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		UserName string `json:"username"`
+		Role     string `json:"role"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = account.SetUserRole(params.UserName, params.Role)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleRemove(w http.ResponseWriter, parameters json.RawMessage) {
 	type Parameters struct {
 		User_name string `json:"username"`
 	}
@@ -235,18 +552,14 @@ func HandleRemove(w http.ResponseWriter, parameters json.RawMessage, privilege i
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
+		err = account.RemoveUser(params.User_name)
 		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			err = account.RemoveUser(params.User_name)
-			if err != nil {
-				response.Message = err.Error()
-			}
+			response.Message = err.Error()
 		}
 	}
 	json.NewEncoder(w).Encode(response)
@@ -258,8 +571,9 @@ func HandleLogIn(w http.ResponseWriter, parameters json.RawMessage) {
 		Password  string `json:"password"`
 	}
 	type Response struct {
-		Token   string `json:"authToken"`
-		Message string `json:"errorMessage"`
+		Token              string `json:"authToken"`
+		MustChangePassword bool   `json:"mustChangePassword"`
+		Message            string `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -273,8 +587,9 @@ func HandleLogIn(w http.ResponseWriter, parameters json.RawMessage) {
 		if err != nil {
 			response.Message = err.Error()
 		} else {
-			accountInfo := privilege.AccountInfo{UserName: params.User_name, Privilege: privilegeLevel}
+			accountInfo := privilege.AccountInfo{UserName: params.User_name, Privilege: privilegeLevel, Role: account.UserRole(params.User_name)}
 			response.Token = privilege.UserLogIn(accountInfo)
+			response.MustChangePassword = account.PasswordChangeRequired(params.User_name)
 		}
 	}
 	json.NewEncoder(w).Encode(response)
@@ -294,11 +609,13 @@ func HandleLogOut(w http.ResponseWriter, token string) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleModifyPassword(w http.ResponseWriter, parameters json.RawMessage, uid string) {
+// HandleModifyPassword signs the user out everywhere and hands the caller a fresh token.
+func HandleModifyPassword(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
 	type Parameters struct {
 		Password string `json:"password"`
 	}
 	type Response struct {
+		Token   string `json:"authToken"`
 		Message string `json:"errorMessage"`
 	}
 
@@ -309,279 +626,1573 @@ func HandleModifyPassword(w http.ResponseWriter, parameters json.RawMessage, uid
 	if err != nil {
 		response.Message = "Invalid parameters"
 	} else {
-		err = account.ModifyPassword(uid, params.Password)
+		err = account.ModifyPassword(accountInfo.UserName, params.Password)
 		if err != nil {
 			response.Message = err.Error()
+		} else {
+			response.Token = privilege.UserLogIn(accountInfo)
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleGetUserInfo(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+func HandleResetPassword(w http.ResponseWriter, parameters json.RawMessage) {
 	type Parameters struct {
 		UserName string `json:"name"`
 	}
 	type Response struct {
-		UserInfo UserInfoJson `json:"userInfo"`
-		Message  string       `json:"errorMessage"`
+		TemporaryPassword string `json:"temporaryPassword"`
+		Message           string `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeTeacher {
-		response.Message = "Permission denied"
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
+		response.TemporaryPassword, err = account.ResetPassword(params.UserName)
 		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			userInfo, err := account.GetUserInfo(params.UserName)
-			if err != nil {
-				response.Message = err.Error()
-			} else {
-				response.UserInfo = userInfoJsonConstruct(userInfo)
-			}
+			response.Message = err.Error()
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleGetAllUsersInfo(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
-	type Response struct {
-		Users   []UserInfoJson `json:"users"`
-		Message string         `json:"errorMessage"`
-	}
+type SessionJson struct {
+	TokenPrefix string `json:"tokenPrefix"`
+	UserName    string `json:"username"`
+	Privilege   string `json:"privilege"`
+	Role        string `json:"role"`
+	IssuedAt    string `json:"issuedAt"`
+	LastSeen    string `json:"lastSeen"`
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
-	} else {
-		allUsers := account.GetAllUsersInfo()
-		for _, userInfo := range allUsers {
-			response.Users = append(response.Users, userInfoJsonConstruct(userInfo))
-		}
-	}
-	json.NewEncoder(w).Encode(response)
+func sessionJsonConstruct(session *privilege.SessionInfo) SessionJson {
+	var result SessionJson
+	result.TokenPrefix = session.TokenPrefix
+	result.UserName = session.UserName
+	result.Privilege = account.PrivilegeToString(session.Privilege)
+	result.Role = session.Role
+	result.IssuedAt = session.IssuedAt.Format(time.RFC3339)
+	result.LastSeen = session.LastSeen.Format(time.RFC3339)
+	return result
 }
 
-func HandleGetPartUsersInfo(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+func HandleListSessions(w http.ResponseWriter, parameters json.RawMessage) {
 	type Parameters struct {
-		Way   int `json:"way"` // 0 for class, 1 for course
-		Class struct {
-			Grade int `json:"grade"`
-			Class int `json:"class"`
-		}
-		Course_id string `json:"courseName"`
+		UserName string `json:"name"` // empty for everyone
 	}
-
 	type Response struct {
-		Users   []UserInfoJson `json:"users"`
-		Message string         `json:"errorMessage"`
+		Sessions []SessionJson `json:"sessions"`
+		Message  string        `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeTeacher {
-		response.Message = "Permission denied"
+	var params Parameters
+	if len(parameters) > 0 && json.Unmarshal(parameters, &params) != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
-		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			if params.Way == 0 {
-				classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
-				users, err := account.GetClassUsersInfo(classid)
-				if err != nil {
-					response.Message = err.Error()
-				} else {
-					for _, userInfo := range users {
-						user := userInfoJsonConstruct(userInfo)
-						response.Users = append(response.Users, user)
-					}
-				}
-			} else if params.Way == 1 {
-				users, err := account.GetCourseUsersInfo(params.Course_id)
-				if err != nil {
-					response.Message = err.Error()
-				} else {
-					for _, userInfo := range users {
-						user := userInfoJsonConstruct(userInfo)
-						response.Users = append(response.Users, user)
-					}
-				}
-			} else {
-				response.Message = "Invalid way"
-			}
+		for _, session := range privilege.ListSessions(params.UserName) {
+			response.Sessions = append(response.Sessions, sessionJsonConstruct(&session))
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-type CourseInfo struct {
-	CourseName  string `json:"name"`
-	TeacherName string `json:"teacherName"`
-	Max_student int    `json:"maximum"`
-}
-
-func HandleAddCourse(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+func HandleRevokeSessions(w http.ResponseWriter, parameters json.RawMessage) {
 	type Parameters struct {
-		Course_Info CourseInfo `json:"courseInfo"`
+		UserName string `json:"name"`
 	}
 	type Response struct {
+		Revoked int    `json:"revoked"`
 		Message string `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil || params.UserName == "" {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
-		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			err = course.AddCourse(params.Course_Info.CourseName, params.Course_Info.TeacherName, params.Course_Info.Max_student)
-			if err != nil {
-				response.Message = err.Error()
-			}
-		}
+		response.Revoked = privilege.RevokeUserSessions(params.UserName)
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleModifyCourse(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
+func HandleGetUserInfo(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
 	type Parameters struct {
-		CourseName string     `json:"courseName"`
-		CourseInfo CourseInfo `json:"courseInfo"`
+		UserName string `json:"name"`
 	}
 	type Response struct {
-		Message string `json:"errorMessage"`
+		UserInfo UserViewJson `json:"userInfo"`
+		Message  string       `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
+		// Access comes first, so an unknown name is as forbidden as a known one out of reach.
+		if !canReadAnyUser(accountInfo) {
+			err = account.CheckUserAccess(accountInfo.UserName, params.UserName)
+		}
+		var userInfo *account.UserInfo
+		if err == nil {
+			userInfo, err = account.GetUserInfo(params.UserName)
+		}
 		if err != nil {
-			response.Message = "Invalid parameters"
+			response.Message = err.Error()
 		} else {
-			err = course.ModifyCourse(params.CourseName, params.CourseInfo.TeacherName, params.CourseInfo.Max_student)
-			if err != nil {
-				response.Message = err.Error()
-			}
+			response.UserInfo = userViewJsonConstruct(userInfo)
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleLaunchCourse(w http.ResponseWriter, parameters json.RawMessage, privilege int) {
-	type Parameters struct {
-		CourseName string `json:"courseName"`
-	}
+func HandleGetAllUsersInfo(w http.ResponseWriter, parameters json.RawMessage) {
 	type Response struct {
-		Message string `json:"errorMessage"`
+		Users   []UserViewJson `json:"users"`
+		Message string         `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if privilege < account.PrivilegeAdmin {
-		response.Message = "Permission denied"
-	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
-		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			err = course.LaunchCourse(params.CourseName)
-			if err != nil {
-				response.Message = err.Error()
-			}
-		}
+	allUsers := account.GetAllUsersInfo()
+	for _, userInfo := range allUsers {
+		response.Users = append(response.Users, userViewJsonConstruct(userInfo))
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-type CourseFullInfo struct {
-	CourseName  string `json:"name"`
-	TeacherName string `json:"teacherName"`
-	MaxStudents int    `json:"maximum"`
-	NowStudents int    `json:"current"`
-	Launched    bool   `json:"launched"`
+type ImportRowJson struct {
+	Line     int    `json:"line"`
+	UserName string `json:"username"`
+	Imported bool   `json:"imported"`
+	Error    string `json:"error"`
 }
 
-func courseFullInfoConstruct(course_info *course.CourseInfo) CourseFullInfo {
-	var course CourseFullInfo
-	course.CourseName = course_info.CourseName
-	course.TeacherName = course_info.Teacher
-	course.MaxStudents = course_info.MaxStudents
-	course.NowStudents = course_info.NowStudents
-	course.Launched = course_info.Launched
-	return course
+func importRowsConstruct(report *account.ImportReport) []ImportRowJson {
+	rows := []ImportRowJson{}
+	for _, row := range report.Rows {
+		rows = append(rows, ImportRowJson{Line: row.Line, UserName: row.Uid, Imported: row.Imported, Error: row.Error})
+	}
+	return rows
 }
 
-func HandleGetAllCoursesInfo(w http.ResponseWriter, parameters json.RawMessage) {
+func HandleImportUsers(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Csv  string `json:"csv"`
+		Mode string `json:"mode"`
+	}
 	type Response struct {
-		Courses []CourseFullInfo `json:"courses"`
-		Message string           `json:"errorMessage"`
+		Imported int             `json:"imported"`
+		Rows     []ImportRowJson `json:"rows"`
+		Message  string          `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	all_courses := course.GetAllCoursesInfo()
-	for _, course_info := range all_courses {
-		course_full_info := courseFullInfoConstruct(course_info)
-		response.Courses = append(response.Courses, course_full_info)
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if params.Mode == "" {
+		params.Mode = string(account.ImportAllOrNothing)
+	}
+	report, err := account.ImportUsers(strings.NewReader(params.Csv), account.ImportMode(params.Mode))
+	if report != nil {
+		response.Imported = report.Imported
+		response.Rows = importRowsConstruct(report)
+	}
+	if err != nil {
+		response.Message = err.Error()
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleSelectCourse(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+type ClassMoveJson struct {
+	From       ClassRangeJson `json:"from"`
+	To         ClassRangeJson `json:"to"`
+	Students   int            `json:"students"`
+	Graduating bool           `json:"graduating"`
+}
+
+func HandlePromoteStudents(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
 	type Parameters struct {
-		CourseName string `json:"courseName"`
+		TopGrade int  `json:"topGrade"`
+		DryRun   bool `json:"dryRun"`
 	}
 	type Response struct {
-		Message string `json:"errorMessage"`
+		DryRun      bool            `json:"dryRun"`
+		Classes     []ClassMoveJson `json:"classes"`
+		Graduates   []string        `json:"graduates"`
+		RuleCourses []string        `json:"ruleCourses"`
+		Message     string          `json:"errorMessage"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if accountInfo.Privilege != account.PrivilegeStudent {
-		response.Message = "Only students can select courses"
-	} else {
-		var params Parameters
-		err := json.Unmarshal(parameters, &params)
-		if err != nil {
-			response.Message = "Invalid parameters"
-		} else {
-			err = course.SelectCourse(accountInfo.UserName, params.CourseName)
-			if err != nil {
-				response.Message = err.Error()
-			}
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	report, err := account.PromoteStudents(params.TopGrade, params.DryRun)
+	if err != nil {
+		response.Message = err.Error()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.DryRun = report.DryRun
+	response.Graduates = report.Graduates
+	response.RuleCourses = report.RuleCourses
+	for _, move := range report.Classes {
+		response.Classes = append(response.Classes, ClassMoveJson{
+			From:       ClassRangeJson{Grade: move.From.Grade, Class: move.From.Class},
+			To:         ClassRangeJson{Grade: move.To.Grade, Class: move.To.Class},
+			Students:   move.Students,
+			Graduating: move.Graduating,
+		})
+	}
+	if !report.DryRun {
+		// Counts only: a whole graduating year would make a line too long to read back comfortably.
+		detail := fmt.Sprintf("top grade %d, %d classes moved, %d students graduated", report.TopGrade,
+			len(report.Classes), len(report.Graduates))
+		if err := audit.Record(accountInfo.UserName, "PromoteStudents", detail); err != nil {
+			system_logger.Log(logger.Error, "Failed to record promotion in the audit log: %v", err)
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-func HandleDropCourse(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+func HandleGetAuditLog(w http.ResponseWriter) {
 	type Response struct {
-		Message string `json:"errorMessage"`
+		Entries []audit.Entry `json:"entries"`
+		Message string        `json:"errorMessage"`
 	}
+
 	w.Header().Set("Content-Type", "application/json")
 	var response Response
-	if accountInfo.Privilege != account.PrivilegeStudent {
-		response.Message = "Only students can drop courses"
+	entries, err := audit.ReadEntries()
+	if err != nil {
+		response.Message = err.Error()
+	} else {
+		response.Entries = entries
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleExportReport answers with the CSV file itself rather than JSON, and with the usual
+// errorMessage object only when the report cannot be made.
+func HandleExportReport(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		Report string `json:"report"` // "class", "course" or "fill"
+		Class  struct {
+			Grade int `json:"grade"`
+			Class int `json:"class"`
+		}
+		CourseName string `json:"courseName"`
+	}
+
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		writeErrorMessage(w, "Invalid parameters")
+		return
+	}
+	var content []byte
+	var fileName string
+	switch params.Report {
+	case "class":
+		classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+		if !canReadAnyUser(accountInfo) {
+			err = account.CheckClassAccess(accountInfo.UserName, classid)
+		}
+		if err == nil {
+			content, err = account.ExportClass(classid)
+		}
+		fileName = fmt.Sprintf("class_%d_%d.csv", classid.Grade, classid.Class)
+	case "course":
+		if !canReadAnyUser(accountInfo) {
+			err = account.CheckCourseAccess(accountInfo.UserName, params.CourseName)
+		}
+		if err == nil {
+			content, err = account.ExportCourseRoster(params.CourseName)
+		}
+		fileName = fmt.Sprintf("roster_%s.csv", params.CourseName)
+	case "fill":
+		content = course.ExportFillReport()
+		fileName = "course_fill.csv"
+	default:
+		err = fmt.Errorf("unknown report %q", params.Report)
+	}
+	if err != nil {
+		writeErrorMessage(w, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", spreadsheet.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Write(content)
+}
+
+type ClassRangeJson struct {
+	Grade int `json:"grade"`
+	Class int `json:"class"`
+}
+
+func HandleSearchUsers(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Prefix     string          `json:"prefix"`
+		Contains   string          `json:"contains"`
+		Privileges []string        `json:"privileges"`
+		FromClass  *ClassRangeJson `json:"fromClass"`
+		ToClass    *ClassRangeJson `json:"toClass"`
+		Sort       string          `json:"sort"`
+		Cursor     string          `json:"cursor"`
+		Limit      int             `json:"limit"`
+	}
+	type Response struct {
+		Users      []UserViewJson `json:"users"`
+		Total      int            `json:"total"`
+		NextCursor string         `json:"nextCursor"`
+		Message    string         `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	if len(parameters) > 0 {
+		if err := json.Unmarshal(parameters, &params); err != nil {
+			response.Message = "Invalid parameters"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	query := account.UserQuery{
+		Prefix:   params.Prefix,
+		Contains: params.Contains,
+		Sort:     account.UserSortKey(params.Sort),
+		Cursor:   params.Cursor,
+		Limit:    params.Limit,
+	}
+	for _, privilege := range params.Privileges {
+		// StringToPrivilege falls back to student, which would answer a typo with the wrong users.
+		level := account.StringToPrivilege(privilege)
+		if account.PrivilegeToString(level) != privilege {
+			response.Message = fmt.Sprintf("unknown privilege %q", privilege)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		query.Privileges = append(query.Privileges, level)
+	}
+	if params.FromClass != nil {
+		query.FromClass = &account.ClassID{Grade: params.FromClass.Grade, Class: params.FromClass.Class}
+	}
+	if params.ToClass != nil {
+		query.ToClass = &account.ClassID{Grade: params.ToClass.Grade, Class: params.ToClass.Class}
+	}
+	page, err := account.SearchUsers(query)
+	if err != nil {
+		response.Message = err.Error()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.Users = []UserViewJson{}
+	for i := range page.Users {
+		response.Users = append(response.Users, userViewJsonConstruct(&page.Users[i]))
+	}
+	response.Total = page.Total
+	response.NextCursor = page.NextCursor
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleGetPartUsersInfo(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		Way   int `json:"way"` // 0 for class, 1 for course
+		Class struct {
+			Grade int `json:"grade"`
+			Class int `json:"class"`
+		}
+		Course_id string `json:"courseName"`
+	}
+
+	type Response struct {
+		Users   []UserViewJson `json:"users"`
+		Message string         `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		if params.Way == 0 {
+			classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+			var users []*account.UserInfo
+			if !canReadAnyUser(accountInfo) {
+				err = account.CheckClassAccess(accountInfo.UserName, classid)
+			}
+			if err == nil {
+				users, err = account.GetClassUsersInfo(classid)
+			}
+			if err != nil {
+				response.Message = err.Error()
+			} else {
+				for _, userInfo := range users {
+					user := userViewJsonConstruct(userInfo)
+					response.Users = append(response.Users, user)
+				}
+			}
+		} else if params.Way == 1 {
+			var users []*account.UserInfo
+			if !canReadAnyUser(accountInfo) {
+				err = account.CheckCourseAccess(accountInfo.UserName, params.Course_id)
+			}
+			if err == nil {
+				users, err = account.GetCourseUsersInfo(params.Course_id)
+			}
+			if err != nil {
+				response.Message = err.Error()
+			} else {
+				for _, userInfo := range users {
+					user := userViewJsonConstruct(userInfo)
+					response.Users = append(response.Users, user)
+				}
+			}
+		} else {
+			response.Message = "Invalid way"
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSetHomeroomTeacher(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Class struct {
+			Grade int `json:"grade"`
+			Class int `json:"class"`
+		}
+		UserName string `json:"name"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+		err = account.SetHomeroomTeacher(classid, params.UserName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// ClassInfoJson describes a class to CreateClass and ModifyClass, and in GetClasses.
+type ClassInfoJson struct {
+	Class    ClassRangeJson
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+	Homeroom string `json:"homeroom"`
+	Members  int    `json:"members"`
+}
+
+func HandleCreateClass(w http.ResponseWriter, parameters json.RawMessage) {
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params ClassInfoJson
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+		err = account.CreateClass(classid, params.Name, params.Capacity)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleModifyClass(w http.ResponseWriter, parameters json.RawMessage) {
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params ClassInfoJson
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		classid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+		err = account.ModifyClass(classid, params.Name, params.Capacity)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleRenameClass(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Class    ClassRangeJson
+		NewClass ClassRangeJson `json:"newClass"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		oldClassid := account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class}
+		newClassid := account.ClassID{Grade: params.NewClass.Grade, Class: params.NewClass.Class}
+		err = account.RenameClass(oldClassid, newClassid)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleDeleteClass(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Class ClassRangeJson
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = account.DeleteClass(account.ClassID{Grade: params.Class.Grade, Class: params.Class.Class})
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleGetClasses(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		EmptyOnly bool `json:"emptyOnly"`
+	}
+	type Response struct {
+		Classes []ClassInfoJson `json:"classes"`
+		Message string          `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	if len(parameters) > 0 {
+		if err := json.Unmarshal(parameters, &params); err != nil {
+			response.Message = "Invalid parameters"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	response.Classes = []ClassInfoJson{}
+	for _, class := range account.GetClasses(params.EmptyOnly) {
+		response.Classes = append(response.Classes, ClassInfoJson{
+			Class:    ClassRangeJson{Grade: class.Classid.Grade, Class: class.Classid.Class},
+			Name:     class.Name,
+			Capacity: class.Capacity,
+			Homeroom: class.Homeroom,
+			Members:  class.Members,
+		})
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type TimeSlotJson struct {
+	Day         int `json:"day"`
+	StartPeriod int `json:"startPeriod"`
+	EndPeriod   int `json:"endPeriod"`
+	FirstWeek   int `json:"firstWeek"`
+	LastWeek    int `json:"lastWeek"`
+}
+
+func timeSlotsConstruct(slots []course.TimeSlot) []TimeSlotJson {
+	result := make([]TimeSlotJson, 0, len(slots))
+	for _, slot := range slots {
+		result = append(result, TimeSlotJson(slot))
+	}
+	return result
+}
+
+func timeSlotsDeconstruct(slots []TimeSlotJson) []course.TimeSlot {
+	result := make([]course.TimeSlot, 0, len(slots))
+	for _, slot := range slots {
+		result = append(result, course.TimeSlot(slot))
+	}
+	return result
+}
+
+type CourseInfo struct {
+	CourseName  string         `json:"name"`
+	TeacherName string         `json:"teacherName"`
+	Max_student int            `json:"maximum"`
+	Credits     int            `json:"credits"`
+	Slots       []TimeSlotJson `json:"slots"`
+	Description string         `json:"description"`
+	Room        string         `json:"room"`
+	Category    string         `json:"category"`
+	Tags        []string       `json:"tags"`
+}
+
+func courseDetailsDeconstruct(course_info *CourseInfo) course.CourseDetails {
+	return course.CourseDetails{
+		Description: course_info.Description,
+		Room:        course_info.Room,
+		Category:    course.Category(course_info.Category),
+		Tags:        course_info.Tags,
+	}
+}
+
+func HandleAddCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Course_Info CourseInfo `json:"courseInfo"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.AddCourseWithDetails(params.Course_Info.CourseName, params.Course_Info.TeacherName, params.Course_Info.Max_student,
+			params.Course_Info.Credits, courseDetailsDeconstruct(&params.Course_Info), timeSlotsDeconstruct(params.Course_Info.Slots)...)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleModifyCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string     `json:"courseName"`
+		CourseInfo CourseInfo `json:"courseInfo"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		// An empty name keeps the course where it is.
+		err = course.EditCourse(params.CourseName, params.CourseInfo.CourseName, params.CourseInfo.TeacherName, params.CourseInfo.Max_student,
+			params.CourseInfo.Credits, courseDetailsDeconstruct(&params.CourseInfo), timeSlotsDeconstruct(params.CourseInfo.Slots)...)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleLaunchCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.LaunchCourse(params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleUnlaunchCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+		Cascade    bool   `json:"cascade"`
+	}
+	type Response struct {
+		Dropped []string `json:"dropped"`
+		Message string   `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		response.Dropped, err = course.UnlaunchCourse(params.CourseName, params.Cascade)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleArchiveCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.ArchiveCourse(params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleRemoveCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.RemoveCourse(params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type NoticeJson struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+func HandleGetNotifications(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		Clear bool `json:"clear"`
+	}
+	type Response struct {
+		Notifications []NoticeJson `json:"notifications"`
+		Message       string       `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	if len(parameters) > 0 {
+		if err := json.Unmarshal(parameters, &params); err != nil {
+			response.Message = "Invalid parameters"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	response.Notifications = []NoticeJson{}
+	for _, notice := range course.GetNotifications(accountInfo.UserName, params.Clear) {
+		response.Notifications = append(response.Notifications, NoticeJson{Time: notice.Time, Message: notice.Message})
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type CourseFullInfo struct {
+	CourseName  string         `json:"name"`
+	TeacherName string         `json:"teacherName"`
+	MaxStudents int            `json:"maximum"`
+	NowStudents int            `json:"current"`
+	Launched    bool           `json:"launched"`
+	Credits     int            `json:"credits"`
+	Waiting     int            `json:"waiting"`
+	Slots       []TimeSlotJson `json:"slots"`
+	Requirement string         `json:"requirement"`
+	Archived    bool           `json:"archived"`
+	Description string         `json:"description"`
+	Room        string         `json:"room"`
+	Category    string         `json:"category"`
+	Tags        []string       `json:"tags"`
+}
+
+func courseFullInfoConstruct(course_info *course.CourseInfo) CourseFullInfo {
+	var course CourseFullInfo
+	course.CourseName = course_info.CourseName
+	course.TeacherName = course_info.Teacher
+	course.MaxStudents = course_info.MaxStudents
+	course.NowStudents = course_info.NowStudents
+	course.Launched = course_info.Launched
+	course.Credits = course_info.Credits
+	course.Slots = timeSlotsConstruct(course_info.Slots)
+	course.Archived = course_info.Archived
+	course.Description = course_info.Description
+	course.Room = course_info.Room
+	course.Category = string(course_info.Category)
+	course.Tags = append([]string{}, course_info.Tags...)
+	if course_info.Eligibility != nil {
+		course.Requirement = course_info.Eligibility.Describe()
+	}
+	return course
+}
+
+func HandleGetAllCoursesInfo(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		EligibleOnly bool `json:"eligibleOnly"`
+	}
+	type Response struct {
+		Courses []CourseFullInfo `json:"courses"`
+		Message string           `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	if len(parameters) > 0 {
+		if err := json.Unmarshal(parameters, &params); err != nil {
+			response.Message = "Invalid parameters"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	all_courses := course.GetAllCoursesInfo()
+	for _, course_info := range all_courses {
+		if params.EligibleOnly && course.CheckEligibility(accountInfo.UserName, course_info.CourseName) != nil {
+			continue
+		}
+		course_full_info := courseFullInfoConstruct(course_info)
+		course_full_info.Waiting = course.GetWaitlistLength(course_info.CourseName)
+		response.Courses = append(response.Courses, course_full_info)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSearchCourses(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		Text            string   `json:"text"`
+		Teacher         string   `json:"teacher"`
+		Categories      []string `json:"categories"`
+		Launched        *bool    `json:"launched"`
+		HasSeats        bool     `json:"hasSeats"`
+		EligibleOnly    bool     `json:"eligibleOnly"`
+		Grade           int      `json:"grade"`
+		IncludeArchived bool     `json:"includeArchived"`
+		Sort            string   `json:"sort"`
+		Cursor          string   `json:"cursor"`
+		Limit           int      `json:"limit"`
+	}
+	type Response struct {
+		Courses    []CourseFullInfo `json:"courses"`
+		Total      int              `json:"total"`
+		NextCursor string           `json:"nextCursor"`
+		Message    string           `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	if len(parameters) > 0 {
+		if err := json.Unmarshal(parameters, &params); err != nil {
+			response.Message = "Invalid parameters"
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+	}
+	query := course.CourseQuery{
+		Text:            params.Text,
+		Teacher:         params.Teacher,
+		Launched:        params.Launched,
+		HasSeats:        params.HasSeats,
+		Grade:           params.Grade,
+		IncludeArchived: params.IncludeArchived,
+		Sort:            course.CourseSortKey(params.Sort),
+		Cursor:          params.Cursor,
+		Limit:           params.Limit,
+	}
+	for _, category := range params.Categories {
+		query.Categories = append(query.Categories, course.Category(category))
+	}
+	if params.EligibleOnly {
+		query.EligibleFor = accountInfo.UserName
+	}
+	page, err := course.SearchCourses(query)
+	if err != nil {
+		response.Message = err.Error()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.Courses = []CourseFullInfo{}
+	for i := range page.Courses {
+		course_full_info := courseFullInfoConstruct(&page.Courses[i])
+		course_full_info.Waiting = course.GetWaitlistLength(page.Courses[i].CourseName)
+		response.Courses = append(response.Courses, course_full_info)
+	}
+	response.Total = page.Total
+	response.NextCursor = page.NextCursor
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSelectCourse(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.SelectCourse(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleDropCourse(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.DropCourse(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSetSelectionLimit(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		MaxCourses int `json:"maxCourses"`
+		MaxCredits int `json:"maxCredits"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.SetSelectionLimit(course.SelectionLimit{MaxCourses: params.MaxCourses, MaxCredits: params.MaxCredits})
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleResizeCourse(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName  string `json:"courseName"`
+		Max_student int    `json:"maximum"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.ResizeCourse(params.CourseName, params.Max_student)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleJoinWaitlist(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Position int    `json:"position"`
+		Message  string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.JoinWaitlist(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		} else {
+			response.Position, _ = course.GetWaitlistPosition(accountInfo.UserName, params.CourseName)
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleLeaveWaitlist(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.LeaveWaitlist(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleGetWaitlistPosition(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Position int    `json:"position"`
+		Message  string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		response.Position, err = course.GetWaitlistPosition(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// RuleJson mirrors course.Rule: every rule sets exactly one of its fields.
+type RuleJson struct {
+	All       []RuleJson       `json:"all,omitempty"`
+	Any       []RuleJson       `json:"any,omitempty"`
+	Not       *RuleJson        `json:"not,omitempty"`
+	Grades    []int            `json:"grades,omitempty"`
+	Classes   []ClassRangeJson `json:"classes,omitempty"`
+	Completed string           `json:"completed,omitempty"`
+}
+
+func ruleDeconstruct(rule_json *RuleJson) *course.Rule {
+	if rule_json == nil {
+		return nil
+	}
+	rule := &course.Rule{Grades: rule_json.Grades, Completed: rule_json.Completed}
+	// Empty lists stay empty rather than nil so that validation refuses them by name.
+	if rule_json.All != nil {
+		rule.All = []course.Rule{}
+	}
+	if rule_json.Any != nil {
+		rule.Any = []course.Rule{}
+	}
+	if rule_json.Classes != nil {
+		rule.Classes = []course.ClassRef{}
+	}
+	for i := range rule_json.All {
+		rule.All = append(rule.All, *ruleDeconstruct(&rule_json.All[i]))
+	}
+	for i := range rule_json.Any {
+		rule.Any = append(rule.Any, *ruleDeconstruct(&rule_json.Any[i]))
+	}
+	rule.Not = ruleDeconstruct(rule_json.Not)
+	for _, class_json := range rule_json.Classes {
+		classid := account.ClassID{Grade: class_json.Grade, Class: class_json.Class}
+		rule.Classes = append(rule.Classes, course.ClassRef(classid))
+	}
+	return rule
+}
+
+func HandleSetCourseEligibility(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		CourseName string    `json:"courseName"`
+		Rule       *RuleJson `json:"rule"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.SetCourseEligibility(params.CourseName, ruleDeconstruct(params.Rule))
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSetCurrentTerm(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Term string `json:"term"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.SetCurrentTerm(params.Term)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleRecordCompletion(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Name       string `json:"name"`
+		CourseName string `json:"courseName"`
+		Term       string `json:"term"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else if _, err = account.GetUserInfo(params.Name); err != nil {
+		response.Message = err.Error()
+	} else {
+		err = course.RecordCompletion(params.Name, params.CourseName, params.Term)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+type WindowJson struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type RoundJson struct {
+	Name    string     `json:"name"`
+	Start   time.Time  `json:"start"`
+	End     time.Time  `json:"end"`
+	Courses []string   `json:"courses"`
+	Grades  []int      `json:"grades"`
+	Select  WindowJson `json:"select"`
+	Drop    WindowJson `json:"drop"`
+	Mode    string     `json:"mode"`
+	Closed  bool       `json:"closed"`
+	Drawn   bool       `json:"drawn"`
+}
+
+func roundJsonConstruct(round *course.Round) RoundJson {
+	return RoundJson{
+		Name:    round.Name,
+		Start:   round.Start,
+		End:     round.End,
+		Courses: round.Courses,
+		Grades:  round.Grades,
+		Select:  WindowJson(round.Select),
+		Drop:    WindowJson(round.Drop),
+		Mode:    string(round.Mode),
+		Closed:  round.Closed,
+		Drawn:   round.Drawn,
+	}
+}
+
+func roundJsonDeconstruct(round_json *RoundJson) course.Round {
+	return course.Round{
+		Name:    round_json.Name,
+		Start:   round_json.Start,
+		End:     round_json.End,
+		Courses: round_json.Courses,
+		Grades:  round_json.Grades,
+		Select:  course.Window(round_json.Select),
+		Drop:    course.Window(round_json.Drop),
+		Mode:    course.AllocationMode(round_json.Mode),
+	}
+}
+
+func HandleCreateRound(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Round RoundJson `json:"round"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.CreateRound(roundJsonDeconstruct(&params.Round))
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleModifyRound(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Round RoundJson `json:"round"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.ModifyRound(roundJsonDeconstruct(&params.Round))
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleCloseRound(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Name string `json:"name"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.CloseRound(params.Name)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleGetRounds(w http.ResponseWriter, parameters json.RawMessage) {
+	type Response struct {
+		Rounds  []RoundJson `json:"rounds"`
+		Message string      `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	response.Rounds = []RoundJson{}
+	for _, round := range course.GetRounds() {
+		response.Rounds = append(response.Rounds, roundJsonConstruct(&round))
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSubmitIntent(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.SubmitIntent(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleWithdrawIntent(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		CourseName string `json:"courseName"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+	} else {
+		err = course.WithdrawIntent(accountInfo.UserName, params.CourseName)
+		if err != nil {
+			response.Message = err.Error()
+		}
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleGetIntents(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Response struct {
+		Courses []string `json:"courses"`
+		Message string   `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	response.Courses = course.GetUserIntents(accountInfo.UserName)
+	json.NewEncoder(w).Encode(response)
+}
+
+type LotteryLoserJson struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type CourseDrawJson struct {
+	CourseName string             `json:"courseName"`
+	Seats      int                `json:"seats"`
+	Winners    []string           `json:"winners"`
+	Losers     []LotteryLoserJson `json:"losers"`
+}
+
+func HandleRunLottery(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Round string `json:"round"`
+		Seed  int64  `json:"seed"`
+	}
+	type Response struct {
+		Courses []CourseDrawJson `json:"courses"`
+		Message string           `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	report, err := course.RunLottery(params.Round, params.Seed)
+	if err != nil {
+		response.Message = err.Error()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.Courses = []CourseDrawJson{}
+	for _, draw := range report.Courses {
+		draw_json := CourseDrawJson{CourseName: draw.CourseName, Seats: draw.Seats, Winners: []string{}, Losers: []LotteryLoserJson{}}
+		draw_json.Winners = append(draw_json.Winners, draw.Winners...)
+		for _, loser := range draw.Losers {
+			draw_json.Losers = append(draw_json.Losers, LotteryLoserJson{Name: loser.Uid, Reason: loser.Reason})
+		}
+		response.Courses = append(response.Courses, draw_json)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func HandleSubmitPreferences(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Parameters struct {
+		Courses []string `json:"courses"`
+	}
+	type Response struct {
+		Message string `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
 	} else {
-		err := course.DropCourse(accountInfo.UserName)
+		err = course.SubmitPreferences(accountInfo.UserName, params.Courses)
 		if err != nil {
 			response.Message = err.Error()
 		}
 	}
 	json.NewEncoder(w).Encode(response)
 }
+
+func HandleGetPreferences(w http.ResponseWriter, parameters json.RawMessage, accountInfo privilege.AccountInfo) {
+	type Response struct {
+		Rounds  map[string][]string `json:"rounds"`
+		Message string              `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	response.Rounds = course.GetUserPreferences(accountInfo.UserName)
+	json.NewEncoder(w).Encode(response)
+}
+
+type AssignmentJson struct {
+	Name       string `json:"name"`
+	CourseName string `json:"courseName"`
+	Rank       int    `json:"rank"`
+}
+
+type CourseFillJson struct {
+	CourseName string  `json:"courseName"`
+	Seats      int     `json:"seats"`
+	Assigned   int     `json:"assigned"`
+	FillRate   float64 `json:"fillRate"`
+}
+
+func HandleRunAllocation(w http.ResponseWriter, parameters json.RawMessage) {
+	type Parameters struct {
+		Round     string `json:"round"`
+		Algorithm string `json:"algorithm"`
+		Seed      int64  `json:"seed"`
+		DryRun    bool   `json:"dryRun"`
+	}
+	type Response struct {
+		Assignments []AssignmentJson `json:"assignments"`
+		Courses     []CourseFillJson `json:"courses"`
+		Message     string           `json:"errorMessage"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var response Response
+	var params Parameters
+	err := json.Unmarshal(parameters, &params)
+	if err != nil {
+		response.Message = "Invalid parameters"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	report, err := course.RunAllocation(params.Round, course.AllocationAlgorithm(params.Algorithm), params.Seed, params.DryRun)
+	if err != nil {
+		response.Message = err.Error()
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.Assignments = []AssignmentJson{}
+	for _, assignment := range report.Assignments {
+		response.Assignments = append(response.Assignments, AssignmentJson{Name: assignment.Uid, CourseName: assignment.CourseName, Rank: assignment.Rank})
+	}
+	response.Courses = []CourseFillJson{}
+	for _, fill := range report.Courses {
+		response.Courses = append(response.Courses, CourseFillJson{CourseName: fill.CourseName, Seats: fill.Seats, Assigned: fill.Assigned, FillRate: fill.FillRate()})
+	}
+	json.NewEncoder(w).Encode(response)
+}
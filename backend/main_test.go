@@ -3,13 +3,19 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/TOmorrowarc1/ClassSelectionSystem/account"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/course"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/privilege"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/audit"
 )
 
 // setupTestServer initializes all subsystems for a clean test environment.
@@ -20,6 +26,12 @@ func setupTestServer() {
 	account.InitAccountSystem()
 	course.InitCourseSystem()
 	privilege.InitPrivilegeSystem()
+	// Users can only register into existing classes.
+	for grade := 1; grade <= 3; grade++ {
+		for class := 1; class <= 5; class++ {
+			account.CreateClass(account.ClassID{Grade: grade, Class: class}, "", 0)
+		}
+	}
 }
 
 // Helper function to create a JSON request body for our API.
@@ -35,6 +47,29 @@ func createAPIRequestBody(action string, token string, params interface{}) *byte
 	return bytes.NewBuffer(bodyBytes)
 }
 
+// postAction sends one API request through RequestRoute and returns the recorded response.
+func postAction(action string, token string, params interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api", createAPIRequestBody(action, token, params))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	RequestRoute(rr, req)
+	return rr
+}
+
+// logIn returns the token of a successful LogIn, or fails the test.
+func logIn(t *testing.T, name string, password string) string {
+	t.Helper()
+	var resp struct {
+		Token   string `json:"authToken"`
+		Message string `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("LogIn", "", map[string]string{"name": name, "password": password}).Body).Decode(&resp)
+	if resp.Message != "" || resp.Token == "" {
+		t.Fatalf("LogIn as %s failed: %s", name, resp.Message)
+	}
+	return resp.Token
+}
+
 // TestLoginAndAuthFlow covers the fundamental authentication process.
 func TestLoginAndAuthFlow(t *testing.T) {
 	setupTestServer()
@@ -174,7 +209,7 @@ func TestStudentCourseSelectionFlow(t *testing.T) {
 	setupTestServer()
 
 	// Setup: Admin creates and launches a course
-	course.AddCourse("Test Course", "Test Teacher", 2)
+	course.AddCourse("Test Course", "Test Teacher", 2, 1)
 	course.LaunchCourse("Test Course")
 
 	// Setup: Create a student user
@@ -206,7 +241,7 @@ func TestStudentCourseSelectionFlow(t *testing.T) {
 	}
 
 	// Step 3: Student drops the course
-	body = createAPIRequestBody("DropCourse", studentToken, nil) // No params needed for drop
+	body = createAPIRequestBody("DropCourse", studentToken, selectParams)
 	req = httptest.NewRequest(http.MethodPost, "/api", body)
 	req.Header.Set("Content-Type", "application/json")
 	rr = httptest.NewRecorder()
@@ -217,4 +252,880 @@ func TestStudentCourseSelectionFlow(t *testing.T) {
 	if dropResp.Message != "" {
 		t.Fatalf("Student failed to drop course: %s", dropResp.Message)
 	}
-}
\ No newline at end of file
+}
+
+// TestSelectionLimitFlow checks that students hold several courses up to the limit set by the admin.
+func TestSelectionLimitFlow(t *testing.T) {
+	setupTestServer()
+	for _, name := range []string{"Algebra", "Biology", "Chemistry"} {
+		course.AddCourse(name, "Test Teacher", 5, 2)
+		course.LaunchCourse(name)
+	}
+	account.Register(account.UserInfo{Uid: "student_limit", Password: "pw", Privilege: account.PrivilegeStudent})
+	adminToken := logIn(t, "admin", "123456")
+	studentToken := logIn(t, "student_limit", "pw")
+
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SetSelectionLimit", studentToken, map[string]int{"maxCredits": 4}).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Fatalf("Expected students to be unable to set the limit, but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("SetSelectionLimit", adminToken, map[string]int{"maxCredits": 4}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to set the selection limit: %s", resp.Message)
+	}
+	defer course.SetSelectionLimit(course.SelectionLimit{})
+
+	for _, name := range []string{"Algebra", "Biology"} {
+		json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": name}).Body).Decode(&resp)
+		if resp.Message != "" {
+			t.Fatalf("Student failed to select %s: %s", name, resp.Message)
+		}
+	}
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Chemistry"}).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected the credit limit to reject a third course, but it was accepted")
+	}
+	json.NewDecoder(postAction("DropCourse", studentToken, map[string]string{"courseName": "Algebra"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Student failed to drop Algebra: %s", resp.Message)
+	}
+	if courses := course.GetUserCourses("student_limit"); len(courses) != 1 || courses[0] != "Biology" {
+		t.Errorf("Expected the student to keep only Biology, but got %v", courses)
+	}
+}
+
+// TestWaitlistFlow checks that a waitlisted student gets the seat another one drops.
+func TestWaitlistFlow(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("Seminar", "Test Teacher", 1, 1)
+	course.LaunchCourse("Seminar")
+	account.Register(account.UserInfo{Uid: "student_seated", Password: "pw", Privilege: account.PrivilegeStudent})
+	account.Register(account.UserInfo{Uid: "student_waiting", Password: "pw", Privilege: account.PrivilegeStudent})
+	seatedToken := logIn(t, "student_seated", "pw")
+	waitingToken := logIn(t, "student_waiting", "pw")
+	params := map[string]string{"courseName": "Seminar"}
+
+	var resp struct {
+		Position int    `json:"position"`
+		Message  string `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("SelectCourse", seatedToken, params).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Student failed to select the course: %s", resp.Message)
+	}
+	json.NewDecoder(postAction("JoinWaitlist", waitingToken, params).Body).Decode(&resp)
+	if resp.Message != "" || resp.Position != 1 {
+		t.Fatalf("Expected to join the waitlist at position 1, but got %d: '%s'", resp.Position, resp.Message)
+	}
+	json.NewDecoder(postAction("DropCourse", seatedToken, params).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Student failed to drop the course: %s", resp.Message)
+	}
+	if courses := course.GetUserCourses("student_waiting"); len(courses) != 1 || courses[0] != "Seminar" {
+		t.Errorf("Expected the waiting student to be promoted, but holds %v", courses)
+	}
+	json.NewDecoder(postAction("GetWaitlistPosition", waitingToken, params).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected the promoted student to have left the waitlist")
+	}
+}
+
+// TestScheduleConflictFlow checks that slots round-trip through the API and block clashing selections.
+func TestScheduleConflictFlow(t *testing.T) {
+	setupTestServer()
+	adminToken := logIn(t, "admin", "123456")
+	slot := map[string]int{"day": 3, "startPeriod": 5, "endPeriod": 6, "firstWeek": 1, "lastWeek": 16}
+	for _, name := range []string{"Poetry", "Painting"} {
+		addParams := map[string]interface{}{"courseInfo": map[string]interface{}{"name": name, "teacherName": "Test Teacher", "maximum": 5, "slots": []interface{}{slot}}}
+		var resp struct{ Message string `json:"errorMessage"` }
+		json.NewDecoder(postAction("AddCourse", adminToken, addParams).Body).Decode(&resp)
+		if resp.Message != "" {
+			t.Fatalf("Admin failed to add %s: %s", name, resp.Message)
+		}
+		course.LaunchCourse(name)
+	}
+
+	var listResp struct {
+		Courses []CourseFullInfo `json:"courses"`
+	}
+	json.NewDecoder(postAction("GetAllCoursesInfo", adminToken, nil).Body).Decode(&listResp)
+	for _, info := range listResp.Courses {
+		if len(info.Slots) != 1 || info.Slots[0].Day != 3 || info.Slots[0].EndPeriod != 6 {
+			t.Errorf("Expected %s to list its Wednesday slot, but got %+v", info.CourseName, info.Slots)
+		}
+	}
+
+	account.Register(account.UserInfo{Uid: "student_schedule", Password: "pw", Privilege: account.PrivilegeStudent})
+	studentToken := logIn(t, "student_schedule", "pw")
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Poetry"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Student failed to select Poetry: %s", resp.Message)
+	}
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Painting"}).Body).Decode(&resp)
+	if !strings.Contains(resp.Message, "conflicts with course Poetry") {
+		t.Errorf("Expected a conflict with Poetry, but got: '%s'", resp.Message)
+	}
+}
+
+// TestEligibleOnlyListing checks the eligibility rules through the API and the eligibleOnly filter.
+func TestEligibleOnlyListing(t *testing.T) {
+	setupTestServer()
+	adminToken := logIn(t, "admin", "123456")
+	course.AddCourse("Open", "Test Teacher", 5, 1)
+	course.AddCourse("Seniors", "Test Teacher", 5, 1)
+	course.LaunchCourse("Open")
+	course.LaunchCourse("Seniors")
+	ruleParams := map[string]interface{}{"courseName": "Seniors", "rule": map[string]interface{}{"grades": []int{3}}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SetCourseEligibility", adminToken, ruleParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to set the eligibility: %s", resp.Message)
+	}
+
+	account.Register(account.UserInfo{Uid: "student_junior", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 2}, Privilege: account.PrivilegeStudent})
+	studentToken := logIn(t, "student_junior", "pw")
+	var listResp struct {
+		Courses []CourseFullInfo `json:"courses"`
+	}
+	json.NewDecoder(postAction("GetAllCoursesInfo", studentToken, map[string]bool{"eligibleOnly": true}).Body).Decode(&listResp)
+	if len(listResp.Courses) != 1 || listResp.Courses[0].CourseName != "Open" {
+		t.Errorf("Expected only Open to be listed, but got %+v", listResp.Courses)
+	}
+	json.NewDecoder(postAction("GetAllCoursesInfo", studentToken, nil).Body).Decode(&listResp)
+	if len(listResp.Courses) != 2 {
+		t.Errorf("Expected both courses without the filter, but got %d", len(listResp.Courses))
+	}
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Seniors"}).Body).Decode(&resp)
+	if !strings.Contains(resp.Message, "requires grade 3") {
+		t.Errorf("Expected the reason 'requires grade 3', but got: '%s'", resp.Message)
+	}
+}
+
+// TestSelectionRoundFlow checks that a round created through the API gates selection.
+func TestSelectionRoundFlow(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("Later", "Test Teacher", 5, 1)
+	course.LaunchCourse("Later")
+	adminToken := logIn(t, "admin", "123456")
+	start := time.Now().Add(time.Hour)
+	window := map[string]time.Time{"start": start, "end": start.Add(time.Hour)}
+	roundParams := map[string]interface{}{"round": map[string]interface{}{
+		"name": "future", "start": start, "end": start.Add(2 * time.Hour), "select": window, "drop": window,
+	}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("CreateRound", adminToken, roundParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to create the round: %s", resp.Message)
+	}
+
+	account.Register(account.UserInfo{Uid: "student_early", Password: "pw", Privilege: account.PrivilegeStudent})
+	studentToken := logIn(t, "student_early", "pw")
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Later"}).Body).Decode(&resp)
+	if !strings.Contains(resp.Message, "no open round") {
+		t.Errorf("Expected selection before the window to be refused, but got: '%s'", resp.Message)
+	}
+
+	var roundsResp struct {
+		Rounds []RoundJson `json:"rounds"`
+	}
+	json.NewDecoder(postAction("GetRounds", studentToken, nil).Body).Decode(&roundsResp)
+	if len(roundsResp.Rounds) != 1 || roundsResp.Rounds[0].Name != "future" {
+		t.Errorf("Expected to list the future round, but got %+v", roundsResp.Rounds)
+	}
+	json.NewDecoder(postAction("CloseRound", adminToken, map[string]string{"name": "future"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Admin failed to close the round: %s", resp.Message)
+	}
+}
+
+// TestLotteryFlow checks intents and the draw through the API.
+func TestLotteryFlow(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("Ballot Course", "Test Teacher", 1, 1)
+	course.LaunchCourse("Ballot Course")
+	adminToken := logIn(t, "admin", "123456")
+	start := time.Now().Add(-time.Hour)
+	window := map[string]time.Time{"start": start, "end": start.Add(2 * time.Hour)}
+	roundParams := map[string]interface{}{"round": map[string]interface{}{
+		"name": "ballot", "start": start, "end": start.Add(2 * time.Hour), "select": window, "mode": "lottery",
+	}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("CreateRound", adminToken, roundParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to create the lottery round: %s", resp.Message)
+	}
+	for _, name := range []string{"student_lucky", "student_unlucky"} {
+		account.Register(account.UserInfo{Uid: name, Password: "pw", Privilege: account.PrivilegeStudent})
+		json.NewDecoder(postAction("SubmitIntent", logIn(t, name, "pw"), map[string]string{"courseName": "Ballot Course"}).Body).Decode(&resp)
+		if resp.Message != "" {
+			t.Fatalf("%s failed to submit an intent: %s", name, resp.Message)
+		}
+	}
+	postAction("CloseRound", adminToken, map[string]string{"name": "ballot"})
+
+	var drawResp struct {
+		Courses []CourseDrawJson `json:"courses"`
+		Message string           `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("RunLottery", adminToken, map[string]interface{}{"round": "ballot", "seed": 7}).Body).Decode(&drawResp)
+	if drawResp.Message != "" {
+		t.Fatalf("Admin failed to run the lottery: %s", drawResp.Message)
+	}
+	if len(drawResp.Courses) != 1 || len(drawResp.Courses[0].Winners) != 1 || len(drawResp.Courses[0].Losers) != 1 {
+		t.Fatalf("Expected one winner and one loser, but got %+v", drawResp.Courses)
+	}
+	if users := course.GetCourseUsers("Ballot Course"); len(users) != 1 || users[0] != drawResp.Courses[0].Winners[0] {
+		t.Errorf("Expected the winner to hold the seat, but the roster is %v", users)
+	}
+}
+
+// TestPreferenceFlow checks ranked preferences, a dry run and the allocation through the API.
+func TestPreferenceFlow(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("First Choice", "Test Teacher", 1, 1)
+	course.AddCourse("Second Choice", "Test Teacher", 1, 1)
+	course.LaunchCourse("First Choice")
+	course.LaunchCourse("Second Choice")
+	adminToken := logIn(t, "admin", "123456")
+	start := time.Now().Add(-time.Hour)
+	window := map[string]time.Time{"start": start, "end": start.Add(2 * time.Hour)}
+	roundParams := map[string]interface{}{"round": map[string]interface{}{
+		"name": "wish", "start": start, "end": start.Add(2 * time.Hour), "select": window, "mode": "preference",
+	}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("CreateRound", adminToken, roundParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to create the preference round: %s", resp.Message)
+	}
+	for _, name := range []string{"student_senior", "student_junior"} {
+		account.Register(account.UserInfo{Uid: name, Password: "pw", Privilege: account.PrivilegeStudent})
+		preferences := map[string][]string{"courses": {"First Choice", "Second Choice"}}
+		json.NewDecoder(postAction("SubmitPreferences", logIn(t, name, "pw"), preferences).Body).Decode(&resp)
+		if resp.Message != "" {
+			t.Fatalf("%s failed to submit preferences: %s", name, resp.Message)
+		}
+	}
+	postAction("CloseRound", adminToken, map[string]string{"name": "wish"})
+
+	var allocationResp struct {
+		Assignments []AssignmentJson `json:"assignments"`
+		Courses     []CourseFillJson `json:"courses"`
+		Message     string           `json:"errorMessage"`
+	}
+	params := map[string]interface{}{"round": "wish", "algorithm": "deferred-acceptance", "seed": 7, "dryRun": true}
+	json.NewDecoder(postAction("RunAllocation", adminToken, params).Body).Decode(&allocationResp)
+	if allocationResp.Message != "" {
+		t.Fatalf("Admin failed to dry run the allocation: %s", allocationResp.Message)
+	}
+	if len(allocationResp.Courses) != 2 || allocationResp.Courses[0].FillRate != 1 || allocationResp.Courses[1].FillRate != 1 {
+		t.Errorf("Expected both courses to fill up, but got %+v", allocationResp.Courses)
+	}
+	if users := course.GetCourseUsers("First Choice"); len(users) != 0 {
+		t.Errorf("Expected the dry run to enroll nobody, but the roster is %v", users)
+	}
+	params["dryRun"] = false
+	json.NewDecoder(postAction("RunAllocation", adminToken, params).Body).Decode(&allocationResp)
+	if allocationResp.Message != "" {
+		t.Fatalf("Admin failed to run the allocation: %s", allocationResp.Message)
+	}
+	for _, assignment := range allocationResp.Assignments {
+		if users := course.GetCourseUsers(assignment.CourseName); len(users) != 1 || users[0] != assignment.Name {
+			t.Errorf("Expected %s to hold a seat in %s, but the roster is %v", assignment.Name, assignment.CourseName, users)
+		}
+	}
+}
+
+// TestUnlaunchNotifiesStudents checks that a cascading unlaunch drops the students and tells them.
+func TestUnlaunchNotifiesStudents(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("Cancelled Course", "Test Teacher", 10, 1)
+	course.LaunchCourse("Cancelled Course")
+	account.Register(account.UserInfo{Uid: "student_dropped", Password: "pw", Privilege: account.PrivilegeStudent})
+	studentToken := logIn(t, "student_dropped", "pw")
+	adminToken := logIn(t, "admin", "123456")
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SelectCourse", studentToken, map[string]string{"courseName": "Cancelled Course"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Student failed to select the course: %s", resp.Message)
+	}
+
+	json.NewDecoder(postAction("UnlaunchCourse", adminToken, map[string]interface{}{"courseName": "Cancelled Course"}).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected unlaunching an occupied course without cascade to fail")
+	}
+	var unlaunchResp struct {
+		Dropped []string `json:"dropped"`
+		Message string   `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("UnlaunchCourse", adminToken, map[string]interface{}{"courseName": "Cancelled Course", "cascade": true}).Body).Decode(&unlaunchResp)
+	if unlaunchResp.Message != "" || len(unlaunchResp.Dropped) != 1 || unlaunchResp.Dropped[0] != "student_dropped" {
+		t.Fatalf("Expected the cascade to drop student_dropped, but got %+v", unlaunchResp)
+	}
+
+	var noticeResp struct {
+		Notifications []NoticeJson `json:"notifications"`
+		Message       string       `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("GetNotifications", studentToken, map[string]bool{"clear": true}).Body).Decode(&noticeResp)
+	if len(noticeResp.Notifications) != 1 || !strings.Contains(noticeResp.Notifications[0].Message, "Cancelled Course") {
+		t.Errorf("Expected a notice about the cancelled course, but got %+v", noticeResp)
+	}
+	json.NewDecoder(postAction("ArchiveCourse", adminToken, map[string]string{"courseName": "Cancelled Course"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Admin failed to archive the course: %s", resp.Message)
+	}
+	json.NewDecoder(postAction("LaunchCourse", adminToken, map[string]string{"courseName": "Cancelled Course"}).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected launching an archived course to fail")
+	}
+}
+
+// TestRenameLaunchedCourse checks that a launched course can be renamed and retaught but keeps its credits.
+func TestRenameLaunchedCourse(t *testing.T) {
+	setupTestServer()
+	course.AddCourse("Misspeled Course", "Test Teacher", 10, 2)
+	course.LaunchCourse("Misspeled Course")
+	course.SelectCourse("student_kept", "Misspeled Course")
+	adminToken := logIn(t, "admin", "123456")
+
+	params := map[string]interface{}{"courseName": "Misspeled Course", "courseInfo": map[string]interface{}{
+		"name": "Misspelled Course", "teacherName": "Other Teacher", "maximum": 12, "credits": 2,
+	}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("ModifyCourse", adminToken, params).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to rename the launched course: %s", resp.Message)
+	}
+	info, err := course.GetCourseInfo("Misspelled Course")
+	if err != nil || info.Teacher != "Other Teacher" || info.MaxStudents != 12 {
+		t.Fatalf("Expected the renamed course to carry the new teacher and seats, but got %+v, %v", info, err)
+	}
+	if courses := course.GetUserCourses("student_kept"); len(courses) != 1 || courses[0] != "Misspelled Course" {
+		t.Errorf("Expected the student to follow the rename, but holds %v", courses)
+	}
+
+	params = map[string]interface{}{"courseName": "Misspelled Course", "courseInfo": map[string]interface{}{
+		"teacherName": "Other Teacher", "maximum": 12, "credits": 4,
+	}}
+	json.NewDecoder(postAction("ModifyCourse", adminToken, params).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected changing the credits of a launched course to fail")
+	}
+}
+
+// TestCourseDetailsFlow checks that the description, room, category and tags round-trip through the API.
+func TestCourseDetailsFlow(t *testing.T) {
+	setupTestServer()
+	adminToken := logIn(t, "admin", "123456")
+	addParams := map[string]interface{}{"courseInfo": map[string]interface{}{
+		"name": "Football", "teacherName": "Test Teacher", "maximum": 22, "credits": 1,
+		"description": "Weekly matches", "room": "Stadium", "category": "sports", "tags": []string{"outdoor", "team"},
+	}}
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("AddCourse", adminToken, addParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("Admin failed to add the course: %s", resp.Message)
+	}
+
+	var listResp struct {
+		Courses []CourseFullInfo `json:"courses"`
+	}
+	json.NewDecoder(postAction("GetAllCoursesInfo", adminToken, nil).Body).Decode(&listResp)
+	if len(listResp.Courses) != 1 {
+		t.Fatalf("Expected one course, but got %+v", listResp.Courses)
+	}
+	info := listResp.Courses[0]
+	if info.Description != "Weekly matches" || info.Room != "Stadium" || info.Category != "sports" || len(info.Tags) != 2 {
+		t.Errorf("Expected the details to round-trip, but got %+v", info)
+	}
+
+	addParams["courseInfo"].(map[string]interface{})["name"] = "Cooking"
+	addParams["courseInfo"].(map[string]interface{})["category"] = "cooking"
+	json.NewDecoder(postAction("AddCourse", adminToken, addParams).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected an unknown category to be refused")
+	}
+	if _, err := course.GetCourseInfo("Cooking"); err == nil {
+		t.Error("Expected a refused course not to be added at all")
+	}
+}
+
+// TestSearchCoursesFlow pages through a filtered search and follows the cursor to the end.
+func TestSearchCoursesFlow(t *testing.T) {
+	setupTestServer()
+	for _, name := range []string{"Math A", "Math B", "Math C", "History"} {
+		course.AddCourse(name, "Test Teacher", 10, 1)
+		course.LaunchCourse(name)
+	}
+	token := logIn(t, "admin", "123456")
+
+	var seen []string
+	params := map[string]interface{}{"text": "math", "launched": true, "limit": 2}
+	for page := 0; page < 3; page++ {
+		var resp struct {
+			Courses    []CourseFullInfo `json:"courses"`
+			Total      int              `json:"total"`
+			NextCursor string           `json:"nextCursor"`
+			Message    string           `json:"errorMessage"`
+		}
+		json.NewDecoder(postAction("SearchCourses", token, params).Body).Decode(&resp)
+		if resp.Message != "" || resp.Total != 3 {
+			t.Fatalf("Expected 3 matching courses, but got %+v", resp)
+		}
+		for _, info := range resp.Courses {
+			seen = append(seen, info.CourseName)
+		}
+		if resp.NextCursor == "" {
+			break
+		}
+		params["cursor"] = resp.NextCursor
+	}
+	if strings.Join(seen, ",") != "Math A,Math B,Math C" {
+		t.Errorf("Expected the math courses in order across pages, but got %v", seen)
+	}
+
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SearchCourses", token, map[string]string{"sort": "random"}).Body).Decode(&resp)
+	if resp.Message == "" {
+		t.Error("Expected an unknown sort key to be refused")
+	}
+}
+
+// TestSearchUsersFlow checks that admins can page through a filtered user search and teachers cannot search.
+func TestSearchUsersFlow(t *testing.T) {
+	setupTestServer()
+	for i := 1; i <= 5; i++ {
+		account.Register(account.UserInfo{Uid: fmt.Sprintf("pupil_%d", i), Password: "pw", Classid: account.ClassID{Grade: 1, Class: i}})
+	}
+	account.Register(account.UserInfo{Uid: "teacher_search", Password: "pw", Privilege: account.PrivilegeTeacher})
+	adminToken := logIn(t, "admin", "123456")
+
+	type searchResponse struct {
+		Users      []UserViewJson `json:"users"`
+		Total      int            `json:"total"`
+		NextCursor string         `json:"nextCursor"`
+		Message    string         `json:"errorMessage"`
+	}
+	params := map[string]interface{}{
+		"prefix": "pupil_", "privileges": []string{"student"},
+		"fromClass": map[string]int{"grade": 1, "class": 2}, "toClass": map[string]int{"grade": 1, "class": 4},
+		"sort": "class", "limit": 2,
+	}
+	var first, second searchResponse
+	json.NewDecoder(postAction("SearchUsers", adminToken, params).Body).Decode(&first)
+	if first.Message != "" || first.Total != 3 || len(first.Users) != 2 || first.Users[0].UserName != "pupil_2" {
+		t.Fatalf("Unexpected first page: %+v", first)
+	}
+	params["cursor"] = first.NextCursor
+	json.NewDecoder(postAction("SearchUsers", adminToken, params).Body).Decode(&second)
+	if len(second.Users) != 1 || second.Users[0].UserName != "pupil_4" || second.NextCursor != "" {
+		t.Errorf("Unexpected last page: %+v", second)
+	}
+
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SearchUsers", adminToken, map[string]interface{}{"privileges": []string{"studnet"}}).Body).Decode(&resp)
+	if resp.Message != `unknown privilege "studnet"` {
+		t.Errorf("Expected an unknown privilege to be refused, but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("SearchUsers", logIn(t, "teacher_search", "pw"), nil).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Errorf("Expected teachers to be denied, but got: '%s'", resp.Message)
+	}
+}
+
+// TestImportUsersFlow imports a CSV through the API in both modes.
+func TestImportUsersFlow(t *testing.T) {
+	setupTestServer()
+	adminToken := logIn(t, "admin", "123456")
+
+	type importResponse struct {
+		Imported int             `json:"imported"`
+		Rows     []ImportRowJson `json:"rows"`
+		Message  string          `json:"errorMessage"`
+	}
+	csv := "username,password,grade,class,role\nimp_1,pw1,1,1,student\nimp_2,pw2,1,2,wizard\n"
+	var resp importResponse
+	json.NewDecoder(postAction("ImportUsers", adminToken, map[string]string{"csv": csv}).Body).Decode(&resp)
+	if resp.Message == "" || resp.Imported != 0 || len(resp.Rows) != 2 || resp.Rows[1].Line != 3 {
+		t.Fatalf("Expected an all-or-nothing import to be refused, but got: %+v", resp)
+	}
+	if _, err := account.GetUserInfo("imp_1"); err == nil {
+		t.Errorf("Expected imp_1 not to be imported")
+	}
+
+	resp = importResponse{}
+	json.NewDecoder(postAction("ImportUsers", adminToken, map[string]string{"csv": csv, "mode": "best-effort"}).Body).Decode(&resp)
+	if resp.Message != "" || resp.Imported != 1 || !resp.Rows[0].Imported || resp.Rows[1].Error == "" {
+		t.Fatalf("Unexpected best-effort report: %+v", resp)
+	}
+	logIn(t, "imp_1", "pw1")
+}
+
+// TestModifyUserFlow moves a student to another class and promotes a teacher through the API.
+func TestModifyUserFlow(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "student_move", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 1}})
+	account.Register(account.UserInfo{Uid: "teacher_up", Password: "pw", Privilege: account.PrivilegeTeacher})
+	course.AddCourse("Kept", "someone", 5, 1)
+	course.LaunchCourse("Kept")
+	course.SelectCourse("student_move", "Kept")
+	adminToken := logIn(t, "admin", "123456")
+	teacherToken := logIn(t, "teacher_up", "pw")
+
+	modify := func(name string, grade int, class int, role string) string {
+		var resp struct{ Message string `json:"errorMessage"` }
+		userInfo := map[string]interface{}{"username": name, "Identity_info": map[string]interface{}{
+			"Class": map[string]int{"grade": grade, "class": class}, "privilege": role}}
+		json.NewDecoder(postAction("ModifyUser", adminToken, map[string]interface{}{"userInfo": userInfo}).Body).Decode(&resp)
+		return resp.Message
+	}
+	if message := modify("student_move", 1, 2, "student"); message != "" {
+		t.Fatalf("ModifyUser failed: %s", message)
+	}
+	userInfo, _ := account.GetUserInfo("student_move")
+	if userInfo.Classid != (account.ClassID{Grade: 1, Class: 2}) || !slices.Contains(course.GetUserCourses("student_move"), "Kept") {
+		t.Errorf("Expected the student in class 1-2 still holding Kept, got %+v, %v", userInfo, course.GetUserCourses("student_move"))
+	}
+	if message := modify("student_move", 1, 2, "wizard"); message == "" {
+		t.Error("Expected an unknown privilege to be refused")
+	}
+
+	if message := modify("teacher_up", 0, 0, "admin"); message != "" {
+		t.Fatalf("ModifyUser failed: %s", message)
+	}
+	if rr := postAction("GetAllCoursesInfo", teacherToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the session issued before the promotion to be revoked, got status %d", rr.Code)
+	}
+	var users struct {
+		Users   []UserViewJson `json:"users"`
+		Message string         `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("GetAllUsersInfo", logIn(t, "teacher_up", "pw"), nil).Body).Decode(&users)
+	if users.Message != "" {
+		t.Errorf("Expected the promoted teacher to act as admin, but got: '%s'", users.Message)
+	}
+}
+
+// TestPromoteStudentsFlow previews and runs a promotion and finds it in the audit log.
+func TestPromoteStudentsFlow(t *testing.T) {
+	setupTestServer()
+	audit.SetAuditFile(filepath.Join(t.TempDir(), "audit.log"))
+	account.Register(account.UserInfo{Uid: "junior", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 1}})
+	account.Register(account.UserInfo{Uid: "senior", Password: "pw", Classid: account.ClassID{Grade: 3, Class: 1}})
+	adminToken := logIn(t, "admin", "123456")
+	seniorToken := logIn(t, "senior", "pw")
+
+	type promoteResponse struct {
+		DryRun    bool            `json:"dryRun"`
+		Classes   []ClassMoveJson `json:"classes"`
+		Graduates []string        `json:"graduates"`
+		Message   string          `json:"errorMessage"`
+	}
+	var preview, result promoteResponse
+	json.NewDecoder(postAction("PromoteStudents", adminToken, map[string]interface{}{"topGrade": 3, "dryRun": true}).Body).Decode(&preview)
+	if preview.Message != "" || !preview.DryRun || len(preview.Classes) != 15 || len(preview.Graduates) != 1 {
+		t.Fatalf("Unexpected preview: %+v", preview)
+	}
+	json.NewDecoder(postAction("PromoteStudents", adminToken, map[string]interface{}{"topGrade": 3}).Body).Decode(&result)
+	if result.Message != "" || result.DryRun || result.Graduates[0] != "senior" {
+		t.Fatalf("Unexpected promotion: %+v", result)
+	}
+	if rr := postAction("GetAllCoursesInfo", seniorToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the graduate's session to be revoked, got status %d", rr.Code)
+	}
+
+	var log struct {
+		Entries []audit.Entry `json:"entries"`
+		Message string        `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("GetAuditLog", adminToken, nil).Body).Decode(&log)
+	if log.Message != "" || len(log.Entries) != 1 || log.Entries[0].Actor != "admin" || log.Entries[0].Action != "PromoteStudents" {
+		t.Errorf("Expected the promotion alone in the audit log, got %+v", log)
+	}
+}
+
+// TestClassFlow manages a class through the API and registers into it.
+func TestClassFlow(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "teacher_class", Password: "pw", Privilege: account.PrivilegeTeacher})
+	adminToken := logIn(t, "admin", "123456")
+	teacherToken := logIn(t, "teacher_class", "pw")
+
+	type plainResponse struct {
+		Message string `json:"errorMessage"`
+	}
+	post := func(action string, token string, params interface{}) string {
+		var resp plainResponse
+		json.NewDecoder(postAction(action, token, params).Body).Decode(&resp)
+		return resp.Message
+	}
+	class := map[string]int{"grade": 7, "class": 1}
+	newUser := map[string]interface{}{"userInfo": map[string]interface{}{"username": "pupil_7", "password": "pw",
+		"Identity_info": map[string]interface{}{"Class": class, "privilege": "student"}}}
+	if message := post("Register", adminToken, newUser); !strings.Contains(message, "does not exist") {
+		t.Errorf("Expected registering into a missing class to fail, but got: '%s'", message)
+	}
+	if message := post("CreateClass", teacherToken, map[string]interface{}{"Class": class}); message != "Permission denied" {
+		t.Errorf("Expected teachers to be denied, but got: '%s'", message)
+	}
+	if message := post("CreateClass", adminToken, map[string]interface{}{"Class": class, "name": "Seven One", "capacity": 30}); message != "" {
+		t.Fatalf("CreateClass failed: %s", message)
+	}
+	if message := post("Register", adminToken, newUser); message != "" {
+		t.Fatalf("Register failed: %s", message)
+	}
+
+	var classes struct {
+		Classes []ClassInfoJson `json:"classes"`
+		Message string          `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("GetClasses", teacherToken, map[string]bool{"emptyOnly": true}).Body).Decode(&classes)
+	if classes.Message != "" || slices.ContainsFunc(classes.Classes, func(c ClassInfoJson) bool { return c.Class.Grade == 7 }) {
+		t.Errorf("Expected class 7-1 missing from the empty classes, got %+v", classes)
+	}
+	json.NewDecoder(postAction("GetClasses", teacherToken, nil).Body).Decode(&classes)
+	index := slices.IndexFunc(classes.Classes, func(c ClassInfoJson) bool { return c.Class.Grade == 7 })
+	if index < 0 || classes.Classes[index].Name != "Seven One" || classes.Classes[index].Members != 1 {
+		t.Errorf("Unexpected classes: %+v", classes)
+	}
+
+	renamed := map[string]int{"grade": 7, "class": 2}
+	if message := post("RenameClass", adminToken, map[string]interface{}{"Class": class, "newClass": renamed}); message != "" {
+		t.Fatalf("RenameClass failed: %s", message)
+	}
+	if message := post("DeleteClass", adminToken, map[string]interface{}{"Class": renamed}); !strings.Contains(message, "members") {
+		t.Errorf("Expected deleting a class with members to fail, but got: '%s'", message)
+	}
+}
+
+// TestExportReportFlow downloads the CSV reports and checks a teacher only gets their own roster.
+func TestExportReportFlow(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "teacher_csv", Password: "pw", Privilege: account.PrivilegeTeacher})
+	account.Register(account.UserInfo{Uid: "student_csv", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 1}})
+	course.AddCourse("Mine", "teacher_csv", 5, 1)
+	course.AddCourse("Theirs", "someone_else", 5, 1)
+	course.LaunchCourse("Mine")
+	course.SelectCourse("student_csv", "Mine")
+	teacherToken := logIn(t, "teacher_csv", "pw")
+
+	rr := postAction("ExportReport", teacherToken, map[string]string{"report": "course", "courseName": "Mine"})
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected a CSV, but got '%s': %s", contentType, rr.Body.String())
+	}
+	if disposition := rr.Header().Get("Content-Disposition"); disposition != `attachment; filename=roster_Mine.csv` {
+		t.Errorf("Unexpected Content-Disposition: '%s'", disposition)
+	}
+	if body := rr.Body.String(); !strings.HasPrefix(body, "\ufeffusername,") || !strings.Contains(body, "student_csv,1,1,student") {
+		t.Errorf("Unexpected roster: %q", body)
+	}
+
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("ExportReport", teacherToken, map[string]string{"report": "course", "courseName": "Theirs"}).Body).Decode(&resp)
+	if !strings.HasPrefix(resp.Message, "forbidden") {
+		t.Errorf("Expected a forbidden error for a foreign roster, but got: '%s'", resp.Message)
+	}
+	studentToken := logIn(t, "student_csv", "pw")
+	json.NewDecoder(postAction("ExportReport", studentToken, map[string]interface{}{"report": "class", "Class": map[string]int{"grade": 1, "class": 1}}).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Errorf("Expected students to be denied class lists, but got: '%s'", resp.Message)
+	}
+	rr = postAction("ExportReport", logIn(t, "admin", "123456"), map[string]string{"report": "fill"})
+	if !strings.Contains(rr.Body.String(), "Mine,teacher_csv,,true,false,1,5,0,20.0%") {
+		t.Errorf("Unexpected fill report: %q", rr.Body.String())
+	}
+}
+
+// TestUserListingsHideCredentials makes sure no listing leaks password hashes and
+// that a reset password must be changed before anything else is allowed.
+func TestUserListingsHideCredentials(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "student_view", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 1}})
+	adminToken := logIn(t, "admin", "123456")
+
+	for _, action := range []string{"GetUserInfo", "GetAllUsersInfo", "GetPartUsersInfo"} {
+		params := map[string]interface{}{"name": "student_view", "way": 0, "Class": map[string]int{"grade": 1, "class": 1}}
+		body := postAction(action, adminToken, params).Body.String()
+		if strings.Contains(body, "password") || strings.Contains(body, "pbkdf2") {
+			t.Errorf("%s response leaks credentials: %s", action, body)
+		}
+	}
+
+	var resetResp struct {
+		TemporaryPassword string `json:"temporaryPassword"`
+		Message           string `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("ResetPassword", adminToken, map[string]string{"name": "student_view"}).Body).Decode(&resetResp)
+	if resetResp.Message != "" || resetResp.TemporaryPassword == "" {
+		t.Fatalf("ResetPassword failed: %s", resetResp.Message)
+	}
+
+	studentToken := logIn(t, "student_view", resetResp.TemporaryPassword)
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("GetAllCoursesInfo", studentToken, nil).Body).Decode(&resp)
+	if resp.Message != "Password change required" {
+		t.Errorf("Expected 'Password change required', but got: '%s'", resp.Message)
+	}
+	var modifyResp struct {
+		Token   string `json:"authToken"`
+		Message string `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("ModifyPassword", studentToken, map[string]string{"password": "newpw"}).Body).Decode(&modifyResp)
+	if modifyResp.Message != "" || modifyResp.Token == "" {
+		t.Fatalf("ModifyPassword failed: %s", modifyResp.Message)
+	}
+	if rr := postAction("GetAllCoursesInfo", studentToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old token to be revoked, got status %d", rr.Code)
+	}
+	json.NewDecoder(postAction("GetAllCoursesInfo", modifyResp.Token, nil).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Expected no error after changing password, but got: '%s'", resp.Message)
+	}
+}
+
+
+// TestSessionAdministration checks that an admin can list and kick out a user's sessions.
+func TestSessionAdministration(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "student_kick", Password: "pw", Classid: account.ClassID{Grade: 1, Class: 1}})
+	adminToken := logIn(t, "admin", "123456")
+	studentToken := logIn(t, "student_kick", "pw")
+
+	var listResp struct {
+		Sessions []SessionJson `json:"sessions"`
+		Message  string        `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("ListSessions", adminToken, map[string]string{"name": "student_kick"}).Body).Decode(&listResp)
+	if listResp.Message != "" || len(listResp.Sessions) != 1 || listResp.Sessions[0].UserName != "student_kick" {
+		t.Fatalf("Unexpected ListSessions response: %+v", listResp)
+	}
+
+	var resp struct {
+		Revoked int    `json:"revoked"`
+		Message string `json:"errorMessage"`
+	}
+	json.NewDecoder(postAction("RevokeSessions", studentToken, map[string]string{"name": "admin"}).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Errorf("Expected 'Permission denied', but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("RevokeSessions", adminToken, map[string]string{"name": "student_kick"}).Body).Decode(&resp)
+	if resp.Message != "" || resp.Revoked != 1 {
+		t.Fatalf("Unexpected RevokeSessions response: %+v", resp)
+	}
+	if rr := postAction("GetAllCoursesInfo", studentToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked token to be rejected, got status %d", rr.Code)
+	}
+}
+
+
+// TestCapabilityPolicy checks that RequestRoute authorizes actions through the permission registry.
+func TestCapabilityPolicy(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "teacher_cap", Password: "pw", Privilege: account.PrivilegeTeacher})
+	teacherToken := logIn(t, "teacher_cap", "pw")
+	addParams := map[string]interface{}{"courseInfo": map[string]interface{}{"name": "Art", "teacherName": "teacher_cap", "maximum": 10}}
+
+	var resp struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("AddCourse", teacherToken, addParams).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Fatalf("Expected 'Permission denied', but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("SelectCourse", teacherToken, map[string]string{"courseName": "Art"}).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Errorf("Expected teachers to be unable to select courses, but got: '%s'", resp.Message)
+	}
+
+	policy := map[string][]string{}
+	for capability, roles := range privilege.DefaultPermissionPolicy {
+		policy[capability] = roles
+	}
+	policy[privilege.CapabilityCourseCreate] = []string{"admin", "teacher"}
+	privilege.SetPermissionPolicy(policy)
+	defer privilege.SetPermissionPolicy(privilege.DefaultPermissionPolicy)
+
+	json.NewDecoder(postAction("AddCourse", teacherToken, addParams).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Expected the granted capability to allow AddCourse, but got: '%s'", resp.Message)
+	}
+
+	// A role of the school's own holds exactly what the policy grants it.
+	policy[privilege.CapabilityUserReadAll] = []string{"admin", "academic office"}
+	privilege.SetPermissionPolicy(policy)
+	adminToken := logIn(t, "admin", "123456")
+	json.NewDecoder(postAction("SetUserRole", adminToken, map[string]string{"username": "teacher_cap", "role": "academic office"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Fatalf("SetUserRole failed: %s", resp.Message)
+	}
+	if rr := postAction("GetAllUsersInfo", teacherToken, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the old session to be revoked by SetUserRole, but got status %d", rr.Code)
+	}
+	officeToken := logIn(t, "teacher_cap", "pw")
+	json.NewDecoder(postAction("GetAllUsersInfo", officeToken, nil).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Expected the new role to be granted user.read.all, but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("AddCourse", officeToken, addParams).Body).Decode(&resp)
+	if resp.Message != "Permission denied" {
+		t.Errorf("Expected the role to lose the capabilities of its privilege, but got: '%s'", resp.Message)
+	}
+}
+
+
+// TestTeacherScope checks that teachers only list students in their charge while admins see all.
+func TestTeacherScope(t *testing.T) {
+	setupTestServer()
+	account.Register(account.UserInfo{Uid: "teacher_scope", Password: "pw", Privilege: account.PrivilegeTeacher})
+	account.Register(account.UserInfo{Uid: "student_scope", Password: "pw", Classid: account.ClassID{Grade: 2, Class: 1}})
+	course.AddCourse("Mine", "teacher_scope", 5, 1)
+	course.AddCourse("Theirs", "someone_else", 5, 1)
+	course.LaunchCourse("Mine")
+	course.LaunchCourse("Theirs")
+	adminToken := logIn(t, "admin", "123456")
+	teacherToken := logIn(t, "teacher_scope", "pw")
+
+	type usersResponse struct {
+		Users   []UserViewJson `json:"users"`
+		Message string         `json:"errorMessage"`
+	}
+	classParams := map[string]interface{}{"way": 0, "Class": map[string]int{"grade": 2, "class": 1}}
+	var resp usersResponse
+	json.NewDecoder(postAction("GetPartUsersInfo", teacherToken, classParams).Body).Decode(&resp)
+	if !strings.HasPrefix(resp.Message, "forbidden") {
+		t.Errorf("Expected a forbidden error for a foreign class, but got: '%s'", resp.Message)
+	}
+	json.NewDecoder(postAction("GetPartUsersInfo", teacherToken, map[string]interface{}{"way": 1, "courseName": "Theirs"}).Body).Decode(&resp)
+	if !strings.HasPrefix(resp.Message, "forbidden") {
+		t.Errorf("Expected a forbidden error for a foreign course, but got: '%s'", resp.Message)
+	}
+	// Unknown and foreign users look alike, so teachers cannot probe which accounts exist.
+	for _, name := range []string{"student_scope", "nobody_at_all"} {
+		var plain struct{ Message string `json:"errorMessage"` }
+		json.NewDecoder(postAction("GetUserInfo", teacherToken, map[string]string{"name": name}).Body).Decode(&plain)
+		if !strings.HasPrefix(plain.Message, "forbidden") {
+			t.Errorf("Expected a forbidden error for %s, but got: '%s'", name, plain.Message)
+		}
+	}
+	resp = usersResponse{}
+	json.NewDecoder(postAction("GetPartUsersInfo", teacherToken, map[string]interface{}{"way": 1, "courseName": "Mine"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Expected a teacher to list their own course, but got: '%s'", resp.Message)
+	}
+
+	var plain struct{ Message string `json:"errorMessage"` }
+	json.NewDecoder(postAction("SetHomeroomTeacher", adminToken, map[string]interface{}{"name": "teacher_scope", "Class": map[string]int{"grade": 2, "class": 1}}).Body).Decode(&plain)
+	if plain.Message != "" {
+		t.Fatalf("SetHomeroomTeacher failed: %s", plain.Message)
+	}
+	resp = usersResponse{}
+	json.NewDecoder(postAction("GetPartUsersInfo", teacherToken, classParams).Body).Decode(&resp)
+	if resp.Message != "" || len(resp.Users) != 1 {
+		t.Errorf("Expected the homeroom teacher to list their class, got %+v", resp)
+	}
+	resp = usersResponse{}
+	json.NewDecoder(postAction("GetPartUsersInfo", adminToken, map[string]interface{}{"way": 1, "courseName": "Theirs"}).Body).Decode(&resp)
+	if resp.Message != "" {
+		t.Errorf("Expected admins to list any course, but got: '%s'", resp.Message)
+	}
+}
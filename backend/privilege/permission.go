@@ -0,0 +1,133 @@
+package privilege
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"os"
+	"sync"
+)
+
+/*
+Permissions are named capabilities, each granted to a set of roles. The default policy mirrors
+the privilege levels of the README, whose names are the roles of accounts without one of their
+own. A JSON policy file of capability -> roles may override any entry, so a new role such as
+"head teacher" only needs its lines in that file and SetUserRole on its holders, instead of edits
+in every handler. A role only holds the capabilities listed for it, not those of its privilege.
+*/
+
+const (
+	CapabilityUserCreate        = "user.create"
+	CapabilityUserRemove        = "user.remove"
+	CapabilityUserModify        = "user.modify"
+	CapabilityUserPromote       = "user.promote"
+	CapabilityUserResetPassword = "user.password.reset"
+	CapabilityUserRead          = "user.read"
+	CapabilityUserReadAll       = "user.read.all"
+	CapabilityUserReadClass     = "user.read.class"
+	CapabilityUserReadCourse    = "user.read.course"
+	CapabilityUserReadAny       = "user.read.any" // lifts the ownership checks of the user.read ones
+	CapabilityClassHomeroom     = "class.homeroom"
+	CapabilityClassManage       = "class.manage"
+	CapabilityClassRead         = "class.read"
+	CapabilitySessionRead       = "session.read"
+	CapabilitySessionRevoke     = "session.revoke"
+	CapabilityAuditRead         = "audit.read"
+	CapabilityCourseCreate      = "course.create"
+	CapabilityCourseModify      = "course.modify"
+	CapabilityCourseLaunch      = "course.launch"
+	CapabilityCourseRemove      = "course.remove"
+	CapabilityCourseRead        = "course.read"
+	CapabilityCourseSelect      = "course.select"
+	CapabilityCourseDrop        = "course.drop"
+	CapabilityCourseLimit       = "course.limit"
+	CapabilityCourseWaitlist    = "course.waitlist"
+	CapabilityCourseTerm        = "course.term"
+	CapabilityCourseRound       = "course.round"
+	CapabilityCourseIntent      = "course.intent"
+)
+
+var DefaultPermissionPolicy = map[string][]string{
+	CapabilityUserCreate:        {"admin"},
+	CapabilityUserRemove:        {"admin"},
+	CapabilityUserModify:        {"admin"},
+	CapabilityUserPromote:       {"admin"},
+	CapabilityUserResetPassword: {"admin"},
+	CapabilityUserRead:          {"teacher", "admin"},
+	CapabilityUserReadAll:       {"admin"},
+	CapabilityUserReadClass:     {"teacher", "admin"},
+	CapabilityUserReadCourse:    {"teacher", "admin"},
+	CapabilityUserReadAny:       {"admin"},
+	CapabilityClassHomeroom:     {"admin"},
+	CapabilityClassManage:       {"admin"},
+	CapabilityClassRead:         {"teacher", "admin"},
+	CapabilitySessionRead:       {"admin"},
+	CapabilitySessionRevoke:     {"admin"},
+	CapabilityAuditRead:         {"admin"},
+	CapabilityCourseCreate:      {"admin"},
+	CapabilityCourseModify:      {"admin"},
+	CapabilityCourseLaunch:      {"admin"},
+	CapabilityCourseRemove:      {"admin"},
+	CapabilityCourseRead:        {"student", "teacher", "admin"},
+	CapabilityCourseSelect:      {"student"},
+	CapabilityCourseDrop:        {"student"},
+	CapabilityCourseLimit:       {"admin"},
+	CapabilityCourseWaitlist:    {"student"},
+	CapabilityCourseTerm:        {"admin"},
+	CapabilityCourseRound:       {"admin"},
+	CapabilityCourseIntent:      {"student"},
+}
+
+var (
+	permissionMap  map[string]map[string]struct{} // capability -> roles, replaced as a whole
+	permissionLock sync.RWMutex
+)
+
+// SetPermissionPolicy replaces the whole policy with the capability -> roles mapping given.
+func SetPermissionPolicy(policy map[string][]string) {
+	newMap := make(map[string]map[string]struct{}, len(policy))
+	for capability, roles := range policy {
+		roleSet := make(map[string]struct{}, len(roles))
+		for _, role := range roles {
+			roleSet[role] = struct{}{}
+		}
+		newMap[capability] = roleSet
+	}
+	permissionLock.Lock()
+	permissionMap = newMap
+	permissionLock.Unlock()
+}
+
+// LoadPermissionPolicy overrides the default policy with the entries of a JSON file shaped as
+// {"capability": ["role", ...]}. Capabilities missing from the file keep their defaults.
+func LoadPermissionPolicy(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var overrides map[string][]string
+	if err = json.Unmarshal(content, &overrides); err != nil {
+		return fmt.Errorf("invalid permission policy %s: %v", path, err)
+	}
+	policy := make(map[string][]string, len(DefaultPermissionPolicy))
+	for capability, roles := range DefaultPermissionPolicy {
+		policy[capability] = roles
+	}
+	for capability, roles := range overrides {
+		if _, known := DefaultPermissionPolicy[capability]; !known {
+			privilegeLogger.Log(logger.Warn, "Permission policy %s grants unknown capability %s", path, capability)
+		}
+		policy[capability] = roles
+	}
+	SetPermissionPolicy(policy)
+	privilegeLogger.Log(logger.Info, "Permission policy loaded from %s", path)
+	return nil
+}
+
+// Authorize reports whether role holds capability.
+func Authorize(role string, capability string) bool {
+	permissionLock.RLock()
+	defer permissionLock.RUnlock()
+	_, granted := permissionMap[capability][role]
+	return granted
+}
@@ -2,28 +2,190 @@ package privilege
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
 	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"sort"
+	"sync"
+	"time"
 )
 
 type AccountInfo struct {
 	UserName  string
 	Privilege int
+	Role      string // what the permission policy authorizes, see Authorize
+}
+
+// Session is what a token stands for: the account and when it was issued and last used.
+type Session struct {
+	Account  AccountInfo
+	IssuedAt time.Time
+	LastSeen time.Time
+}
+
+// SessionPolicy limits how long a token stays valid. A zero duration disables the limit.
+type SessionPolicy struct {
+	Lifetime        time.Duration // since LogIn, whatever the activity
+	IdleTimeout     time.Duration // since the last access, refreshed by every access
+	JanitorInterval time.Duration // how often expired sessions are swept out
 }
 
 const Length = 16
 
+var DefaultSessionPolicy = SessionPolicy{
+	Lifetime:        12 * time.Hour,
+	IdleTimeout:     30 * time.Minute,
+	JanitorInterval: time.Minute,
+}
+
+// SessionInfo describes a live session without exposing its token.
+type SessionInfo struct {
+	TokenPrefix string // of the token hash, see hashToken
+	UserName    string
+	Privilege   int
+	Role        string
+	IssuedAt    time.Time
+	LastSeen    time.Time
+}
+
 var (
-	privilegeMap    *concurrentmap.ConcurrentMap[string, AccountInfo]
+	privilegeMap *concurrentmap.ConcurrentMap[string, Session]                                        // token hash -> session
+	userTokenMap *concurrentmap.ConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]] // username -> token hashes
+	// Held while a session is added to or removed from both privilegeMap and userTokenMap.
+	sessionMutex    sync.Mutex
 	privilegeLogger *logger.Logger
+	sessionPolicy   = DefaultSessionPolicy
+	policyLock      sync.RWMutex
+	janitorStop     chan struct{}
+	janitorDone     sync.WaitGroup
+	sessionStore    SessionStore = MemorySessionStore{}
+	// timeNow is replaced in tests to move the clock.
+	timeNow = time.Now
 )
 
 func InitPrivilegeSystem() {
-	privilegeMap = concurrentmap.NewConcurrentMap[string, AccountInfo]()
+	StopPrivilegeSystem()
+	privilegeMap = concurrentmap.NewConcurrentMap[string, Session]()
+	userTokenMap = concurrentmap.NewConcurrentMap[string, *concurrentmap.ConcurrentMap[string, struct{}]]()
+	deniedTokenMap = concurrentmap.NewConcurrentMap[string, time.Time]()
+	revokedUserMap = concurrentmap.NewConcurrentMap[string, time.Time]()
 	privilegeLogger = logger.GetLogger()
-	// The privilegeMap is not persisted.
+	SetPermissionPolicy(DefaultPermissionPolicy)
+	loadSessions()
+	syncRevocations(false)
+	startJanitor()
+}
+
+// SetSessionStore chooses where sessions are persisted. Call it before InitPrivilegeSystem.
+func SetSessionStore(store SessionStore) {
+	sessionStore = store
+}
+
+// loadSessions restores the sessions of the store, dropping those expired while the system was down.
+func loadSessions() {
+	sessions, err := sessionStore.Load()
+	if err != nil {
+		privilegeLogger.Log(logger.Error, "Failed to load sessions: %v", err)
+		return
+	}
+	policy := getSessionPolicy()
+	now := timeNow()
+	dropped := 0
+	for key, session := range sessions {
+		if sessionExpired(&session, policy, now) {
+			dropped++
+			continue
+		}
+		addSession(storedTokenKey(key), &session)
+	}
+	privilegeLogger.Log(logger.Info, "Loaded %d sessions, dropped %d expired ones", len(sessions)-dropped, dropped)
+}
+
+func StorePrivilegeData() {
+	syncRevocations(true)
+	err := sessionStore.Save(privilegeMap.ReadAll())
+	if err != nil {
+		privilegeLogger.Log(logger.Error, "Failed to store sessions: %v", err)
+		return
+	}
+	privilegeLogger.Log(logger.Info, "Privilege data stored successfully")
+}
+
+// StopPrivilegeSystem stops the background janitor and waits for it to exit.
+func StopPrivilegeSystem() {
+	policyLock.Lock()
+	if janitorStop != nil {
+		close(janitorStop)
+		janitorStop = nil
+	}
+	policyLock.Unlock()
+	janitorDone.Wait()
+}
+
+// SetSessionPolicy replaces the expiry rules for all sessions, existing ones included.
+func SetSessionPolicy(policy SessionPolicy) {
+	policyLock.Lock()
+	sessionPolicy = policy
+	policyLock.Unlock()
+	startJanitor()
+}
+
+func getSessionPolicy() SessionPolicy {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	return sessionPolicy
+}
+
+func startJanitor() {
+	StopPrivilegeSystem()
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	if sessionPolicy.JanitorInterval <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	janitorStop = stop
+	janitorDone.Add(1)
+	go janitor(sessionPolicy.JanitorInterval, stop)
+}
+
+func janitor(interval time.Duration, stop chan struct{}) {
+	defer janitorDone.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			evictExpiredSessions()
+			syncRevocations(false)
+		}
+	}
+}
+
+func evictExpiredSessions() {
+	policy := getSessionPolicy()
+	now := timeNow()
+	for key, session := range privilegeMap.ReadAll() {
+		if sessionExpired(&session, policy, now) {
+			removeSession(key)
+			privilegeLogger.Log(logger.Info, "Session of user %s expired and evicted", session.Account.UserName)
+		}
+	}
+	evictDeniedTokens(now)
+}
+
+func sessionExpired(session *Session, policy SessionPolicy, now time.Time) bool {
+	if policy.Lifetime > 0 && now.Sub(session.IssuedAt) >= policy.Lifetime {
+		return true
+	}
+	if policy.IdleTimeout > 0 && now.Sub(session.LastSeen) >= policy.IdleTimeout {
+		return true
+	}
+	return false
 }
 
 func generateToken() string {
@@ -37,27 +199,158 @@ func generateToken() string {
 	return hex.EncodeToString(randomBytes)
 }
 
+// hashToken is what a token is kept and logged as, so that neither the session store nor the log
+// holds a token anyone could present.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// storedTokenKey hashes a token read back from a store written before tokens were hashed.
+func storedTokenKey(key string) string {
+	if len(key) == 2*sha256.Size {
+		return key
+	}
+	return hashToken(key)
+}
+
 func UserLogIn(accountInfo AccountInfo) string {
+	if key := getActiveKey(); key != nil {
+		privilegeLogger.Log(logger.Info, "User %s with privilege %d get a token signed by key %s", accountInfo.UserName, accountInfo.Privilege, key.ID)
+		return signToken(key, accountInfo)
+	}
 	token := generateToken()
-	privilegeMap.WritePair(token, &accountInfo)
-	privilegeLogger.Log(logger.Info, "User %s with privilege %d get token %s", accountInfo.UserName, accountInfo.Privilege, token)
+	key := hashToken(token)
+	now := timeNow()
+	session := Session{Account: accountInfo, IssuedAt: now, LastSeen: now}
+	addSession(key, &session)
+	privilegeLogger.Log(logger.Info, "User %s with privilege %d get token %s", accountInfo.UserName, accountInfo.Privilege, key)
 	return token
 }
 
+// UserAccess returns the account behind token and slides its idle deadline forward.
 func UserAccess(token string) (AccountInfo, error) {
-	if accountInfo, ok := privilegeMap.ReadPair(token); ok {
+	if isSignedToken(token) {
+		return accessSignedToken(token)
+	}
+	key := hashToken(token)
+	policy := getSessionPolicy()
+	now := timeNow()
+	var accountInfo AccountInfo
+	expired := false
+	ok := privilegeMap.ModifyPair(key, func(session *Session) {
+		if sessionExpired(session, policy, now) {
+			expired = true
+			return
+		}
+		session.LastSeen = now
+		accountInfo = session.Account
+	})
+	if ok && !expired {
 		return accountInfo, nil
 	}
-	privilegeLogger.Log(logger.Warn, "Access denied: Invalid token %s", token)
-	return AccountInfo{}, fmt.Errorf("invalid token %s", token)
+	if expired {
+		removeSession(key)
+		privilegeLogger.Log(logger.Warn, "Access denied: Expired token %s", key)
+		return AccountInfo{}, fmt.Errorf("expired token")
+	}
+	privilegeLogger.Log(logger.Warn, "Access denied: Invalid token %s", key)
+	return AccountInfo{}, fmt.Errorf("invalid token")
 }
 
 func UserLogOut(token string) error {
-	if _, ok := privilegeMap.ReadPair(token); ok {
-		privilegeMap.DeletePair(token)
-		privilegeLogger.Log(logger.Info, "Token %s logged out successfully", token)
+	if isSignedToken(token) {
+		return logOutSignedToken(token)
+	}
+	key := hashToken(token)
+	if removeSession(key) {
+		privilegeLogger.Log(logger.Info, "Token %s logged out successfully", key)
 		return nil
 	}
-	privilegeLogger.Log(logger.Warn, "Logout failed: Invalid token %s", token)
-	return fmt.Errorf("invalid token %s", token)
+	privilegeLogger.Log(logger.Warn, "Logout failed: Invalid token %s", key)
+	return fmt.Errorf("invalid token")
+}
+
+// addSession writes the token hash key into both privilegeMap and userTokenMap.
+func addSession(key string, session *Session) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	privilegeMap.WritePair(key, session)
+	tokens, ok := userTokenMap.ReadPair(session.Account.UserName)
+	if !ok {
+		tokens = concurrentmap.NewConcurrentMap[string, struct{}]()
+		userTokenMap.WritePair(session.Account.UserName, &tokens)
+	}
+	tokens.WritePair(key, &struct{}{})
+}
+
+// removeSession deletes the token hash key from both maps and reports whether it existed.
+func removeSession(key string) bool {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	session, ok := privilegeMap.ReadPair(key)
+	if !ok {
+		return false
+	}
+	privilegeMap.DeletePair(key)
+	if tokens, ok := userTokenMap.ReadPair(session.Account.UserName); ok {
+		tokens.DeletePair(key)
+		if len(tokens.ReadAll()) == 0 {
+			userTokenMap.DeletePair(session.Account.UserName)
+		}
+	}
+	return true
+}
+
+// RevokeUserSessions logs userName out everywhere and returns how many sessions were dropped.
+// Signed tokens are denied as well, but not counted since they are not tracked.
+func RevokeUserSessions(userName string) int {
+	revokeSignedTokens(userName)
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	tokens, ok := userTokenMap.ReadPair(userName)
+	if !ok {
+		return 0
+	}
+	all_tokens := tokens.ReadAll()
+	for token := range all_tokens {
+		privilegeMap.DeletePair(token)
+	}
+	userTokenMap.DeletePair(userName)
+	privilegeLogger.Log(logger.Info, "Revoked %d sessions of user %s", len(all_tokens), userName)
+	return len(all_tokens)
+}
+
+// ListSessions lists the live sessions of userName, or of everyone when userName is empty,
+// ordered by issue time.
+func ListSessions(userName string) []SessionInfo {
+	var tokens []string
+	if userName == "" {
+		for token := range privilegeMap.ReadAll() {
+			tokens = append(tokens, token)
+		}
+	} else if token_map, ok := userTokenMap.ReadPair(userName); ok {
+		for token := range token_map.ReadAll() {
+			tokens = append(tokens, token)
+		}
+	}
+	policy := getSessionPolicy()
+	now := timeNow()
+	result := make([]SessionInfo, 0, len(tokens))
+	for _, token := range tokens {
+		session, ok := privilegeMap.ReadPair(token)
+		if !ok || sessionExpired(&session, policy, now) {
+			continue
+		}
+		result = append(result, SessionInfo{
+			TokenPrefix: token[:min(len(token), 8)],
+			UserName:    session.Account.UserName,
+			Privilege:   session.Account.Privilege,
+			Role:        session.Account.Role,
+			IssuedAt:    session.IssuedAt,
+			LastSeen:    session.LastSeen,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].IssuedAt.Before(result[j].IssuedAt) })
+	return result
 }
@@ -1,9 +1,15 @@
 package privilege
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 // TestMain 函数用于在所有测试运行前进行设置。
@@ -107,6 +113,311 @@ func TestUserLogOut(t *testing.T) {
 	})
 }
 
+// TestSessionExpiry 测试会话的绝对有效期、空闲超时以及访问时的滑动续期。
+func TestSessionExpiry(t *testing.T) {
+	InitPrivilegeSystem()
+	SetSessionPolicy(SessionPolicy{Lifetime: time.Hour, IdleTimeout: 10 * time.Minute})
+	defer SetSessionPolicy(DefaultSessionPolicy)
+
+	clock := time.Date(2025, 9, 1, 8, 0, 0, 0, time.Local)
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	token := UserLogIn(AccountInfo{UserName: "expiry_user", Privilege: 0})
+
+	// 场景1: 每隔 9 分钟访问一次，空闲超时被不断续期
+	t.Run("SlidingIdleTimeout", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			clock = clock.Add(9 * time.Minute)
+			if _, err := UserAccess(token); err != nil {
+				t.Fatalf("第 %d 次访问时，活跃会话不应过期: %v", i+1, err)
+			}
+		}
+	})
+
+	// 场景2: 超过绝对有效期后，即使一直活跃也会过期
+	t.Run("AbsoluteLifetime", func(t *testing.T) {
+		clock = clock.Add(9 * time.Minute)
+		if _, err := UserAccess(token); err != nil {
+			t.Fatalf("54 分钟时会话不应过期: %v", err)
+		}
+		clock = clock.Add(9 * time.Minute)
+		if _, err := UserAccess(token); err == nil {
+			t.Error("超过绝对有效期后，访问应返回错误")
+		}
+		if _, ok := privilegeMap.ReadPair(hashToken(token)); ok {
+			t.Error("过期的令牌应在访问时被移除")
+		}
+	})
+
+	// 场景3: 空闲超过超时时间后过期
+	t.Run("IdleTimeout", func(t *testing.T) {
+		idleToken := UserLogIn(AccountInfo{UserName: "idle_user", Privilege: 0})
+		clock = clock.Add(10 * time.Minute)
+		if _, err := UserAccess(idleToken); err == nil {
+			t.Error("空闲超时后，访问应返回错误")
+		}
+	})
+}
+
+// TestJanitor 测试后台清理协程会移除过期的令牌。
+func TestJanitor(t *testing.T) {
+	InitPrivilegeSystem()
+	SetSessionPolicy(SessionPolicy{IdleTimeout: 20 * time.Millisecond, JanitorInterval: 5 * time.Millisecond})
+	defer SetSessionPolicy(DefaultSessionPolicy)
+
+	token := UserLogIn(AccountInfo{UserName: "janitor_user", Privilege: 0})
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := privilegeMap.ReadPair(hashToken(token)); !ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("过期的令牌应被后台清理协程移除")
+}
+
+// TestRevokeAndListSessions 测试按用户列出和吊销会话。
+func TestRevokeAndListSessions(t *testing.T) {
+	InitPrivilegeSystem()
+
+	tokenA1 := UserLogIn(AccountInfo{UserName: "user_a", Privilege: 0})
+	tokenA2 := UserLogIn(AccountInfo{UserName: "user_a", Privilege: 0})
+	tokenB := UserLogIn(AccountInfo{UserName: "user_b", Privilege: 1})
+
+	if sessions := ListSessions("user_a"); len(sessions) != 2 {
+		t.Fatalf("期望 user_a 有 2 个会话，实际为 %d", len(sessions))
+	}
+	if sessions := ListSessions(""); len(sessions) != 3 {
+		t.Fatalf("期望共有 3 个会话，实际为 %d", len(sessions))
+	}
+	if sessions := ListSessions("user_b"); len(sessions) != 1 || sessions[0].TokenPrefix != hashToken(tokenB)[:8] {
+		t.Errorf("user_b 的会话信息不正确: %+v", sessions)
+	}
+
+	if revoked := RevokeUserSessions("user_a"); revoked != 2 {
+		t.Errorf("期望吊销 2 个会话，实际为 %d", revoked)
+	}
+	for _, token := range []string{tokenA1, tokenA2} {
+		if _, err := UserAccess(token); err == nil {
+			t.Error("被吊销的令牌仍然可以访问")
+		}
+	}
+	if _, err := UserAccess(tokenB); err != nil {
+		t.Errorf("其他用户的会话不应被吊销: %v", err)
+	}
+	if revoked := RevokeUserSessions("user_a"); revoked != 0 {
+		t.Errorf("重复吊销时期望 0，实际为 %d", revoked)
+	}
+
+	UserLogOut(tokenB)
+	if _, ok := userTokenMap.ReadPair("user_b"); ok {
+		t.Error("登出最后一个会话后，反向索引中不应再有该用户")
+	}
+}
+
+// TestFileSessionStore 测试会话保存到文件并在重启后重新加载，过期的会话被丢弃。
+func TestFileSessionStore(t *testing.T) {
+	const storePath = "test_sessions.json"
+	os.Remove(storePath)
+	defer os.Remove(storePath)
+	defer os.Remove("test_sessions_revocations.json")
+	SetSessionStore(NewFileSessionStore(storePath))
+	defer SetSessionStore(MemorySessionStore{})
+	InitPrivilegeSystem()
+	SetSessionPolicy(SessionPolicy{IdleTimeout: time.Hour})
+	defer SetSessionPolicy(DefaultSessionPolicy)
+
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	staleToken := UserLogIn(AccountInfo{UserName: "stale_user", Privilege: 0})
+	clock = clock.Add(50 * time.Minute)
+	freshToken := UserLogIn(AccountInfo{UserName: "fresh_user", Privilege: 1})
+	StorePrivilegeData()
+	if content, _ := os.ReadFile(storePath); strings.Contains(string(content), freshToken) {
+		t.Error("会话文件中不应保存令牌明文")
+	}
+	// 旧版本的会话文件以令牌明文为键，加载时应转换为哈希
+	legacyToken := generateToken()
+	sessions, _ := NewFileSessionStore(storePath).Load()
+	sessions[legacyToken] = Session{Account: AccountInfo{UserName: "legacy_user"}, IssuedAt: clock, LastSeen: clock}
+	NewFileSessionStore(storePath).Save(sessions)
+
+	// 模拟重启：重新初始化后从文件加载
+	clock = clock.Add(20 * time.Minute)
+	InitPrivilegeSystem()
+
+	accountInfo, err := UserAccess(freshToken)
+	if err != nil {
+		t.Fatalf("重启后，未过期的会话应被恢复: %v", err)
+	}
+	if accountInfo.UserName != "fresh_user" || accountInfo.Privilege != 1 {
+		t.Errorf("恢复的会话信息不正确: %+v", accountInfo)
+	}
+	if accountInfo, err := UserAccess(legacyToken); err != nil || accountInfo.UserName != "legacy_user" {
+		t.Errorf("重启后，旧版本会话文件中的会话应被恢复: %+v, %v", accountInfo, err)
+	}
+	if _, ok := privilegeMap.ReadPair(hashToken(staleToken)); ok {
+		t.Error("重启时，已过期的会话应被丢弃")
+	}
+	if sessions := ListSessions("fresh_user"); len(sessions) != 1 {
+		t.Errorf("重启后，反向索引应被重建，实际会话数为 %d", len(sessions))
+	}
+}
+
+// TestSignedTokens 测试签名令牌的签发、校验、密钥轮换与吊销。
+func TestSignedTokens(t *testing.T) {
+	InitPrivilegeSystem()
+	oldKey := SigningKey{ID: "k1", Secret: []byte("first secret")}
+	SetSigningKeys(&oldKey)
+	defer SetSigningKeys(nil)
+
+	clock := time.Now()
+	timeNow = func() time.Time { return clock }
+	defer func() { timeNow = time.Now }()
+
+	userInfo := AccountInfo{UserName: "signed_user", Privilege: 1, Role: "head teacher"}
+	token := UserLogIn(userInfo)
+
+	t.Run("VerifyWithoutMap", func(t *testing.T) {
+		if strings.Count(token, ".") != 2 {
+			t.Fatalf("签名令牌应为 JWT 格式，实际为 %q", token)
+		}
+		if len(privilegeMap.ReadAll()) != 0 {
+			t.Error("签发签名令牌时不应写入 privilegeMap")
+		}
+		retrieved, err := UserAccess(token)
+		if err != nil || retrieved != userInfo {
+			t.Fatalf("签名令牌校验失败: %+v, %v", retrieved, err)
+		}
+	})
+
+	t.Run("TamperedToken", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		forged, _ := json.Marshal(tokenClaims{Subject: "signed_user", Privilege: 2})
+		tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+		if _, err := UserAccess(tampered); err == nil {
+			t.Error("被篡改的令牌不应通过校验")
+		}
+	})
+
+	t.Run("KeyRotation", func(t *testing.T) {
+		newKey := SigningKey{ID: "k2", Secret: []byte("second secret")}
+		SetSigningKeys(&newKey, oldKey)
+		if _, err := UserAccess(token); err != nil {
+			t.Errorf("轮换后，旧密钥签发的令牌应仍然有效: %v", err)
+		}
+		SetSigningKeys(&newKey)
+		if _, err := UserAccess(token); err == nil {
+			t.Error("旧密钥退役后，其签发的令牌应失效")
+		}
+	})
+
+	t.Run("ExpiryAndRevocation", func(t *testing.T) {
+		token := UserLogIn(userInfo)
+		other := UserLogIn(userInfo)
+		if err := UserLogOut(token); err != nil {
+			t.Fatalf("签名令牌登出失败: %v", err)
+		}
+		if _, err := UserAccess(token); err == nil {
+			t.Error("登出后，签名令牌应被拒绝")
+		}
+		if err := UserLogOut(token); err == nil {
+			t.Error("重复登出签名令牌时，期望得到一个错误")
+		}
+		// 时钟不前进：同一毫秒内吊销并重新登录（如修改密码）
+		RevokeUserSessions(userInfo.UserName)
+		if _, err := UserAccess(other); err == nil {
+			t.Error("吊销用户后，其之前签发的签名令牌应被拒绝")
+		}
+		fresh := UserLogIn(userInfo)
+		if _, err := UserAccess(fresh); err != nil {
+			t.Errorf("吊销之后签发的新令牌应有效: %v", err)
+		}
+		clock = clock.Add(DefaultSessionPolicy.Lifetime + time.Second)
+		if _, err := UserAccess(fresh); err == nil {
+			t.Error("超过有效期后，签名令牌应过期")
+		}
+		evictDeniedTokens(clock)
+		if len(deniedTokenMap.ReadAll()) != 0 || len(revokedUserMap.ReadAll()) != 0 {
+			t.Error("过期后，拒绝列表中的条目应被清理")
+		}
+	})
+}
+
+// TestSignedRevocationsPersist 测试签名令牌的登出与吊销在重启后仍然有效。
+func TestSignedRevocationsPersist(t *testing.T) {
+	SetSessionStore(NewFileSessionStore(filepath.Join(t.TempDir(), "sessions.json")))
+	defer SetSessionStore(MemorySessionStore{})
+	InitPrivilegeSystem()
+	key := SigningKey{ID: "k1", Secret: []byte("persisted secret")}
+	SetSigningKeys(&key)
+	defer SetSigningKeys(nil)
+
+	loggedOut := UserLogIn(AccountInfo{UserName: "leaving_user", Privilege: 0})
+	revoked := UserLogIn(AccountInfo{UserName: "removed_user", Privilege: 0})
+	if err := UserLogOut(loggedOut); err != nil {
+		t.Fatalf("签名令牌登出失败: %v", err)
+	}
+	RevokeUserSessions("removed_user")
+	fresh := UserLogIn(AccountInfo{UserName: "removed_user", Privilege: 0})
+
+	// 模拟重启：不调用 StorePrivilegeData，拒绝列表也应已写入存储
+	InitPrivilegeSystem()
+	if _, err := UserAccess(loggedOut); err == nil {
+		t.Error("重启后，已登出的签名令牌应仍被拒绝")
+	}
+	if _, err := UserAccess(revoked); err == nil {
+		t.Error("重启后，被吊销用户之前的签名令牌应仍被拒绝")
+	}
+	if _, err := UserAccess(fresh); err != nil {
+		t.Errorf("重启后，吊销之后签发的令牌应仍有效: %v", err)
+	}
+}
+
+// TestPermissionPolicy 测试默认权限策略以及从 JSON 文件覆盖策略。
+func TestPermissionPolicy(t *testing.T) {
+	InitPrivilegeSystem()
+
+	t.Run("DefaultPolicy", func(t *testing.T) {
+		if !Authorize("admin", CapabilityCourseCreate) || Authorize("teacher", CapabilityCourseCreate) {
+			t.Error("默认策略下只有 admin 可以创建课程")
+		}
+		if !Authorize("student", CapabilityCourseSelect) || Authorize("admin", CapabilityCourseSelect) {
+			t.Error("默认策略下只有 student 可以选课")
+		}
+		if Authorize("admin", "no.such.capability") {
+			t.Error("未知的能力不应被授予任何角色")
+		}
+	})
+
+	t.Run("LoadFromFile", func(t *testing.T) {
+		const policyPath = "test_permissions.json"
+		os.WriteFile(policyPath, []byte(`{"course.create": ["admin", "head_teacher"], "course.launch": []}`), 0644)
+		defer os.Remove(policyPath)
+		if err := LoadPermissionPolicy(policyPath); err != nil {
+			t.Fatalf("加载权限策略失败: %v", err)
+		}
+		if !Authorize("head_teacher", CapabilityCourseCreate) {
+			t.Error("策略文件中新增的角色应获得对应能力")
+		}
+		if Authorize("admin", CapabilityCourseLaunch) {
+			t.Error("策略文件应能收回能力")
+		}
+		if !Authorize("admin", CapabilityUserCreate) {
+			t.Error("策略文件中未出现的能力应保持默认值")
+		}
+	})
+
+	t.Run("InvalidFile", func(t *testing.T) {
+		if err := LoadPermissionPolicy("no_such_policy.json"); err == nil {
+			t.Error("加载不存在的策略文件时，期望得到一个错误")
+		}
+	})
+}
+
 // TestConcurrency 测试在高并发场景下系统的稳定性。
 // 它模拟了大量用户同时登录、访问和登出的情况，以确保没有竞态条件并且功能正常。
 func TestConcurrency(t *testing.T) {
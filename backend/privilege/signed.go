@@ -0,0 +1,254 @@
+package privilege
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Signed tokens are HS256 JWTs carrying the account, so any backend instance sharing the keys can
+verify them without privilegeMap. They cannot slide, only expire after SessionPolicy.Lifetime,
+and revoking them relies on a deny-list local to the instance: single tokens by their ID on
+LogOut, whole users by the time RevokeUserSessions was called.
+*/
+
+// SigningKey is an HMAC secret identified by the "kid" header of the tokens it signs.
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type tokenClaims struct {
+	Subject   string  `json:"sub"`
+	Privilege int     `json:"prv"`
+	Role      string  `json:"role,omitempty"`
+	IssuedAt  float64 `json:"iat"` // NumericDate with millisecond fraction
+	ExpiresAt float64 `json:"exp"`
+	ID        string  `json:"jti"`
+}
+
+var (
+	signingLock   sync.RWMutex
+	activeKey     *SigningKey
+	verifyingKeys map[string][]byte
+	// Hash of a denied token ID -> its expiry, after which the entry is useless and swept out.
+	deniedTokenMap *concurrentmap.ConcurrentMap[string, time.Time]
+	// username -> first millisecond after a revocation, signed tokens issued before it are denied.
+	revokedUserMap *concurrentmap.ConcurrentMap[string, time.Time]
+	// Held while the deny-lists are merged with those of the session store.
+	revocationLock sync.Mutex
+)
+
+// SetSigningKeys makes UserLogIn issue signed tokens with active, while retired keys keep
+// verifying tokens issued before a rotation. A nil active key returns to random tokens.
+func SetSigningKeys(active *SigningKey, retired ...SigningKey) {
+	signingLock.Lock()
+	defer signingLock.Unlock()
+	activeKey = active
+	verifyingKeys = make(map[string][]byte)
+	for _, key := range retired {
+		verifyingKeys[key.ID] = key.Secret
+	}
+	if active != nil {
+		verifyingKeys[active.ID] = active.Secret
+	}
+}
+
+func getActiveKey() *SigningKey {
+	signingLock.RLock()
+	defer signingLock.RUnlock()
+	return activeKey
+}
+
+func getVerifyingKey(id string) ([]byte, bool) {
+	signingLock.RLock()
+	defer signingLock.RUnlock()
+	secret, ok := verifyingKeys[id]
+	return secret, ok
+}
+
+func isSignedToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func toNumericDate(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+func fromNumericDate(date float64) time.Time {
+	return time.UnixMilli(int64(date*1000 + 0.5))
+}
+
+func signToken(key *SigningKey, accountInfo AccountInfo) string {
+	now := timeNow()
+	// iat only keeps milliseconds, so a token issued in the same millisecond as a
+	// revocation is dated to the revocation boundary to stay valid.
+	if revokedAt, ok := revokedUserMap.ReadPair(accountInfo.UserName); ok && now.Before(revokedAt) {
+		now = revokedAt
+	}
+	claims := tokenClaims{
+		Subject:   accountInfo.UserName,
+		Privilege: accountInfo.Privilege,
+		Role:      accountInfo.Role,
+		IssuedAt:  toNumericDate(now),
+		ID:        generateToken(),
+	}
+	if lifetime := getSessionPolicy().Lifetime; lifetime > 0 {
+		claims.ExpiresAt = toNumericDate(now.Add(lifetime))
+	}
+	header, _ := json.Marshal(tokenHeader{Algorithm: "HS256", Type: "JWT", KeyID: key.ID})
+	payload, _ := json.Marshal(claims)
+	encoding := base64.RawURLEncoding
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	return signingInput + "." + encoding.EncodeToString(sign(key.Secret, signingInput))
+}
+
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// parseSignedToken checks signature and expiry, but not the deny-list.
+func parseSignedToken(token string) (tokenClaims, error) {
+	var claims tokenClaims
+	parts := strings.Split(token, ".")
+	encoding := base64.RawURLEncoding
+	headerBytes, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, fmt.Errorf("malformed token header")
+	}
+	var header tokenHeader
+	if err = json.Unmarshal(headerBytes, &header); err != nil || header.Algorithm != "HS256" {
+		return claims, fmt.Errorf("unsupported token header")
+	}
+	secret, ok := getVerifyingKey(header.KeyID)
+	if !ok {
+		return claims, fmt.Errorf("unknown signing key %q", header.KeyID)
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return claims, fmt.Errorf("invalid token signature")
+	}
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, fmt.Errorf("malformed token payload")
+	}
+	if claims.ExpiresAt != 0 && !timeNow().Before(fromNumericDate(claims.ExpiresAt)) {
+		return claims, fmt.Errorf("expired token")
+	}
+	return claims, nil
+}
+
+func accessSignedToken(token string) (AccountInfo, error) {
+	claims, err := parseSignedToken(token)
+	if err != nil {
+		privilegeLogger.Log(logger.Warn, "Access denied: %v", err)
+		return AccountInfo{}, err
+	}
+	if _, denied := deniedTokenMap.ReadPair(hashToken(claims.ID)); denied {
+		privilegeLogger.Log(logger.Warn, "Access denied: Token %s of user %s is logged out", hashToken(claims.ID), claims.Subject)
+		return AccountInfo{}, fmt.Errorf("revoked token")
+	}
+	if revokedAt, ok := revokedUserMap.ReadPair(claims.Subject); ok && fromNumericDate(claims.IssuedAt).Before(revokedAt) {
+		privilegeLogger.Log(logger.Warn, "Access denied: Sessions of user %s are revoked", claims.Subject)
+		return AccountInfo{}, fmt.Errorf("revoked token")
+	}
+	return AccountInfo{UserName: claims.Subject, Privilege: claims.Privilege, Role: claims.Role}, nil
+}
+
+func logOutSignedToken(token string) error {
+	claims, err := parseSignedToken(token)
+	if err != nil {
+		privilegeLogger.Log(logger.Warn, "Logout failed: %v", err)
+		return err
+	}
+	key := hashToken(claims.ID)
+	if _, denied := deniedTokenMap.ReadPair(key); denied {
+		privilegeLogger.Log(logger.Warn, "Logout failed: Token %s is already logged out", key)
+		return fmt.Errorf("revoked token")
+	}
+	expiry := fromNumericDate(claims.ExpiresAt)
+	if claims.ExpiresAt == 0 {
+		expiry = time.Time{}
+	}
+	deniedTokenMap.WritePair(key, &expiry)
+	syncRevocations(true)
+	privilegeLogger.Log(logger.Info, "Signed token %s of user %s logged out successfully", key, claims.Subject)
+	return nil
+}
+
+// revokeSignedTokens denies every signed token of userName issued until now. The boundary is
+// rounded up to the next millisecond, the precision of iat, so no earlier token can equal it.
+func revokeSignedTokens(userName string) {
+	boundary := fromNumericDate(toNumericDate(timeNow())).Add(time.Millisecond)
+	revokedUserMap.WritePair(userName, &boundary)
+	syncRevocations(true)
+}
+
+// syncRevocations merges the deny-lists of the session store into these, then, when write is set,
+// saves the union back, so instances sharing a store and restarts deny the same signed tokens.
+func syncRevocations(write bool) {
+	revocationLock.Lock()
+	defer revocationLock.Unlock()
+	stored, err := sessionStore.LoadRevocations()
+	if err != nil {
+		privilegeLogger.Log(logger.Error, "Failed to load revocations: %v", err)
+		return
+	}
+	for id, expiry := range stored.DeniedTokens {
+		key := storedTokenKey(id)
+		if _, denied := deniedTokenMap.ReadPair(key); !denied {
+			deniedTokenMap.WritePair(key, &expiry)
+		}
+	}
+	for userName, boundary := range stored.RevokedUsers {
+		if !revokedUserMap.ModifyPair(userName, func(revokedAt *time.Time) {
+			if revokedAt.Before(boundary) {
+				*revokedAt = boundary
+			}
+		}) {
+			revokedUserMap.WritePair(userName, &boundary)
+		}
+	}
+	evictDeniedTokens(timeNow())
+	if !write {
+		return
+	}
+	revocations := Revocations{DeniedTokens: deniedTokenMap.ReadAll(), RevokedUsers: revokedUserMap.ReadAll()}
+	if err := sessionStore.SaveRevocations(revocations); err != nil {
+		privilegeLogger.Log(logger.Error, "Failed to store revocations: %v", err)
+	}
+}
+
+// evictDeniedTokens forgets deny-list entries whose tokens have expired anyway.
+func evictDeniedTokens(now time.Time) {
+	for id, expiry := range deniedTokenMap.ReadAll() {
+		if !expiry.IsZero() && !now.Before(expiry) {
+			deniedTokenMap.DeletePair(id)
+		}
+	}
+	lifetime := getSessionPolicy().Lifetime
+	if lifetime <= 0 {
+		return
+	}
+	for userName, revokedAt := range revokedUserMap.ReadAll() {
+		if now.Sub(revokedAt) >= lifetime {
+			revokedUserMap.DeletePair(userName)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package privilege
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/TOmorrowarc1/ClassSelectionSystem/utils/concurrentmap"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SessionStore keeps sessions across restarts: InitPrivilegeSystem loads from it and
+// StorePrivilegeData saves into it. It also keeps the deny-lists of signed tokens, which every
+// instance sharing the store writes on each logout or revocation and merges back periodically.
+type SessionStore interface {
+	Load() (map[string]Session, error)
+	Save(sessions map[string]Session) error
+	LoadRevocations() (Revocations, error)
+	SaveRevocations(revocations Revocations) error
+}
+
+// Revocations are the deny-lists of signed tokens, see signed.go.
+type Revocations struct {
+	DeniedTokens map[string]time.Time `json:"deniedTokens"` // token ID hash -> its expiry, zero for none
+	RevokedUsers map[string]time.Time `json:"revokedUsers"` // username -> tokens issued before are denied
+}
+
+// MemorySessionStore persists nothing, so every restart logs everyone out.
+type MemorySessionStore struct{}
+
+func (MemorySessionStore) Load() (map[string]Session, error) {
+	return nil, nil
+}
+
+func (MemorySessionStore) Save(sessions map[string]Session) error {
+	return nil
+}
+
+func (MemorySessionStore) LoadRevocations() (Revocations, error) {
+	return Revocations{}, nil
+}
+
+func (MemorySessionStore) SaveRevocations(revocations Revocations) error {
+	return nil
+}
+
+// FileSessionStore saves sessions as a token hash -> session json file, and the revocations in a file
+// next to it, "sessions.json" going with "sessions_revocations.json".
+type FileSessionStore struct {
+	path           string
+	revocationPath string
+}
+
+func NewFileSessionStore(path string) *FileSessionStore {
+	extension := filepath.Ext(path)
+	return &FileSessionStore{path: path, revocationPath: strings.TrimSuffix(path, extension) + "_revocations" + extension}
+}
+
+func (store *FileSessionStore) Load() (map[string]Session, error) {
+	sessions := concurrentmap.NewConcurrentMap[string, Session]()
+	err := sessions.Load(store.path)
+	if errors.Is(err, io.EOF) {
+		// A freshly created file holds no sessions yet.
+		err = nil
+	}
+	return sessions.ReadAll(), err
+}
+
+func (store *FileSessionStore) Save(sessions map[string]Session) error {
+	result := concurrentmap.NewConcurrentMap[string, Session]()
+	for token, session := range sessions {
+		result.WritePair(token, &session)
+	}
+	return result.Store(store.path)
+}
+
+func (store *FileSessionStore) LoadRevocations() (Revocations, error) {
+	var revocations Revocations
+	content, err := os.ReadFile(store.revocationPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return revocations, nil
+	}
+	if err != nil {
+		return revocations, err
+	}
+	err = json.Unmarshal(content, &revocations)
+	return revocations, err
+}
+
+func (store *FileSessionStore) SaveRevocations(revocations Revocations) error {
+	content, err := json.Marshal(revocations)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(store.revocationPath, content, 0644)
+}
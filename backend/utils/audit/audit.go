@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+The audit log keeps who did what to the school's data, one JSON object per line, appended and
+never rewritten, so it can be read with ordinary tools and survives a crash of the server.
+*/
+
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+}
+
+// maxEntrySize bounds one line of the log, far above what any entry needs.
+const maxEntrySize = 1 << 20
+
+var (
+	auditPath = "data/audit.log"
+	auditLock sync.Mutex
+)
+
+// SetAuditFile changes where entries are appended.
+func SetAuditFile(path string) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	auditPath = path
+}
+
+func Record(actor string, action string, detail string) error {
+	line, err := json.Marshal(Entry{Time: time.Now(), Actor: actor, Action: action, Detail: detail})
+	if err != nil {
+		return err
+	}
+	if len(line) >= maxEntrySize {
+		return fmt.Errorf("audit entry of %d bytes is too long", len(line))
+	}
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	file, err := os.OpenFile(auditPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// ReadEntries returns every entry, oldest first, and none when nothing was recorded yet.
+func ReadEntries() ([]Entry, error) {
+	auditLock.Lock()
+	defer auditLock.Unlock()
+	file, err := os.Open(auditPath)
+	if os.IsNotExist(err) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := []Entry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxEntrySize)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	SetAuditFile(filepath.Join(t.TempDir(), "audit.log"))
+	if entries, err := ReadEntries(); err != nil || len(entries) != 0 {
+		t.Fatalf("Expected no entries before recording, got %v, %v", entries, err)
+	}
+	Record("admin", "PromoteStudents", "first")
+	Record("admin", "PromoteStudents", "second")
+	entries, err := ReadEntries()
+	if err != nil {
+		t.Fatalf("Failed to read entries: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Detail != "first" || entries[1].Actor != "admin" || entries[1].Time.IsZero() {
+		t.Errorf("Unexpected entries: %+v", entries)
+	}
+}
+
+func TestLongEntries(t *testing.T) {
+	SetAuditFile(filepath.Join(t.TempDir(), "audit.log"))
+	long := strings.Repeat("x", 100*1024)
+	if err := Record("admin", "Import", long); err != nil {
+		t.Fatalf("Failed to record a long entry: %v", err)
+	}
+	if entries, err := ReadEntries(); err != nil || len(entries) != 1 || entries[0].Detail != long {
+		t.Errorf("Expected the long entry to be read back, got %d entries, %v", len(entries), err)
+	}
+	if err := Record("admin", "Import", strings.Repeat("x", maxEntrySize)); err == nil {
+		t.Error("Expected an entry over the limit to be refused")
+	}
+}
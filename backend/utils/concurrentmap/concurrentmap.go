@@ -42,6 +42,20 @@ func (it *ConcurrentMap[K, V]) DeletePair(key K) {
 	delete(it.data, key)
 }
 
+// ModifyPair applies modify to the value of key in place while holding the write lock,
+// so a read-modify-write cannot interleave with other writers. It reports whether the key exists.
+func (it *ConcurrentMap[K, V]) ModifyPair(key K, modify func(value *V)) bool {
+	it.lock.Lock()
+	defer it.lock.Unlock()
+	value, ok := it.data[key]
+	if !ok {
+		return false
+	}
+	modify(&value)
+	it.data[key] = value
+	return true
+}
+
 func (it *ConcurrentMap[K, V]) Load(fileName string) error {
 	it.lock.Lock()
 	defer it.lock.Unlock()
@@ -74,6 +88,24 @@ func (it *ConcurrentMap[K, V]) Store(fileName string) error {
 	return nil
 }
 
+// MarshalJSON lets a ConcurrentMap nested in another one be stored as a plain json object.
+func (it *ConcurrentMap[K, V]) MarshalJSON() ([]byte, error) {
+	it.lock.RLock()
+	defer it.lock.RUnlock()
+	return json.Marshal(it.data)
+}
+
+func (it *ConcurrentMap[K, V]) UnmarshalJSON(content []byte) error {
+	data := make(map[K]V)
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	it.lock.Lock()
+	defer it.lock.Unlock()
+	it.data = data
+	return nil
+}
+
 func (it *ConcurrentMap[K, V]) Clear() {
 	it.lock.Lock()
 	defer it.lock.Unlock()
@@ -103,3 +103,61 @@ func TestConcurrentMap_File(t *testing.T) {
 	}
 	os.Remove(file_name)
 }
+
+func TestConcurrentMap_ModifyPair(t *testing.T) {
+	test_instance := NewConcurrentMap[string, int]()
+	zero := 0
+	test_instance.WritePair("counter", &zero)
+	wg := sync.WaitGroup{}
+	for i := 0; i < THREAD_NUM; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			test_instance.ModifyPair("counter", func(value *int) { *value++ })
+		}()
+	}
+	wg.Wait()
+	if read_value, _ := test_instance.ReadPair("counter"); read_value != THREAD_NUM {
+		t.Errorf("ModifyPair test failed-counter: %d, expected: %d", read_value, THREAD_NUM)
+	}
+	if test_instance.ModifyPair("missing", func(value *int) { *value = 1 }) {
+		t.Errorf("ModifyPair test failed: missing key reported as existing")
+	}
+	if _, ok := test_instance.ReadPair("missing"); ok {
+		t.Errorf("ModifyPair test failed: missing key was created")
+	}
+}
+
+func TestConcurrentMap_NestedFile(t *testing.T) {
+	test_instance := NewConcurrentMap[string, *ConcurrentMap[string, int]]()
+	for i := 0; i < 3; i++ {
+		inner := NewConcurrentMap[string, int]()
+		for j := 0; j < 3; j++ {
+			value := i * j
+			inner.WritePair(fmt.Sprintf("%s-%d", "inner", j), &value)
+		}
+		test_instance.WritePair(fmt.Sprintf("%s-%d", "key", i), &inner)
+	}
+	file_name := "test_nested_map.json"
+	defer os.Remove(file_name)
+	if err := test_instance.Store(file_name); err != nil {
+		t.Fatalf("Nested file test failed at storing: %s", err.Error())
+	}
+	loaded := NewConcurrentMap[string, *ConcurrentMap[string, int]]()
+	if err := loaded.Load(file_name); err != nil {
+		t.Fatalf("Nested file test failed at loading: %s", err.Error())
+	}
+	for i := 0; i < 3; i++ {
+		inner, ok := loaded.ReadPair(fmt.Sprintf("%s-%d", "key", i))
+		if !ok {
+			t.Fatalf("Nested file test failed at reading-key: %d", i)
+		}
+		for j := 0; j < 3; j++ {
+			if read_value, ok := inner.ReadPair(fmt.Sprintf("%s-%d", "inner", j)); !ok || read_value != i*j {
+				t.Errorf("Nested file test failed at reading-inner: %d-%d, value: %d", i, j, read_value)
+			}
+		}
+		zero := 0
+		inner.WritePair("writable", &zero)
+	}
+}
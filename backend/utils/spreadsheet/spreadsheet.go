@@ -0,0 +1,39 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"regexp"
+	"strings"
+)
+
+// ContentType is the media type of the files EncodeCSV writes.
+const ContentType = "text/csv; charset=utf-8"
+
+// Excel reads a CSV as the local code page unless it starts with a UTF-8 byte order mark.
+const byteOrderMark = "\ufeff"
+
+// numberPattern matches a signed decimal, which a spreadsheet reads as a number, not a formula.
+var numberPattern = regexp.MustCompile(`^[-+][0-9]+(\.[0-9]+)?$`)
+
+// EncodeCSV writes rows, the header first, as a CSV that Excel opens with Chinese intact. Cells
+// starting like a formula are quoted with an apostrophe so a spreadsheet shows them as text, but
+// signed numbers such as -3.5 are left alone.
+func EncodeCSV(rows [][]string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString(byteOrderMark)
+	writer := csv.NewWriter(&buffer)
+	writer.UseCRLF = true
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) && !numberPattern.MatchString(cell) {
+				cell = "'" + cell
+			}
+			cells[i] = cell
+		}
+		writer.Write(cells)
+	}
+	writer.Flush()
+	return buffer.Bytes()
+}
@@ -0,0 +1,38 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestEncodeCSV(t *testing.T) {
+	content := string(EncodeCSV([][]string{{"name", "teacher"}, {"数学, 上", "=SUM(A1)"}}))
+	if !strings.HasPrefix(content, "\ufeff") {
+		t.Fatalf("Expected a byte order mark, got %q", content)
+	}
+	if !strings.Contains(content, "\r\n") {
+		t.Errorf("Expected CRLF line endings, got %q", content)
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, "\ufeff"))).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read the CSV back: %v", err)
+	}
+	if len(records) != 2 || records[1][0] != "数学, 上" || records[1][1] != "'=SUM(A1)" {
+		t.Errorf("Unexpected records: %q", records)
+	}
+}
+
+func TestEncodeCSVSignedCells(t *testing.T) {
+	cells := map[string]string{"-3": "-3", "+2.5": "+2.5", "-1+2": "'-1+2", "-A1": "'-A1", "+": "'+", "-": "'-"}
+	for cell, expected := range cells {
+		content := strings.TrimPrefix(string(EncodeCSV([][]string{{cell}})), "\ufeff")
+		records, err := csv.NewReader(strings.NewReader(content)).ReadAll()
+		if err != nil {
+			t.Fatalf("Failed to read the CSV back: %v", err)
+		}
+		if records[0][0] != expected {
+			t.Errorf("Expected %q to be written as %q, got %q", cell, expected, records[0][0])
+		}
+	}
+}
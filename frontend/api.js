@@ -28,6 +28,13 @@ export async function apiCall(action, parameters) {
             body: JSON.stringify(requestBody),
         });
 
+        // 导出报表时后端直接返回文件，交给浏览器下载
+        const disposition = response.headers.get('Content-Disposition');
+        if (response.ok && disposition && disposition.startsWith('attachment')) {
+            const fileName = downloadFile(await response.blob(), disposition);
+            return {download: fileName};
+        }
+
         const data = await response.json();
 
         if (!response.ok) {
@@ -39,8 +46,8 @@ export async function apiCall(action, parameters) {
             throw new Error(data.errorMessage);
         }
 
-        // 登录成功，存储token
-        if (action === 'LogIn' && data.authToken) {
+        // 登录或修改密码成功，存储新的token
+        if (data.authToken) {
             localStorage.setItem('authToken', data.authToken);
         }
 
@@ -55,4 +62,27 @@ export async function apiCall(action, parameters) {
         console.error(`API调用 [${action}] 失败:`, error);
         throw error; // 将错误继续向上抛出，以便UI层捕获
     }
+}
+
+/**
+ * 把返回的文件保存到本地
+ * @param {Blob} blob - 文件内容
+ * @param {string} disposition - Content-Disposition 响应头
+ * @returns {string} - 文件名
+ */
+function downloadFile(blob, disposition) {
+    let fileName = 'report.csv';
+    const encoded = disposition.match(/filename\*=utf-8''([^;]+)/i);
+    const plain = disposition.match(/filename="?([^";]+)"?/i);
+    if (encoded) {
+        fileName = decodeURIComponent(encoded[1]);
+    } else if (plain) {
+        fileName = plain[1];
+    }
+    const link = document.createElement('a');
+    link.href = URL.createObjectURL(blob);
+    link.download = fileName;
+    link.click();
+    URL.revokeObjectURL(link.href);
+    return fileName;
 }
\ No newline at end of file
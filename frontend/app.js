@@ -5,6 +5,13 @@ import {apiCall} from './api.js';
 // 1. 操作配置 (Action Configuration)
 // 这是驱动动态表单的核心。我们为每个action定义它需要的字段。
 // =================================================================
+const SLOTS_PLACEHOLDER =
+    '[{"day":1,"startPeriod":1,"endPeriod":2,"firstWeek":1,"lastWeek":16}]';
+
+const ROUND_PLACEHOLDER =
+    '{"name":"第一轮","start":"2024-09-01T08:00:00+08:00","end":"2024-09-08T08:00:00+08:00",' +
+    '"courses":[],"grades":[1],"select":{"start":"...","end":"..."},"drop":{"start":"...","end":"..."},"mode":""}';
+
 const ACTION_CONFIG = {
   // --- 用户管理 ---
   Register: {
@@ -55,6 +62,26 @@ const ACTION_CONFIG = {
     title: '修改密码',
     fields: [{path: 'password', label: '新密码', type: 'password'}]
   },
+  ResetPassword: {
+    title: '重置用户密码 (管理员权限)',
+    fields: [{path: 'name', label: '要重置密码的用户名', type: 'text'}]
+  },
+  ListSessions: {
+    title: '查看会话 (管理员权限)',
+    fields: [{path: 'name', label: '用户名 (留空查看全部)', type: 'text'}]
+  },
+  RevokeSessions: {
+    title: '强制下线 (管理员权限)',
+    fields: [{path: 'name', label: '要下线的用户名', type: 'text'}]
+  },
+  SetHomeroomTeacher: {
+    title: '设置班主任 (管理员权限)',
+    fields: [
+      {path: 'class.grade', label: '年级', type: 'number'},
+      {path: 'class.class', label: '班级', type: 'number'},
+      {path: 'name', label: '教师用户名', type: 'text'}
+    ]
+  },
   GetUserInfo: {
     title: '获取用户信息 (教师权限)',
     fields: [{path: 'name', label: '要查询的用户名', type: 'text'}]
@@ -74,34 +101,276 @@ const ACTION_CONFIG = {
       {path: 'courseName', label: '课程名称 (按课程查询)', type: 'text'}
     ]
   },
+  SearchUsers: {
+    title: '搜索用户 (管理员权限)',
+    fields: [
+      {path: 'prefix', label: '用户名前缀', type: 'text'},
+      {path: 'contains', label: '用户名包含', type: 'text'},
+      {path: 'privileges', label: '权限 (JSON 数组)', type: 'json', placeholder: '["student", "teacher", "admin"]'},
+      {path: 'fromClass', label: '起始班级 (JSON，留空不限)', type: 'json', placeholder: '{"grade": 1, "class": 1}'},
+      {path: 'toClass', label: '结束班级 (JSON，留空不限)', type: 'json', placeholder: '{"grade": 3, "class": 10}'},
+      {path: 'sort', label: '排序', type: 'select', options: [{text: '按用户名', value: 'uid'}, {text: '按班级', value: 'class'}]},
+      {path: 'cursor', label: '翻页游标 (上一页的 nextCursor)', type: 'text'},
+      {path: 'limit', label: '每页数量', type: 'number', placeholder: '默认 50，最多 500'}
+    ]
+  },
+  ModifyUser: {
+    title: '修改用户班级或身份 (管理员权限)',
+    fields: [
+      {path: 'userInfo.username', label: '用户名', type: 'text'},
+      {path: 'userInfo.Identity_info.Class.grade', label: '新年级', type: 'number'},
+      {path: 'userInfo.Identity_info.Class.class', label: '新班级', type: 'number'},
+      {path: 'userInfo.Identity_info.privilege', label: '新身份', type: 'select', options: [{text: '学生', value: 'student'}, {text: '教师', value: 'teacher'}, {text: '管理员', value: 'admin'}]}
+    ]
+  },
+  SetUserRole: {
+    title: '设置用户角色 (管理员权限)',
+    fields: [
+      {path: 'username', label: '用户名', type: 'text'},
+      {path: 'role', label: '角色', type: 'text', placeholder: '例如: head teacher，留空恢复为身份默认角色'}
+    ]
+  },
+  PromoteStudents: {
+    title: '学年升级与毕业 (管理员权限)',
+    fields: [
+      {path: 'topGrade', label: '毕业年级', type: 'number', placeholder: '例如: 3'},
+      {path: 'dryRun', label: '执行方式', type: 'select', json: true, options: [{text: '仅预览', value: 'true'}, {text: '正式执行', value: 'false'}]}
+    ]
+  },
+  GetAuditLog: {
+    title: '查看审计日志 (管理员权限)',
+    fields: []
+  },
+  CreateClass: {
+    title: '创建班级 (管理员权限)',
+    fields: [
+      {path: 'Class.grade', label: '年级', type: 'number'},
+      {path: 'Class.class', label: '班级', type: 'number'},
+      {path: 'name', label: '显示名称', type: 'text', placeholder: '例如: 高一(3)班'},
+      {path: 'capacity', label: '容量', type: 'number', placeholder: '0 表示不限'}
+    ]
+  },
+  ModifyClass: {
+    title: '修改班级名称与容量 (管理员权限)',
+    fields: [
+      {path: 'Class.grade', label: '年级', type: 'number'},
+      {path: 'Class.class', label: '班级', type: 'number'},
+      {path: 'name', label: '新显示名称', type: 'text'},
+      {path: 'capacity', label: '新容量', type: 'number', placeholder: '0 表示不限'}
+    ]
+  },
+  RenameClass: {
+    title: '班级改编号 (管理员权限)',
+    fields: [
+      {path: 'Class.grade', label: '原年级', type: 'number'},
+      {path: 'Class.class', label: '原班级', type: 'number'},
+      {path: 'newClass.grade', label: '新年级', type: 'number'},
+      {path: 'newClass.class', label: '新班级', type: 'number'}
+    ]
+  },
+  DeleteClass: {
+    title: '删除空班级 (管理员权限)',
+    fields: [
+      {path: 'Class.grade', label: '年级', type: 'number'},
+      {path: 'Class.class', label: '班级', type: 'number'}
+    ]
+  },
+  GetClasses: {
+    title: '班级列表',
+    fields: [
+      {path: 'emptyOnly', label: '范围', type: 'select', json: true, options: [{text: '全部班级', value: 'false'}, {text: '仅空班级', value: 'true'}]}
+    ]
+  },
+  ImportUsers: {
+    title: '批量导入用户 (管理员权限)',
+    fields: [
+      {path: 'csv', label: 'CSV 内容 (用户名,密码,年级,班级,身份)', type: 'textarea', placeholder: 'username,password,grade,class,role\nstu_1,pass_1,1,1,student'},
+      {path: 'mode', label: '导入方式', type: 'select', options: [{text: '有错误时全部不导入', value: 'all-or-nothing'}, {text: '只导入正确的行', value: 'best-effort'}]}
+    ]
+  },
+  ExportReport: {
+    title: '导出报表 (CSV)',
+    fields: [
+      {path: 'report', label: '报表', type: 'select', options: [{text: '班级名单', value: 'class'}, {text: '课程名单', value: 'course'}, {text: '课程填充情况', value: 'fill'}]},
+      {path: 'Class.grade', label: '年级 (班级名单)', type: 'number'},
+      {path: 'Class.class', label: '班级 (班级名单)', type: 'number'},
+      {path: 'courseName', label: '课程名称 (课程名单)', type: 'text'}
+    ]
+  },
   // --- 课程管理 ---
   AddCourse: {
     title: '添加课程 (管理员权限)',
     fields: [
       {path: 'courseInfo.name', label: '课程名称', type: 'text'},
       {path: 'courseInfo.teacherName', label: '教师姓名', type: 'text'},
-      {path: 'courseInfo.maximum', label: '课程容量', type: 'number'}
+      {path: 'courseInfo.maximum', label: '课程容量', type: 'number'},
+      {path: 'courseInfo.credits', label: '学分', type: 'number'},
+      {path: 'courseInfo.slots', label: '上课时间 (JSON 数组)', type: 'json', placeholder: SLOTS_PLACEHOLDER},
+      {path: 'courseInfo.description', label: '课程简介', type: 'text'},
+      {path: 'courseInfo.room', label: '教室', type: 'text'},
+      {path: 'courseInfo.category', label: '类别', type: 'select', options: [{text: '未分类', value: ''}, {text: '文艺', value: 'arts'}, {text: '科学', value: 'science'}, {text: '体育', value: 'sports'}]},
+      {path: 'courseInfo.tags', label: '标签 (JSON 数组)', type: 'json', placeholder: '["标签1", "标签2"]'}
     ]
   },
   ModifyCourse: {
     title: '修改课程 (管理员权限)',
     fields: [
       {path: 'courseName', label: '原课程名称', type: 'text'},
-      {path: 'courseInfo.name', label: '新课程名称', type: 'text'},
+      {path: 'courseInfo.name', label: '新课程名称', type: 'text', placeholder: '留空则不改名'},
       {path: 'courseInfo.teacherName', label: '新教师姓名', type: 'text'},
-      {path: 'courseInfo.maximum', label: '新课程容量', type: 'number'}
+      {path: 'courseInfo.maximum', label: '新课程容量', type: 'number'},
+      {path: 'courseInfo.credits', label: '新学分', type: 'number'},
+      {path: 'courseInfo.slots', label: '新上课时间 (JSON 数组)', type: 'json', placeholder: SLOTS_PLACEHOLDER},
+      {path: 'courseInfo.description', label: '新课程简介', type: 'text'},
+      {path: 'courseInfo.room', label: '新教室', type: 'text'},
+      {path: 'courseInfo.category', label: '新类别', type: 'select', options: [{text: '未分类', value: ''}, {text: '文艺', value: 'arts'}, {text: '科学', value: 'science'}, {text: '体育', value: 'sports'}]},
+      {path: 'courseInfo.tags', label: '新标签 (JSON 数组)', type: 'json', placeholder: '["标签1", "标签2"]'}
     ]
   },
   LaunchCourse: {
     title: '发布课程 (管理员权限)',
     fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
   },
-  GetAllCoursesInfo: {title: '获取所有课程信息', fields: []},
+  UnlaunchCourse: {
+    title: '下线课程 (管理员权限)',
+    fields: [
+      {path: 'courseName', label: '课程名称', type: 'text'},
+      {path: 'cascade', label: '已选学生', type: 'select', json: true, options: [{text: '有学生时拒绝', value: 'false'}, {text: '退掉并通知学生', value: 'true'}]}
+    ]
+  },
+  ArchiveCourse: {
+    title: '归档课程 (管理员权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  RemoveCourse: {
+    title: '删除课程 (管理员权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  GetAllCoursesInfo: {
+    title: '获取所有课程信息',
+    fields: [{
+      path: 'eligibleOnly',
+      label: '筛选',
+      type: 'select',
+      json: true,
+      options: [{text: '全部课程', value: ''}, {text: '仅显示有资格选择的课程', value: 'true'}]
+    }]
+  },
+  SearchCourses: {
+    title: '搜索课程',
+    fields: [
+      {path: 'text', label: '关键词 (课程名/教师/简介)', type: 'text'},
+      {path: 'teacher', label: '教师姓名', type: 'text'},
+      {path: 'categories', label: '类别 (JSON 数组)', type: 'json', placeholder: '["arts", "science", "sports"]'},
+      {path: 'launched', label: '发布状态', type: 'select', json: true, options: [{text: '全部', value: ''}, {text: '已发布', value: 'true'}, {text: '未发布', value: 'false'}]},
+      {path: 'hasSeats', label: '余量', type: 'select', json: true, options: [{text: '全部', value: 'false'}, {text: '仅有余量', value: 'true'}]},
+      {path: 'eligibleOnly', label: '资格', type: 'select', json: true, options: [{text: '全部', value: 'false'}, {text: '仅有资格选择', value: 'true'}]},
+      {path: 'grade', label: '面向年级', type: 'number', placeholder: '留空为不限'},
+      {path: 'sort', label: '排序', type: 'select', options: [{text: '按名称', value: 'name'}, {text: '按余量', value: 'seats'}, {text: '按热度', value: 'popularity'}]},
+      {path: 'cursor', label: '翻页游标 (上一页的 nextCursor)', type: 'text'},
+      {path: 'limit', label: '每页数量', type: 'number', placeholder: '默认 20，最多 100'}
+    ]
+  },
   SelectCourse: {
     title: '选择课程 (学生权限)',
     fields: [{path: 'courseName', label: '要选择的课程名称', type: 'text'}]
   },
-  DropCourse: {title: '退出课程 (学生权限)', fields: []}
+  DropCourse: {
+    title: '退出课程 (学生权限)',
+    fields: [{path: 'courseName', label: '要退出的课程名称', type: 'text'}]
+  },
+  SetSelectionLimit: {
+    title: '设置选课上限 (管理员权限)',
+    fields: [
+      {path: 'maxCourses', label: '最多课程门数 (0 为不限)', type: 'number'},
+      {path: 'maxCredits', label: '最多学分 (0 为不限)', type: 'number'}
+    ]
+  },
+  ResizeCourse: {
+    title: '调整课程容量 (管理员权限)',
+    fields: [
+      {path: 'courseName', label: '课程名称', type: 'text'},
+      {path: 'maximum', label: '新课程容量', type: 'number'}
+    ]
+  },
+  JoinWaitlist: {
+    title: '加入候补名单 (学生权限)',
+    fields: [{path: 'courseName', label: '要候补的课程名称', type: 'text'}]
+  },
+  LeaveWaitlist: {
+    title: '退出候补名单 (学生权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  GetWaitlistPosition: {
+    title: '查询候补位置 (学生权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  SetCourseEligibility: {
+    title: '设置选课资格 (管理员权限)',
+    fields: [
+      {path: 'courseName', label: '课程名称', type: 'text'},
+      {path: 'rule', label: '资格规则 (JSON，留空为不限)', type: 'json', placeholder: '{"any":[{"grades":[2]},{"completed":"课程名"}]}'}
+    ]
+  },
+  SetCurrentTerm: {
+    title: '设置当前学期 (管理员权限)',
+    fields: [{path: 'term', label: '学期 (如 2024-2)', type: 'text'}]
+  },
+  RecordCompletion: {
+    title: '记录修课完成 (管理员权限)',
+    fields: [
+      {path: 'name', label: '学生用户名', type: 'text'},
+      {path: 'courseName', label: '课程名称', type: 'text'},
+      {path: 'term', label: '完成学期', type: 'text'}
+    ]
+  },
+  CreateRound: {
+    title: '创建选课轮次 (管理员权限)',
+    fields: [{path: 'round', label: '轮次 (JSON)', type: 'json', placeholder: ROUND_PLACEHOLDER}]
+  },
+  ModifyRound: {
+    title: '修改选课轮次 (管理员权限)',
+    fields: [{path: 'round', label: '轮次 (JSON，按名称匹配)', type: 'json', placeholder: ROUND_PLACEHOLDER}]
+  },
+  CloseRound: {
+    title: '关闭选课轮次 (管理员权限)',
+    fields: [{path: 'name', label: '轮次名称', type: 'text'}]
+  },
+  GetNotifications: {
+    title: '查看我的通知',
+    fields: [{path: 'clear', label: '查看后', type: 'select', json: true, options: [{text: '保留', value: 'false'}, {text: '清空', value: 'true'}]}]
+  },
+  GetRounds: {title: '获取所有选课轮次', fields: []},
+  SubmitIntent: {
+    title: '提交抽签意向 (学生权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  WithdrawIntent: {
+    title: '撤回抽签意向 (学生权限)',
+    fields: [{path: 'courseName', label: '课程名称', type: 'text'}]
+  },
+  GetIntents: {title: '查看我的抽签意向 (学生权限)', fields: []},
+  RunLottery: {
+    title: '执行抽签 (管理员权限)',
+    fields: [
+      {path: 'round', label: '轮次名称', type: 'text'},
+      {path: 'seed', label: '随机种子', type: 'number'}
+    ]
+  },
+  SubmitPreferences: {
+    title: '提交志愿 (学生权限)',
+    fields: [{path: 'courses', label: '课程名称 (JSON 数组，按志愿排序)', type: 'json', placeholder: '["课程A", "课程B"]'}]
+  },
+  GetPreferences: {title: '查看我的志愿 (学生权限)', fields: []},
+  RunAllocation: {
+    title: '执行志愿分配 (管理员权限)',
+    fields: [
+      {path: 'round', label: '轮次名称', type: 'text'},
+      {path: 'algorithm', label: '算法', type: 'select', options: ['serial-dictatorship', 'deferred-acceptance']},
+      {path: 'seed', label: '随机种子', type: 'number'},
+      {path: 'dryRun', label: '模式', type: 'select', json: true, options: [{text: '仅预演', value: 'true'}, {text: '正式分配', value: 'false'}]}
+    ]
+  }
 };
 
 // =================================================================
@@ -154,6 +423,14 @@ function renderFormForAction(action) {
         }
         input.appendChild(option);
       });
+    } else if (field.type === 'textarea') {
+      input = document.createElement('textarea');
+      input.rows = 8;
+      input.placeholder = field.placeholder || '';
+    } else if (field.type === 'json') {
+      input = document.createElement('input');
+      input.type = 'text';
+      input.placeholder = field.placeholder || '';
     } else {
       input = document.createElement('input');
       input.type = field.type || 'text';
@@ -162,6 +439,9 @@ function renderFormForAction(action) {
 
     input.id = field.path;
     input.name = field.path;
+    if (field.type === 'json' || field.json) {
+      input.dataset.json = 'true';  // 值按 JSON 解析后再发送
+    }
 
     group.appendChild(label);
     group.appendChild(input);
@@ -175,7 +455,7 @@ function renderFormForAction(action) {
  */
 function buildParametersFromForm() {
   const params = {};
-  const inputs = dynamicForm.querySelectorAll('input, select');
+  const inputs = dynamicForm.querySelectorAll('input, select, textarea');
 
   inputs.forEach(input => {
     const path = input.name;
@@ -184,6 +464,8 @@ function buildParametersFromForm() {
     // 类型转换
     if (input.type === 'number') {
       value = value ? Number(value) : null;
+    } else if (input.dataset.json) {
+      value = value ? JSON.parse(value) : null;
     }
 
     // 使用辅助函数设置嵌套值